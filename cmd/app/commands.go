@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/repository"
+	"github.com/bllexe/sticky-notes/internal/service"
+)
+
+// defaultBackupDir is where backup archives go, next to the data directory.
+const defaultBackupDir = "backups"
+
+// fileCommands are the maintenance commands. They work on the file store's
+// directory layout and are not available for other backends.
+var fileCommands = map[string]func(*repository.FileRepository, []string) error{
+	"migrate": runMigrate,
+	"encrypt": runEncrypt,
+	"doctor":  runDoctor,
+	"backup":  runBackup,
+	"restore": runRestore,
+	"watch":   runWatch,
+	"layout":  runLayout,
+}
+
+// runCommand runs a maintenance command given on the command line instead
+// of starting the interactive menu.
+func runCommand(repo repository.NoteRepository, name string, args []string) error {
+	run, ok := fileCommands[name]
+	if !ok {
+		names := make([]string, 0, len(fileCommands))
+		for command := range fileCommands {
+			names = append(names, command)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	fileRepo, ok := repo.(*repository.FileRepository)
+	if !ok {
+		return fmt.Errorf("%s only works with a file store", name)
+	}
+	return run(fileRepo, args)
+}
+
+// commandNeedsUnlock reports whether a command reads or writes notes and so
+// needs an encrypted store to be unlocked first. Backups and layout
+// changes move encrypted files as they are.
+func commandNeedsUnlock(name string) bool {
+	return name != "encrypt" && name != "backup" && name != "layout"
+}
+
+func runMigrate(repo *repository.FileRepository, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be migrated without changing any file")
+	backupDir := flags.String("backup-dir", "", "where to copy the data directory before migrating")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := repo.Migrate(repository.MigrateOptions{DryRun: *dryRun, BackupDir: *backupDir})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Scanned %d notes (current schema version %d)\n", report.Scanned, repository.CurrentSchemaVersion)
+	for _, m := range report.Migrated {
+		fmt.Printf("  %s: version %d -> %d\n", m.Path, m.From, repository.CurrentSchemaVersion)
+	}
+	for _, f := range report.Failed {
+		fmt.Printf("  %s: FAILED: %v\n", f.Path, f.Err)
+	}
+
+	switch {
+	case report.DryRun:
+		fmt.Printf("Dry run: %d notes would be migrated.\n", len(report.Migrated))
+	case len(report.Migrated) == 0:
+		fmt.Println("All notes are up to date.")
+	default:
+		fmt.Printf("Migrated %d notes. Backup written to %s\n", len(report.Migrated), report.BackupDir)
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d notes could not be migrated", len(report.Failed))
+	}
+	return nil
+}
+
+func runEncrypt(repo *repository.FileRepository, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: encrypt init|status|change-passphrase|rekey [--keyfile path]")
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("encrypt "+action, flag.ContinueOnError)
+	keyfile := flags.String("keyfile", "", "use the contents of this file instead of a passphrase")
+	newKeyfile := flags.String("new-keyfile", "", "change-passphrase: switch to this keyfile")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch action {
+	case "status":
+		if repo.Encrypted() {
+			fmt.Println("The note store is encrypted.")
+		} else {
+			fmt.Println("The note store is not encrypted.")
+		}
+		return nil
+	case "init":
+		secret, err := readNewSecret(*keyfile, "New passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := repo.EnableEncryption(secret); err != nil {
+			return err
+		}
+		fmt.Println("Encryption enabled. Existing notes have been encrypted.")
+		return nil
+	case "change-passphrase":
+		oldSecret, err := readSecret(*keyfile, "Current passphrase: ")
+		if err != nil {
+			return err
+		}
+		newSecret, err := readNewSecret(*newKeyfile, "New passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := repo.ChangePassphrase(oldSecret, newSecret); err != nil {
+			return err
+		}
+		fmt.Println("Passphrase changed.")
+		return nil
+	case "rekey":
+		secret, err := readSecret(*keyfile, "Passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := repo.RotateKey(secret); err != nil {
+			return err
+		}
+		fmt.Println("All notes re-encrypted with a new key.")
+		return nil
+	default:
+		return fmt.Errorf("unknown encrypt action %q", action)
+	}
+}
+
+func runLayout(repo *repository.FileRepository, args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("The note store uses the %s layout.\n", repo.Layout())
+		return nil
+	}
+	if len(args) > 1 {
+		return errors.New("usage: layout [flat|sharded]")
+	}
+	report, err := repo.SetLayout(repository.Layout(args[0]))
+	if err != nil {
+		return err
+	}
+	if report.From == report.To {
+		fmt.Printf("The note store already uses the %s layout.\n", report.To)
+		return nil
+	}
+	fmt.Printf("Converted the note store from the %s to the %s layout (%d files moved).\n", report.From, report.To, report.Moved)
+	return nil
+}
+
+func runDoctor(repo *repository.FileRepository, args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "repair what can be repaired and quarantine the rest without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := repo.Check()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checked %d files.\n", report.Scanned)
+	if len(report.Issues) == 0 {
+		fmt.Println("No problems found.")
+		return nil
+	}
+	fmt.Printf("Found %d problems:\n", len(report.Issues))
+
+	reader := bufio.NewReader(os.Stdin)
+	unresolved := 0
+	for _, issue := range report.Issues {
+		fmt.Printf("\n[%s] %s: %s\n", issue.Kind, issue.Path, issue.Message)
+
+		action := "q"
+		switch {
+		case *fix && issue.Repairable:
+			action = "r"
+		case !*fix:
+			prompt := "[q]uarantine or [s]kip? "
+			if issue.Repairable {
+				prompt = "[r]epair, [q]uarantine or [s]kip? "
+			}
+			fmt.Print(prompt)
+			input, _ := reader.ReadString('\n')
+			action = strings.ToLower(strings.TrimSpace(input))
+		}
+
+		switch {
+		case action == "r" && issue.Repairable:
+			err = repo.Repair(issue)
+		case action == "q":
+			err = repo.Quarantine(issue)
+		default:
+			unresolved++
+			continue
+		}
+		if err != nil {
+			fmt.Printf("  failed: %v\n", err)
+			unresolved++
+			continue
+		}
+		fmt.Println("  done")
+	}
+
+	if unresolved > 0 {
+		return fmt.Errorf("%d problems left unresolved", unresolved)
+	}
+	return nil
+}
+
+func runBackup(repo *repository.FileRepository, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := flags.String("dir", defaultBackupDir, "directory to write the archive to")
+	keepDaily := flags.Int("keep-daily", 7, "keep the newest backup of each of this many days (0 keeps all)")
+	keepWeekly := flags.Int("keep-weekly", 4, "keep the newest backup of each of this many weeks (0 keeps all)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	archive, manifest, err := repo.BackupTo(*dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %d notes and %d trashed notes to %s\n", manifest.Notes, manifest.Trashed, archive)
+
+	removed, err := repository.PruneBackups(*dir, repository.BackupRetention{Daily: *keepDaily, Weekly: *keepWeekly})
+	for _, old := range removed {
+		fmt.Printf("  removed old backup %s\n", old)
+	}
+	return err
+}
+
+func runRestore(repo *repository.FileRepository, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	replace := flags.Bool("replace", false, "replace the store with the backup instead of merging it in")
+	verifyOnly := flags.Bool("verify", false, "only check the archive against its manifest")
+	dir := flags.String("dir", defaultBackupDir, "where to back up the store before replacing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: restore [--replace] [--verify] archive.tar.gz")
+	}
+	archive := flags.Arg(0)
+
+	manifest, err := repository.VerifyBackup(archive)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup from %s: %d notes, %d trashed notes, schema version %d",
+		manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), manifest.Notes, manifest.Trashed, manifest.SchemaVersion)
+	if manifest.Encrypted {
+		fmt.Print(", encrypted")
+	}
+	fmt.Println()
+	if *verifyOnly {
+		fmt.Println("Archive verified.")
+		return nil
+	}
+
+	if *replace {
+		safety, _, err := repo.BackupTo(*dir)
+		if err != nil {
+			return fmt.Errorf("failed to back up the current store: %w", err)
+		}
+		fmt.Printf("Current store backed up to %s\n", safety)
+	}
+
+	report, err := repo.RestoreBackup(archive, repository.RestoreOptions{Replace: *replace})
+	if err != nil {
+		return err
+	}
+	if *replace {
+		fmt.Printf("Store replaced: %d files restored, %d removed.\n", report.Added, report.Removed)
+	} else {
+		fmt.Printf("Backup merged: %d notes added, %d updated, %d already up to date.\n",
+			report.Added, report.Updated, report.Skipped)
+	}
+	if repo.Locked() {
+		fmt.Println("The restored store is encrypted; you will be asked for its passphrase next time.")
+	}
+	return nil
+}
+
+// runWatch prints the changes other programs make to the data directory
+// until interrupted.
+func runWatch(repo *repository.FileRepository, args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	poll := flags.Bool("poll", false, "rescan the directory periodically instead of using change notifications")
+	interval := flags.Duration("interval", repository.DefaultWatchInterval, "how often to rescan when polling")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	noteService := service.NewNoteService(repo)
+	sub, err := noteService.Events().Subscribe(events.SubscribeOptions{})
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	watcher, err := noteService.WatchStore(repository.WatchOptions{Poll: *poll, Interval: *interval})
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	how := "change notifications"
+	if watcher.Polling() {
+		how = fmt.Sprintf("polling every %s", *interval)
+	}
+	fmt.Printf("Watching for changes (%s), press Ctrl+C to stop.\n", how)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	for {
+		select {
+		case e := <-sub.Events():
+			printEvent(e)
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+func printEvent(e events.Event) {
+	stamp := e.Time.Local().Format("15:04:05")
+	switch {
+	case e.Kind == events.Invalid:
+		fmt.Printf("%s %-8s %s: %v\n", stamp, e.Kind, e.NoteID, e.Err)
+	case e.After != nil:
+		fmt.Printf("%s %-8s %s [%s] %s\n", stamp, e.Kind, e.NoteID, e.After.Color, firstLine(e.After.Content))
+	default:
+		fmt.Printf("%s %-8s %s\n", stamp, e.Kind, e.NoteID)
+	}
+}
+
+func firstLine(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	return line
+}
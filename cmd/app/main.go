@@ -1,38 +1,133 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/bllexe/sticky-notes/internal/handler"
+	"github.com/bllexe/sticky-notes/internal/reminder"
 	"github.com/bllexe/sticky-notes/internal/repository"
 	"github.com/bllexe/sticky-notes/internal/service"
 )
 
 func main() {
+	storeFlag := flag.String("store", "", "note store DSN, e.g. file:///path/to/data, jsonl:///path/notes.log, md:///path/to/notes or mem://")
+	flag.Parse()
+	args := flag.Args()
+
 	// Get the current working directory
 	currentDir, err := os.Getwd()
 	if err != nil {
 		log.Fatalf("Failed to get current directory: %v", err)
 	}
 
-	// Setup data directory
-	dataDir := filepath.Join(currentDir, "data")
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
-	}
-
 	// Initialize repository
-	repo, err := repository.NewFileRepository(dataDir)
+	dsn, err := storeDSN(*storeFlag, currentDir)
+	if err != nil {
+		log.Fatalf("Failed to select note store: %v", err)
+	}
+	repo, err := repository.Open(dsn)
 	if err != nil {
 		log.Fatalf("Failed to create repository: %v", err)
 	}
+	if closer, ok := repo.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if fileRepo, ok := repo.(*repository.FileRepository); ok {
+		openFileStore(fileRepo, args)
+	}
+
+	// Run a maintenance command instead of the menu if one was given
+	if len(args) > 0 {
+		if err := runCommand(repo, args[0], args[1:]); err != nil {
+			log.Fatalf("%s: %v", args[0], err)
+		}
+		return
+	}
 
 	// Initialize service
 	noteService := service.NewNoteService(repo)
+	if value := os.Getenv("STICKY_NOTES_TRASH_RETENTION"); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid STICKY_NOTES_TRASH_RETENTION: %v", err)
+		}
+		noteService.SetTrashRetention(retention)
+	}
+	if n, err := noteService.PurgeExpiredTrash(); err != nil {
+		log.Printf("Failed to purge expired trash: %v", err)
+	} else if n > 0 {
+		log.Printf("Purged %d notes from the trash", n)
+	}
+
+	// Pick up notes edited by hand or by other programs while running
+	watcher, err := noteService.WatchStore(repository.WatchOptions{})
+	if err == nil {
+		defer watcher.Close()
+	} else if !errors.Is(err, service.ErrWatchUnsupported) {
+		log.Printf("Failed to watch note store: %v", err)
+	}
+
+	// Fire reminders, including any missed while the app was closed
+	if scheduler := startReminders(noteService); scheduler != nil {
+		defer scheduler.Close()
+	}
 
 	// Initialize and start CLI handler
 	cli := handler.NewCLIHandler(noteService)
 	cli.Start()
 }
+
+// startReminders starts the reminder scheduler with the notifiers chosen by
+// STICKY_NOTES_NOTIFY, or returns nil if reminders are turned off.
+func startReminders(noteService *service.NoteService) *reminder.Scheduler {
+	notifiers, err := reminder.ParseNotifiers(os.Getenv("STICKY_NOTES_NOTIFY"), os.Stdout)
+	if err != nil {
+		log.Fatalf("Invalid STICKY_NOTES_NOTIFY: %v", err)
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	opts := reminder.Options{OnError: func(err error) { log.Printf("Reminders: %v", err) }}
+	if value := os.Getenv("STICKY_NOTES_REMINDER_POLL"); value != "" {
+		if opts.Poll, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("Invalid STICKY_NOTES_REMINDER_POLL: %v", err)
+		}
+	}
+	scheduler, err := reminder.Start(noteService, notifiers, opts)
+	if err != nil {
+		log.Printf("Failed to start reminders: %v", err)
+		return nil
+	}
+	return scheduler
+}
+
+// openFileStore applies the file store settings, reports crash recovery and
+// unlocks an encrypted store for this session.
+func openFileStore(repo *repository.FileRepository, args []string) {
+	if value := os.Getenv("STICKY_NOTES_LOCK_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid STICKY_NOTES_LOCK_TIMEOUT: %v", err)
+		}
+		repo.SetLockTimeout(timeout)
+	}
+	if report := repo.Recovery(); !report.Empty() {
+		log.Printf("Recovered data directory: %d restored, %d temp files removed, %d quarantined, %d rewritten by an interrupted transaction, %d moved by an interrupted layout change",
+			len(report.Recovered), len(report.Removed), len(report.Quarantined), len(report.Replayed), report.Relocated)
+	}
+
+	if repo.Encrypted() && (len(args) == 0 || commandNeedsUnlock(args[0])) {
+		secret, err := readSecret(os.Getenv(keyfileEnv), "Passphrase: ")
+		if err != nil {
+			log.Fatalf("Failed to read passphrase: %v", err)
+		}
+		if err := repo.Unlock(secret); err != nil {
+			log.Fatalf("Failed to unlock note store: %v", err)
+		}
+	}
+}
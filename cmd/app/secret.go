@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// keyfileEnv names a keyfile used to unlock an encrypted store instead of
+// prompting for a passphrase.
+const keyfileEnv = "STICKY_NOTES_KEYFILE"
+
+// readSecret returns the contents of keyfile if one is given, and
+// otherwise prompts for a passphrase.
+func readSecret(keyfile, prompt string) ([]byte, error) {
+	if keyfile != "" {
+		secret, err := os.ReadFile(keyfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyfile: %w", err)
+		}
+		if len(bytes.TrimSpace(secret)) == 0 {
+			return nil, errors.New("keyfile is empty")
+		}
+		return secret, nil
+	}
+	return readPassphrase(prompt)
+}
+
+// readNewSecret is readSecret for a new passphrase, which is asked for twice.
+func readNewSecret(keyfile, prompt string) ([]byte, error) {
+	secret, err := readSecret(keyfile, prompt)
+	if err != nil || keyfile != "" {
+		return secret, err
+	}
+	confirm, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(secret, confirm) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return secret, nil
+}
+
+// readPassphrase prompts on the terminal with echo turned off. Stdin is
+// read byte by byte so nothing meant for the menu is buffered away.
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Print(prompt)
+	if setEcho(false) == nil {
+		defer func() {
+			setEcho(true)
+			fmt.Println()
+		}()
+	}
+
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+	}
+
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+	return line, nil
+}
+
+func setEcho(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// storeEnv selects the note store when no --store flag is given.
+	storeEnv = "STICKY_NOTES_STORE"
+	// configFile is read from the working directory if it exists.
+	configFile = "sticky-notes.json"
+)
+
+type config struct {
+	// Store is the DSN of the note store, as accepted by repository.Open.
+	Store string `json:"store"`
+}
+
+// storeDSN picks the note store: the --store flag wins over the
+// environment, which wins over the config file. Without any of them notes
+// are kept in the data directory under dir.
+func storeDSN(flagValue, dir string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if value := os.Getenv(storeEnv); value != "" {
+		return value, nil
+	}
+
+	cfg, err := readConfig(filepath.Join(dir, configFile))
+	if err != nil {
+		return "", err
+	}
+	if cfg.Store != "" {
+		return cfg.Store, nil
+	}
+	return filepath.Join(dir, "data"), nil
+}
+
+func readConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,117 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// KeySize is the size of data and key-encryption keys (AES-256).
+const KeySize = 32
+
+// SaltSize is the size of the random salt used when deriving keys.
+const SaltSize = 16
+
+// DefaultIterations is the PBKDF2 work factor for new key derivations.
+var DefaultIterations = 600_000
+
+// ErrDecrypt is returned when sealed data fails authentication, either
+// because the key is wrong or the data was tampered with.
+var ErrDecrypt = errors.New("decryption failed: wrong key or corrupted data")
+
+// Cipher seals and opens data with AES-256-GCM.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size %d, want %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts and authenticates plaintext, along with additionalData
+// which is authenticated but not stored. The random nonce is prepended to
+// the returned ciphertext.
+func (c *Cipher) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open reverses Seal. It fails unless additionalData is what the data was
+// sealed with.
+func (c *Cipher) Open(sealed, additionalData []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:n], sealed[n:], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// RandomBytes returns n bytes from the system's secure random source.
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return b, nil
+}
+
+// DeriveKey stretches a passphrase or keyfile contents into a key with
+// PBKDF2-HMAC-SHA256.
+func DeriveKey(secret, salt []byte, iterations int) []byte {
+	return pbkdf2(sha256.New, secret, salt, iterations, KeySize)
+}
+
+// pbkdf2 implements RFC 8018 section 5.2.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	var counter [4]byte
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
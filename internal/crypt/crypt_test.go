@@ -0,0 +1,84 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors from RFC 7914 section 11.
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		keyLen     int
+		want       string
+	}{
+		{
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			keyLen:     64,
+			want:       "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			password:   "Password",
+			salt:       "NaCl",
+			iterations: 80000,
+			keyLen:     64,
+			want:       "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+		},
+	}
+
+	for _, tt := range tests {
+		got := pbkdf2(sha256.New, []byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen)
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("PBKDF2(%s, %s, %d) mismatch, got: %x", tt.password, tt.salt, tt.iterations, got)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key, _ := RandomBytes(KeySize)
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+
+	plaintext := []byte(`{"content":"secret"}`)
+	ad := []byte("note/n1")
+	sealed, err := c.Seal(plaintext, ad)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Error("Expected sealed data not to contain the plaintext")
+	}
+
+	opened, err := c.Open(sealed, ad)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Round trip mismatch, got: %s", opened)
+	}
+
+	if _, err := c.Open(sealed, []byte("note/n2")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for other additional data, got: %v", err)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := c.Open(sealed, ad); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for tampered data, got: %v", err)
+	}
+
+	otherKey, _ := RandomBytes(KeySize)
+	other, _ := NewCipher(otherKey)
+	sealed, _ = c.Seal(plaintext, ad)
+	if _, err := other.Open(sealed, ad); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for wrong key, got: %v", err)
+	}
+}
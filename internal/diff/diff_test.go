@@ -0,0 +1,57 @@
+package diff
+
+import (
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "Identical",
+			a:    "one\ntwo",
+			b:    "one\ntwo",
+			want: "  one\n  two\n",
+		},
+		{
+			name: "Changed Line",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: "  one\n- two\n+ 2\n  three\n",
+		},
+		{
+			name: "Appended Lines",
+			a:    "one",
+			b:    "one\ntwo\nthree",
+			want: "  one\n+ two\n+ three\n",
+		},
+		{
+			name: "From Empty",
+			a:    "",
+			b:    "one",
+			want: "+ one\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Format(Lines(tt.a, tt.b))
+			if got != tt.want {
+				t.Errorf("Diff mismatch, got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChanged(t *testing.T) {
+	if Changed(Lines("same", "same")) {
+		t.Error("Expected identical text to be unchanged")
+	}
+	if !Changed(Lines("before", "after")) {
+		t.Error("Expected different text to be changed")
+	}
+}
@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict markers surround the lines both sides of a merge changed
+// differently: ours first, then theirs.
+const (
+	MarkerOurs   = "<<<<<<<"
+	MarkerSplit  = "======="
+	MarkerTheirs = ">>>>>>>"
+)
+
+// Merge combines two texts that were both changed from base, line by line.
+// A region changed on only one side takes that side's lines. A region
+// changed differently on both sides is kept from both between conflict
+// markers, and clean is false.
+func Merge(base, ours, theirs string) (merged string, clean bool) {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	mo, mt := matches(b, o), matches(b, t)
+
+	var out []string
+	clean = true
+	i, j, k := 0, 0, 0
+	for {
+		// The next base line both sides kept ends the current region.
+		next := i
+		for next < len(b) && (mo[next] < 0 || mt[next] < 0) {
+			next++
+		}
+		endO, endT := len(o), len(t)
+		if next < len(b) {
+			endO, endT = mo[next], mt[next]
+		}
+
+		baseRegion, oursRegion, theirsRegion := b[i:next], o[j:endO], t[k:endT]
+		switch {
+		case slices.Equal(oursRegion, baseRegion):
+			out = append(out, theirsRegion...)
+		case slices.Equal(theirsRegion, baseRegion), slices.Equal(oursRegion, theirsRegion):
+			out = append(out, oursRegion...)
+		default:
+			clean = false
+			out = append(out, MarkerOurs)
+			out = append(out, oursRegion...)
+			out = append(out, MarkerSplit)
+			out = append(out, theirsRegion...)
+			out = append(out, MarkerTheirs)
+		}
+
+		if next == len(b) {
+			break
+		}
+		out = append(out, b[next])
+		i, j, k = next+1, endO+1, endT+1
+	}
+
+	merged = strings.Join(out, "\n")
+	// The final newline follows whichever side changed it.
+	newline := strings.HasSuffix(theirs, "\n")
+	if strings.HasSuffix(ours, "\n") != strings.HasSuffix(base, "\n") {
+		newline = strings.HasSuffix(ours, "\n")
+	}
+	if newline && merged != "" {
+		merged += "\n"
+	}
+	return merged, clean
+}
+
+// matches pairs the lines of x with lines of y along their longest common
+// subsequence. The result holds, for each line of x, the index of the
+// matching line of y, or -1 if it has none.
+func matches(x, y []string) []int {
+	lcs := lcsTable(x, y)
+	m := make([]int, len(x))
+	for i := range m {
+		m[i] = -1
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			m[i] = j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return m
+}
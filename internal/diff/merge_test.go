@@ -0,0 +1,82 @@
+package diff
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		want      string
+		wantClean bool
+	}{
+		{
+			name:      "Only Ours Changed",
+			base:      "one\ntwo\nthree",
+			ours:      "one\n2\nthree",
+			theirs:    "one\ntwo\nthree",
+			want:      "one\n2\nthree",
+			wantClean: true,
+		},
+		{
+			name:      "Separate Regions",
+			base:      "one\ntwo\nthree\nfour",
+			ours:      "1\ntwo\nthree\nfour",
+			theirs:    "one\ntwo\nthree\n4\nfive",
+			want:      "1\ntwo\nthree\n4\nfive",
+			wantClean: true,
+		},
+		{
+			name:      "Same Change",
+			base:      "one\ntwo",
+			ours:      "one\n2",
+			theirs:    "one\n2",
+			want:      "one\n2",
+			wantClean: true,
+		},
+		{
+			name:      "Deleted And Kept",
+			base:      "one\ntwo\nthree",
+			ours:      "one\nthree",
+			theirs:    "one\ntwo\nthree\nfour",
+			want:      "one\nthree\nfour",
+			wantClean: true,
+		},
+		{
+			name:      "Conflict",
+			base:      "one\ntwo\nthree",
+			ours:      "one\nmine\nthree",
+			theirs:    "one\nyours\nthree",
+			want:      "one\n<<<<<<<\nmine\n=======\nyours\n>>>>>>>\nthree",
+			wantClean: false,
+		},
+		{
+			name:      "Trailing Newline",
+			base:      "one",
+			ours:      "one\n",
+			theirs:    "one\ntwo",
+			want:      "one\ntwo\n",
+			wantClean: true,
+		},
+		{
+			name:      "From Empty",
+			base:      "",
+			ours:      "a",
+			theirs:    "b",
+			want:      "<<<<<<<\na\n=======\nb\n>>>>>>>",
+			wantClean: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, clean := Merge(tt.base, tt.ours, tt.theirs)
+			if got != tt.want || clean != tt.wantClean {
+				t.Errorf("Merge mismatch, got (clean %v):\n%s\nwant (clean %v):\n%s", clean, got, tt.wantClean, tt.want)
+			}
+		})
+	}
+}
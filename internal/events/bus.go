@@ -0,0 +1,354 @@
+// Package events publishes note changes to in-process subscribers.
+//
+// Published events are kept in a bounded history and every event gets a
+// sequence number. A subscriber reads the history at its own pace from a
+// cursor, so a slow subscriber never holds up the others, and one that
+// disconnects can resume where it stopped as long as the events it missed
+// are still retained.
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// DefaultRetention is how many events a Bus keeps for replay when
+// NewBus is given zero.
+const DefaultRetention = 1024
+
+// DefaultBuffer is the channel capacity of a subscription when
+// SubscribeOptions leaves it at zero.
+const DefaultBuffer = 16
+
+type Kind string
+
+const (
+	Created  Kind = "created"
+	Updated  Kind = "updated"
+	Deleted  Kind = "deleted"
+	Restored Kind = "restored"
+	Purged   Kind = "purged"
+	// Invalid reports a note file that was edited outside the application
+	// and could not be accepted. The note keeps its Before version.
+	Invalid Kind = "invalid"
+)
+
+// Event describes one change to a note.
+type Event struct {
+	// Seq numbers events from 1 in the order they were published. Pass the
+	// last Seq handled to Resume to continue after it.
+	Seq    uint64
+	Kind   Kind
+	NoteID string
+	Time   time.Time
+	// Before is the note as it was, nil for Created. After is the note as
+	// it is now, nil for Purged and for Deleted when the store has no
+	// trash; a trashed note has DeletedAt set.
+	Before *model.Note
+	After  *model.Note
+	// Err says what is wrong with an Invalid note.
+	Err error
+}
+
+// Overflow decides what happens when a subscriber falls so far behind that
+// events it has not received yet drop out of the history.
+type Overflow int
+
+const (
+	// Skip moves the subscriber on to the oldest retained event. The
+	// events skipped are counted in Dropped and show as a gap in Seq.
+	Skip Overflow = iota
+	// Block makes Publish wait for the subscriber. A blocking subscriber
+	// must not publish, directly or through the service, while handling an
+	// event.
+	Block
+	// Disconnect closes the subscription with ErrOverflow. The subscriber
+	// can resume from its cursor while the events are still retained.
+	Disconnect
+)
+
+var (
+	// ErrOverflow is reported by Err when a Disconnect subscriber fell
+	// behind.
+	ErrOverflow = errors.New("subscriber fell behind the event history")
+	// ErrCursorExpired is returned by Resume when events after the cursor
+	// are no longer retained.
+	ErrCursorExpired = errors.New("events after the cursor are no longer retained")
+	// ErrClosed is returned when subscribing to a closed bus.
+	ErrClosed = errors.New("event bus is closed")
+)
+
+type SubscribeOptions struct {
+	// Buffer is the capacity of the subscription's channel.
+	Buffer   int
+	Overflow Overflow
+	// Kinds limits the subscription to events of these kinds; empty means
+	// all of them.
+	Kinds []Kind
+}
+
+// Bus distributes events to subscribers. It is safe for concurrent use.
+type Bus struct {
+	mutex sync.Mutex
+	// changed is signalled whenever an event is published, a subscriber
+	// takes one or anything is closed.
+	changed *sync.Cond
+	// history is a ring of the last len(history) events; the newest has
+	// Seq last.
+	history []Event
+	last    uint64
+	closed  bool
+	subs    map[*Subscription]struct{}
+}
+
+// NewBus returns a bus that retains the last retention events for replay.
+func NewBus(retention int) *Bus {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	b := &Bus{
+		history: make([]Event, retention),
+		subs:    make(map[*Subscription]struct{}),
+	}
+	b.changed = sync.NewCond(&b.mutex)
+	return b
+}
+
+// Publish stamps e with the next sequence number and, if unset, the
+// current time, and hands it to the subscribers. It returns the stamped
+// event. Publishing to a closed bus does nothing.
+func (b *Bus) Publish(e Event) Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return e
+	}
+	// Once the ring is full, the next event overwrites the oldest one.
+	for b.last >= uint64(len(b.history)) && b.blockedBy(b.oldest()) {
+		b.changed.Wait()
+	}
+	if b.closed {
+		return e
+	}
+
+	b.last++
+	e.Seq = b.last
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Before, e.After = e.Before.Clone(), e.After.Clone()
+	b.history[b.slot(e.Seq)] = e
+	b.changed.Broadcast()
+	return e
+}
+
+// blockedBy reports whether a Block subscriber still needs the event with
+// sequence number seq.
+func (b *Bus) blockedBy(seq uint64) bool {
+	if b.closed {
+		return false
+	}
+	for sub := range b.subs {
+		if sub.opts.Overflow == Block && !sub.closed && sub.next <= seq {
+			return true
+		}
+	}
+	return false
+}
+
+// Cursor returns the sequence number of the last event published.
+func (b *Bus) Cursor() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.last
+}
+
+// Subscribe delivers the events published from now on.
+func (b *Bus) Subscribe(opts SubscribeOptions) (*Subscription, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.subscribe(b.last+1, opts)
+}
+
+// Resume delivers the retained events after cursor and then the new ones.
+// A cursor of zero replays everything retained, if nothing has been
+// dropped yet.
+func (b *Bus) Resume(cursor uint64, opts SubscribeOptions) (*Subscription, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if cursor > b.last {
+		cursor = b.last
+	}
+	if cursor+1 < b.oldest() {
+		return nil, ErrCursorExpired
+	}
+	return b.subscribe(cursor+1, opts)
+}
+
+func (b *Bus) subscribe(next uint64, opts SubscribeOptions) (*Subscription, error) {
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultBuffer
+	}
+	sub := &Subscription{
+		bus:  b,
+		opts: opts,
+		next: next,
+		ch:   make(chan Event, opts.Buffer),
+		done: make(chan struct{}),
+	}
+	b.subs[sub] = struct{}{}
+	go sub.run()
+	return sub, nil
+}
+
+// Close ends every subscription once it has received the events published
+// so far; later events are discarded.
+func (b *Bus) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	b.changed.Broadcast()
+}
+
+// oldest returns the sequence number of the oldest retained event.
+func (b *Bus) oldest() uint64 {
+	if b.last < uint64(len(b.history)) {
+		return 1
+	}
+	return b.last - uint64(len(b.history)) + 1
+}
+
+func (b *Bus) slot(seq uint64) int {
+	return int((seq - 1) % uint64(len(b.history)))
+}
+
+// Subscription receives events from a Bus until it is closed.
+type Subscription struct {
+	bus  *Bus
+	opts SubscribeOptions
+	ch   chan Event
+	done chan struct{}
+
+	// Guarded by the bus mutex.
+	next    uint64
+	dropped uint64
+	closed  bool
+	err     error
+}
+
+// Events returns the channel events are delivered on. It is closed when
+// the subscription ends; Err then says why.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close ends the subscription. Events still buffered in the channel can be
+// drained afterwards.
+func (s *Subscription) Close() {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+	delete(s.bus.subs, s)
+	s.bus.changed.Broadcast()
+}
+
+// Err returns ErrOverflow if the subscription was ended because it fell
+// behind, and nil otherwise.
+func (s *Subscription) Err() error {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	return s.err
+}
+
+// Dropped returns how many events a Skip subscriber has missed.
+func (s *Subscription) Dropped() uint64 {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	return s.dropped
+}
+
+// run copies events from the history to the channel. At most one event is
+// held outside the history, so a slow reader is only ever behind in the
+// history, where Overflow applies.
+func (s *Subscription) run() {
+	defer close(s.ch)
+	b := s.bus
+
+	for {
+		b.mutex.Lock()
+		for !s.closed && !b.closed && s.next > b.last {
+			b.changed.Wait()
+		}
+		if s.closed || s.next > b.last {
+			s.detach()
+			b.mutex.Unlock()
+			return
+		}
+		if oldest := b.oldest(); s.next < oldest {
+			if s.opts.Overflow == Disconnect {
+				s.err = ErrOverflow
+				s.detach()
+				b.mutex.Unlock()
+				return
+			}
+			s.dropped += oldest - s.next
+			s.next = oldest
+		}
+		e := b.history[b.slot(s.next)]
+		b.mutex.Unlock()
+
+		if s.wants(e.Kind) {
+			e.Before, e.After = e.Before.Clone(), e.After.Clone()
+			select {
+			case s.ch <- e:
+			case <-s.done:
+				return
+			}
+		}
+
+		b.mutex.Lock()
+		s.next = e.Seq + 1
+		b.changed.Broadcast()
+		b.mutex.Unlock()
+	}
+}
+
+// detach removes a subscription that ended on its own.
+func (s *Subscription) detach() {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	delete(s.bus.subs, s)
+	s.bus.changed.Broadcast()
+}
+
+func (s *Subscription) wants(kind Kind) bool {
+	if len(s.opts.Kinds) == 0 {
+		return true
+	}
+	for _, k := range s.opts.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
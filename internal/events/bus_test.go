@@ -0,0 +1,149 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("Subscription closed unexpectedly: %v", sub.Err())
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func publishN(bus *Bus, n int) {
+	for i := 0; i < n; i++ {
+		bus.Publish(Event{Kind: Updated, NoteID: "note"})
+	}
+}
+
+func TestSubscribeAndResume(t *testing.T) {
+	bus := NewBus(8)
+	defer bus.Close()
+
+	bus.Publish(Event{Kind: Created, NoteID: "before-subscribe"})
+	sub, err := bus.Subscribe(SubscribeOptions{})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	note := &model.Note{ID: "note1", Content: "content", Color: model.Yellow}
+	published := bus.Publish(Event{Kind: Created, NoteID: note.ID, After: note})
+	note.Content = "changed after publish"
+
+	e := receive(t, sub)
+	if e.Seq != published.Seq || e.Seq != 2 {
+		t.Errorf("Seq mismatch, got: %d, want: 2", e.Seq)
+	}
+	if e.NoteID != "note1" || e.After.Content != "content" {
+		t.Errorf("Expected a snapshot of the note, got: %+v", e.After)
+	}
+	if e.Time.IsZero() {
+		t.Error("Expected the event to be timestamped")
+	}
+
+	resumed, err := bus.Resume(0, SubscribeOptions{Kinds: []Kind{Created}})
+	if err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	defer resumed.Close()
+	bus.Publish(Event{Kind: Deleted, NoteID: "note1"})
+	bus.Publish(Event{Kind: Created, NoteID: "note2"})
+	for _, want := range []string{"before-subscribe", "note1", "note2"} {
+		if e := receive(t, resumed); e.NoteID != want {
+			t.Errorf("Replayed note mismatch, got: %s, want: %s", e.NoteID, want)
+		}
+	}
+
+	publishN(bus, 10)
+	if _, err := bus.Resume(1, SubscribeOptions{}); !errors.Is(err, ErrCursorExpired) {
+		t.Errorf("Expected ErrCursorExpired, got: %v", err)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	t.Run("skip", func(t *testing.T) {
+		bus := NewBus(4)
+		defer bus.Close()
+		sub, _ := bus.Subscribe(SubscribeOptions{Buffer: 1})
+		defer sub.Close()
+
+		// At most one event waits in the channel and one is held by the
+		// subscriber, so of ten some must be skipped.
+		publishN(bus, 10)
+		var seqs []uint64
+		for len(seqs) == 0 || seqs[len(seqs)-1] != 10 {
+			seqs = append(seqs, receive(t, sub).Seq)
+		}
+		if dropped := sub.Dropped(); dropped == 0 || int(dropped)+len(seqs) != 10 {
+			t.Errorf("Dropped count mismatch, got: %d, delivered: %v", dropped, seqs)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		bus := NewBus(4)
+		defer bus.Close()
+		sub, _ := bus.Subscribe(SubscribeOptions{Buffer: 1, Overflow: Disconnect})
+
+		publishN(bus, 10)
+		for range sub.Events() {
+		}
+		if err := sub.Err(); !errors.Is(err, ErrOverflow) {
+			t.Errorf("Expected ErrOverflow, got: %v", err)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		bus := NewBus(4)
+		defer bus.Close()
+		sub, _ := bus.Subscribe(SubscribeOptions{Buffer: 1, Overflow: Block})
+		defer sub.Close()
+
+		done := make(chan struct{})
+		go func() {
+			publishN(bus, 10)
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("Publish should wait for a blocking subscriber")
+		case <-time.After(50 * time.Millisecond):
+		}
+		for want := uint64(1); want <= 10; want++ {
+			if e := receive(t, sub); e.Seq != want {
+				t.Fatalf("Seq mismatch, got: %d, want: %d", e.Seq, want)
+			}
+		}
+		<-done
+	})
+}
+
+func TestClose(t *testing.T) {
+	bus := NewBus(0)
+	sub, _ := bus.Subscribe(SubscribeOptions{})
+	publishN(bus, 3)
+	bus.Close()
+
+	n := 0
+	for range sub.Events() {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("Expected pending events to be delivered, got: %d", n)
+	}
+	if _, err := bus.Subscribe(SubscribeOptions{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got: %v", err)
+	}
+}
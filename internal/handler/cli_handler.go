@@ -2,23 +2,45 @@ package handler
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/bllexe/sticky-notes/internal/diff"
+	"github.com/bllexe/sticky-notes/internal/events"
 	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
 	"github.com/bllexe/sticky-notes/internal/service"
 )
 
 type CLIHandler struct {
 	noteService *service.NoteService
 	reader      *bufio.Reader
+	// invalidEdits receives note files edited outside the app that could
+	// not be read, to be reported before the next menu.
+	invalidEdits *events.Subscription
+	// palette is reread before every menu, since another instance may
+	// have changed it.
+	palette *model.Palette
+	// swatches shows colors as colored blocks; it is off unless stdout is
+	// a terminal and NO_COLOR is unset.
+	swatches bool
 }
 
 func NewCLIHandler(noteService *service.NoteService) *CLIHandler {
+	swatches := false
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		swatches = os.Getenv("NO_COLOR") == ""
+	}
 	return &CLIHandler{
 		noteService: noteService,
 		reader:      bufio.NewReader(os.Stdin),
+		palette:     model.DefaultPalette(),
+		swatches:    swatches,
 	}
 }
 
@@ -26,7 +48,15 @@ func (h *CLIHandler) Start() {
 	fmt.Println("Welcome to Sticky Notes Application!")
 	fmt.Println("===================================")
 
+	sub, err := h.noteService.Events().Subscribe(events.SubscribeOptions{Kinds: []events.Kind{events.Invalid}})
+	if err == nil {
+		h.invalidEdits = sub
+		defer sub.Close()
+	}
+
 	for {
+		h.reportInvalidEdits()
+		h.loadPalette()
 		h.printMenu()
 		choice := h.readInput("Enter your choice: ")
 
@@ -42,6 +72,22 @@ func (h *CLIHandler) Start() {
 		case "5":
 			h.searchNotes()
 		case "6":
+			h.noteHistory()
+		case "7":
+			h.manageTrash()
+		case "8":
+			h.bulkActions()
+		case "9":
+			h.manageTags()
+		case "10":
+			h.managePalette()
+		case "11":
+			h.manageBoards()
+		case "12":
+			h.manageChecklists()
+		case "13":
+			h.manageReminders()
+		case "14":
 			fmt.Println("Goodbye!")
 			return
 		default:
@@ -50,6 +96,24 @@ func (h *CLIHandler) Start() {
 	}
 }
 
+func (h *CLIHandler) reportInvalidEdits() {
+	if h.invalidEdits == nil {
+		return
+	}
+	for {
+		select {
+		case e, ok := <-h.invalidEdits.Events():
+			if !ok {
+				h.invalidEdits = nil
+				return
+			}
+			fmt.Printf("\nWarning: a note was edited outside the app and was not loaded: %v\n", e.Err)
+		default:
+			return
+		}
+	}
+}
+
 func (h *CLIHandler) printMenu() {
 	fmt.Println("\nMenu:")
 	fmt.Println("1. Create new note")
@@ -57,7 +121,15 @@ func (h *CLIHandler) printMenu() {
 	fmt.Println("3. Update note")
 	fmt.Println("4. Delete note")
 	fmt.Println("5. Search notes")
-	fmt.Println("6. Exit")
+	fmt.Println("6. Note history")
+	fmt.Println("7. Trash")
+	fmt.Println("8. Bulk actions")
+	fmt.Println("9. Tags")
+	fmt.Println("10. Palette")
+	fmt.Println("11. Boards")
+	fmt.Println("12. Checklists")
+	fmt.Println("13. Reminders")
+	fmt.Println("14. Exit")
 }
 
 func (h *CLIHandler) readInput(prompt string) string {
@@ -68,9 +140,10 @@ func (h *CLIHandler) readInput(prompt string) string {
 
 func (h *CLIHandler) createNote() {
 	content := h.readInput("Enter note content: ")
-	color := h.selectColor()
+	color := h.selectColor("")
+	tags := splitTags(h.readInput("Tags (comma separated, optional): "))
 
-	note, err := h.noteService.CreateNote(content, color)
+	note, err := h.noteService.CreateNote(content, color, tags...)
 	if err != nil {
 		fmt.Printf("Error creating note: %v\n", err)
 		return
@@ -79,22 +152,57 @@ func (h *CLIHandler) createNote() {
 	fmt.Printf("Note created successfully with ID: %s\n", note.ID)
 }
 
+// listPageSize is how many notes the list shows before asking to go on.
+const listPageSize = 10
+
 func (h *CLIHandler) listNotes() {
-	notes, err := h.noteService.GetAllNotes()
+	input := h.readInput("Filter (blank for all, e.g. color:blue tags:\"bug AND NOT done\" items:open updated:2024-01-01.. sort:-updated): ")
+	query, err := repository.ParseQuery(input)
 	if err != nil {
-		fmt.Printf("Error getting notes: %v\n", err)
+		fmt.Printf("Invalid filter: %v\n", err)
 		return
 	}
+	if query.Limit == 0 {
+		query.Limit = listPageSize
+	}
 
-	if len(notes) == 0 {
-		fmt.Println("No notes found.")
-		return
+	defer h.printStoreWarnings()
+	shown := 0
+	for {
+		page, err := h.noteService.FindNotes(query)
+		if err != nil {
+			fmt.Printf("Error getting notes: %v\n", err)
+			return
+		}
+		if shown == 0 {
+			if len(page.Notes) == 0 {
+				fmt.Println("No notes found.")
+				return
+			}
+			fmt.Println("\nYour Notes:")
+		}
+		for _, note := range page.Notes {
+			h.printNote(note)
+		}
+		shown += len(page.Notes)
+
+		if page.Next == "" || !h.confirm(fmt.Sprintf("Shown %d notes. Show more?", shown)) {
+			return
+		}
+		query.Cursor = page.Next
 	}
+}
 
-	fmt.Println("\nYour Notes:")
-	for _, note := range notes {
-		h.printNote(note)
+func (h *CLIHandler) printStoreWarnings() {
+	warnings := h.noteService.StoreWarnings()
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Printf("\nWarning: %d note files could not be read and are not shown:\n", len(warnings))
+	for _, warning := range warnings {
+		fmt.Printf("  %s\n", warning)
 	}
+	fmt.Println("Run `sticky-notes doctor` to inspect and repair them.")
 }
 
 func (h *CLIHandler) updateNote() {
@@ -106,85 +214,931 @@ func (h *CLIHandler) updateNote() {
 		return
 	}
 
-	fmt.Printf("Current content: %s\n", note.Content)
-	content := h.readInput("Enter new content (press Enter to keep current): ")
-	if content == "" {
-		content = note.Content
+	var content string
+	if note.IsChecklist() {
+		// Items are edited from the Checklists menu.
+		fmt.Printf("Current title: %s\n", note.Content)
+		title := h.readInput("Enter new title (press Enter to keep current): ")
+		if title == "" {
+			title = note.Content
+		}
+		content = model.FormatChecklist(title, note.Items)
+	} else {
+		fmt.Printf("Current content: %s\n", note.Content)
+		content = h.readInput("Enter new content (press Enter to keep current): ")
+		if content == "" {
+			content = note.Content
+		}
 	}
 
-	color := h.selectColor()
+	color := h.selectColor(note.Color)
 
-	updatedNote, err := h.noteService.UpdateNote(id, content, color)
-	if err != nil {
-		fmt.Printf("Error updating note: %v\n", err)
+	// The edit is only saved over the version it was made to. If someone
+	// else saved the note in the meantime, the user decides what happens.
+	base := note
+	for {
+		updatedNote, err := h.noteService.UpdateNoteAt(id, base.Version, content, color)
+		var conflict *repository.ConflictError
+		if errors.As(err, &conflict) {
+			var ok bool
+			content, color, ok = h.resolveConflict(base, conflict.Current, content, color)
+			if !ok {
+				fmt.Println("Update cancelled.")
+				return
+			}
+			base = conflict.Current
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Error updating note: %v\n", err)
+			return
+		}
+
+		fmt.Println("Note updated successfully!")
+		h.printNote(updatedNote)
 		return
 	}
+}
+
+// resolveConflict shows an edit made to an outdated version of a note next
+// to the current version and asks whether to merge the two, overwrite the
+// current version or cancel. It returns the content and color to save over
+// the current version.
+func (h *CLIHandler) resolveConflict(base, current *model.Note, content string, color model.Color) (string, model.Color, bool) {
+	fmt.Printf("\nThis note was changed by someone else while you were editing it (now version %d, updated %s).\n",
+		current.Version, current.UpdatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Println("\nCurrent version:")
+	h.printNote(current)
+	fmt.Println("\nYour version:")
+	fmt.Printf("Content: %s\n", content)
+	fmt.Printf("Color: %s\n", color)
+	fmt.Println("\nChanges from the current version to yours:")
+	if current.Color != color {
+		fmt.Printf("Color: %s -> %s\n", current.Color, color)
+	}
+	fmt.Print(diff.Format(diff.Lines(current.Text(), content)))
 
-	fmt.Println("Note updated successfully!")
-	h.printNote(updatedNote)
+	fmt.Println("\n1. Merge your changes into the current version")
+	fmt.Println("2. Overwrite it with your version")
+	fmt.Println("3. Cancel")
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		merged, clean := diff.Merge(base.Text(), content, current.Text())
+		mergedColor := current.Color
+		if color != base.Color {
+			mergedColor = color
+		}
+		fmt.Println("\nMerged version:")
+		fmt.Printf("Content: %s\n", merged)
+		fmt.Printf("Color: %s\n", mergedColor)
+		if !clean {
+			fmt.Printf("Both versions changed the same lines; yours follow %s and the current ones end with %s.\n",
+				diff.MarkerOurs, diff.MarkerTheirs)
+		}
+		if !h.confirm("Save the merged version?") {
+			return "", "", false
+		}
+		return merged, mergedColor, true
+	case "2":
+		return content, color, true
+	default:
+		return "", "", false
+	}
 }
 
 func (h *CLIHandler) deleteNote() {
 	id := h.readInput("Enter note ID to delete: ")
 
-	err := h.noteService.DeleteNote(id)
+	note, err := h.noteService.GetNote(id)
+	if err != nil {
+		fmt.Printf("Error finding note: %v\n", err)
+		return
+	}
+	h.printNote(note)
+	if !h.confirm("Delete this note?") {
+		fmt.Println("Delete cancelled.")
+		return
+	}
+
+	trashed, err := h.noteService.DeleteNote(id)
 	if err != nil {
 		fmt.Printf("Error deleting note: %v\n", err)
 		return
 	}
 
-	fmt.Println("Note deleted successfully!")
+	if trashed {
+		fmt.Println("Note moved to trash. Restore it from the Trash menu.")
+	} else {
+		fmt.Println("Note deleted permanently; this store has no trash.")
+	}
 }
 
-func (h *CLIHandler) searchNotes() {
-	query := h.readInput("Enter search query: ")
-
-	notes, err := h.noteService.SearchNotes(query)
+func (h *CLIHandler) manageTrash() {
+	notes, err := h.noteService.ListTrash()
 	if err != nil {
-		fmt.Printf("Error searching notes: %v\n", err)
+		fmt.Printf("Error getting trash: %v\n", err)
 		return
 	}
 
 	if len(notes) == 0 {
-		fmt.Println("No matching notes found.")
+		fmt.Println("Trash is empty.")
 		return
 	}
-
-	fmt.Printf("\nFound %d matching notes:\n", len(notes))
+	fmt.Println("\nTrash:")
 	for _, note := range notes {
 		h.printNote(note)
 	}
+
+	fmt.Println("\n1. Restore note")
+	fmt.Println("2. Delete note permanently")
+	fmt.Println("3. Empty trash")
+	fmt.Println("4. Back")
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		id := h.readInput("Enter note ID to restore: ")
+		note, err := h.noteService.RestoreNote(id)
+		if err != nil {
+			fmt.Printf("Error restoring note: %v\n", err)
+			return
+		}
+		fmt.Println("Note restored successfully!")
+		h.printNote(note)
+	case "2":
+		id := h.readInput("Enter note ID to delete permanently: ")
+		if !h.confirm("This cannot be undone. Continue?") {
+			return
+		}
+		if err := h.noteService.PurgeNote(id); err != nil {
+			fmt.Printf("Error deleting note: %v\n", err)
+			return
+		}
+		fmt.Println("Note deleted permanently.")
+	case "3":
+		if !h.confirm(fmt.Sprintf("Permanently delete %d notes?", len(notes))) {
+			return
+		}
+		n, err := h.noteService.EmptyTrash()
+		if err != nil {
+			fmt.Printf("Error emptying trash: %v\n", err)
+			return
+		}
+		fmt.Printf("Deleted %d notes permanently.\n", n)
+	}
 }
 
-func (h *CLIHandler) selectColor() model.Color {
-	fmt.Println("\nAvailable colors:")
-	fmt.Println("1. Yellow")
-	fmt.Println("2. Blue")
-	fmt.Println("3. Green")
-	fmt.Println("4. Pink")
-	fmt.Println("5. Orange")
+// selectNotes asks for a filter and returns the IDs of the notes matching
+// it, or false if there are none.
+func (h *CLIHandler) selectNotes(prompt string) ([]string, bool) {
+	query, err := repository.ParseQuery(h.readInput(prompt))
+	if err != nil {
+		fmt.Printf("Invalid filter: %v\n", err)
+		return nil, false
+	}
+	page, err := h.noteService.FindNotes(query)
+	if err != nil {
+		fmt.Printf("Error getting notes: %v\n", err)
+		return nil, false
+	}
+	if len(page.Notes) == 0 {
+		fmt.Println("No notes found.")
+		return nil, false
+	}
+	ids := make([]string, len(page.Notes))
+	for i, note := range page.Notes {
+		ids[i] = note.ID
+	}
+	fmt.Printf("%d notes selected.\n", len(ids))
+	return ids, true
+}
 
-	choice := h.readInput("Select color (1-5) [default: Yellow]: ")
+// bulkActions recolors or deletes every note matching a filter in one
+// transaction.
+func (h *CLIHandler) bulkActions() {
+	ids, ok := h.selectNotes("Filter notes to change (e.g. color:yellow created:..2024-01-31): ")
+	if !ok {
+		return
+	}
+
+	fmt.Println("1. Change color")
+	fmt.Println("2. Delete")
+	fmt.Println("3. Back")
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		color := h.selectColor("")
+		updated, err := h.noteService.RecolorNotes(ids, color)
+		if err != nil {
+			fmt.Printf("Error changing colors: %v\n", err)
+			return
+		}
+		fmt.Printf("Changed the color of %d notes.\n", len(updated))
+	case "2":
+		if !h.confirm(fmt.Sprintf("Delete %d notes?", len(ids))) {
+			return
+		}
+		trashed, err := h.noteService.DeleteNotes(ids)
+		if err != nil {
+			fmt.Printf("Error deleting notes: %v\n", err)
+			return
+		}
+		if trashed {
+			fmt.Printf("Moved %d notes to the trash.\n", len(ids))
+		} else {
+			fmt.Printf("Deleted %d notes permanently; this store has no trash.\n", len(ids))
+		}
+	}
+}
+
+// manageTags lists the tags in use and adds, removes, renames or deletes
+// them.
+func (h *CLIHandler) manageTags() {
+	tags, err := h.noteService.ListTags()
+	if err != nil {
+		fmt.Printf("Error getting tags: %v\n", err)
+		return
+	}
+	if len(tags) == 0 {
+		fmt.Println("\nNo tags in use.")
+	} else {
+		fmt.Println("\nTags:")
+		for _, tag := range tags {
+			fmt.Printf("  %s (%d)\n", tag.Tag, tag.Count)
+		}
+	}
+
+	fmt.Println("\n1. Tag notes")
+	fmt.Println("2. Untag notes")
+	fmt.Println("3. Rename tag")
+	fmt.Println("4. Delete tag")
+	fmt.Println("5. Back")
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		ids, ok := h.selectNotes("Filter notes to tag (e.g. color:blue tag:work): ")
+		if !ok {
+			return
+		}
+		tags := splitTags(h.readInput("Tags to add (comma separated): "))
+		updated, err := h.noteService.TagNotes(ids, tags...)
+		if err != nil {
+			fmt.Printf("Error tagging notes: %v\n", err)
+			return
+		}
+		fmt.Printf("Tagged %d notes.\n", len(updated))
+	case "2":
+		ids, ok := h.selectNotes("Filter notes to untag (e.g. tag:done): ")
+		if !ok {
+			return
+		}
+		tags := splitTags(h.readInput("Tags to remove (comma separated): "))
+		updated, err := h.noteService.UntagNotes(ids, tags...)
+		if err != nil {
+			fmt.Printf("Error untagging notes: %v\n", err)
+			return
+		}
+		fmt.Printf("Untagged %d notes.\n", len(updated))
+	case "3":
+		from := h.readInput("Tag to rename: ")
+		to := h.readInput("New name: ")
+		renamed, err := h.noteService.RenameTag(from, to)
+		if err != nil {
+			fmt.Printf("Error renaming tag: %v\n", err)
+			return
+		}
+		fmt.Printf("Renamed the tag on %d notes.\n", renamed)
+	case "4":
+		tag := h.readInput("Tag to delete: ")
+		if !h.confirm(fmt.Sprintf("Remove %q from every note?", tag)) {
+			return
+		}
+		removed, err := h.noteService.DeleteTag(tag)
+		if err != nil {
+			fmt.Printf("Error deleting tag: %v\n", err)
+			return
+		}
+		fmt.Printf("Removed the tag from %d notes.\n", removed)
+	}
+}
+
+// managePalette lists the palette with how many notes have each color, and
+// adds, changes or removes colors. Removing a color that notes have asks
+// for a color to give them instead.
+func (h *CLIHandler) managePalette() {
+	usage, err := h.noteService.ColorUsage()
+	if err != nil {
+		fmt.Printf("Error counting colors: %v\n", err)
+		return
+	}
+	fmt.Println("\nPalette:")
+	for _, c := range h.palette.Colors {
+		suffix := ""
+		if c.Name == h.palette.Default {
+			suffix = ", default"
+		}
+		fmt.Printf("  %s %s (%d notes%s)\n", h.colorLabel(c.Name), c.Hex, usage[c.Name], suffix)
+	}
+	var others []string
+	for name, count := range usage {
+		if !h.palette.Has(name) {
+			others = append(others, fmt.Sprintf("  %s (%d notes, not in the palette)", name, count))
+		}
+	}
+	sort.Strings(others)
+	for _, line := range others {
+		fmt.Println(line)
+	}
 
-	switch choice {
+	fmt.Println("\n1. Add or change a color")
+	fmt.Println("2. Set the default color")
+	fmt.Println("3. Remove a color")
+	fmt.Println("4. Back")
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		name := model.Color(strings.ToLower(h.readInput("Color name: ")))
+		color, exists := h.palette.Lookup(name)
+		color.Name = name
+		if hex := h.readInput(fmt.Sprintf("Hex value [%s]: ", orDefault(color.Hex, "e.g. #e53935"))); hex != "" {
+			color.Hex = hex
+		}
+		meaning := h.readInput(fmt.Sprintf("Meaning, - for none [%s]: ", orDefault(color.Meaning, "none")))
+		switch meaning {
+		case "":
+		case "-":
+			color.Meaning = ""
+		default:
+			color.Meaning = meaning
+		}
+		if _, err := h.noteService.SetPaletteColor(color); err != nil {
+			fmt.Printf("Error saving color: %v\n", err)
+			return
+		}
+		if exists {
+			fmt.Printf("Color %s changed.\n", name)
+		} else {
+			fmt.Printf("Color %s added.\n", name)
+		}
 	case "2":
-		return model.Blue
+		color := h.selectColor(h.palette.Default)
+		if _, err := h.noteService.SetDefaultColor(color); err != nil {
+			fmt.Printf("Error setting the default color: %v\n", err)
+			return
+		}
+		fmt.Printf("New notes are now %s by default.\n", color)
 	case "3":
-		return model.Green
+		name := model.Color(strings.ToLower(h.readInput("Color to remove: ")))
+		remapped, err := h.noteService.RemovePaletteColor(name, "")
+		var inUse *service.ColorInUseError
+		if errors.As(err, &inUse) {
+			fmt.Printf("%d notes are %s. Choose the color to give them instead.\n", inUse.Notes, name)
+			remapTo := h.selectColor("")
+			if !h.confirm(fmt.Sprintf("Recolor %d notes to %s and remove %s?", inUse.Notes, remapTo, name)) {
+				return
+			}
+			remapped, err = h.noteService.RemovePaletteColor(name, remapTo)
+		}
+		if err != nil {
+			fmt.Printf("Error removing color: %v\n", err)
+			return
+		}
+		fmt.Printf("Color %s removed; %d notes were recolored.\n", name, remapped)
+	}
+}
+
+// manageBoards lists the boards, shows where the notes of one sit and
+// which of them overlap, and moves, resizes, stacks or arranges them.
+func (h *CLIHandler) manageBoards() {
+	boards, err := h.noteService.Boards()
+	if err != nil {
+		fmt.Printf("Error getting boards: %v\n", err)
+		return
+	}
+	fmt.Println("\nBoards:")
+	for _, board := range boards {
+		fmt.Printf("  %s (%d notes)\n", board.Name, board.Notes)
+	}
+	board := orDefault(strings.ToLower(h.readInput(fmt.Sprintf("Board to open [%s]: ", model.DefaultBoard))), model.DefaultBoard)
+	notes, err := h.noteService.BoardNotes(board)
+	if err != nil {
+		fmt.Printf("Error getting board: %v\n", err)
+		return
+	}
+	overlaps, err := h.noteService.Overlaps(board)
+	if err != nil {
+		fmt.Printf("Error finding overlaps: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\nBoard %s, back to front:\n", board)
+	for _, note := range notes {
+		if g := note.Geometry; g != nil {
+			fmt.Printf("  %s  %d,%d %dx%d z %d  %s\n", note.ID, g.X, g.Y, g.Width, g.Height, g.Z, summarize(note.Text()))
+		} else {
+			fmt.Printf("  %s  not placed  %s\n", note.ID, summarize(note.Text()))
+		}
+	}
+	for _, overlap := range overlaps {
+		fmt.Printf("Overlap: %s is under %s (%dx%d at %d,%d)\n", overlap.Below.ID, overlap.Above.ID,
+			overlap.Area.Width, overlap.Area.Height, overlap.Area.X, overlap.Area.Y)
+	}
+
+	fmt.Println("\n1. Move a note")
+	fmt.Println("2. Resize a note")
+	fmt.Println("3. Bring a note to front")
+	fmt.Println("4. Move a note to another board")
+	fmt.Println("5. Arrange the board")
+	fmt.Println("6. Back")
+	var note *model.Note
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		id := h.readInput("Enter note ID: ")
+		x, y, ok := h.readPair("New position (x, y): ")
+		if !ok {
+			return
+		}
+		note, err = h.noteService.MoveNote(id, x, y)
+	case "2":
+		id := h.readInput("Enter note ID: ")
+		width, height, ok := h.readPair("New size (width x height): ")
+		if !ok {
+			return
+		}
+		note, err = h.noteService.ResizeNote(id, width, height)
+	case "3":
+		note, err = h.noteService.BringToFront(h.readInput("Enter note ID: "))
 	case "4":
-		return model.Pink
+		id := h.readInput("Enter note ID: ")
+		note, err = h.noteService.MoveNoteToBoard(id, h.readInput("Board: "))
 	case "5":
-		return model.Orange
+		fmt.Println("1. Grid, oldest first")
+		fmt.Println("2. Cascade, most recently updated on top")
+		fmt.Println("3. Rows by color")
+		arrangements := map[string]service.Arrangement{"1": service.ArrangeGrid, "2": service.ArrangeCascade, "3": service.ArrangeByColor}
+		how, ok := arrangements[h.readInput("Enter your choice: ")]
+		if !ok {
+			fmt.Println("Invalid choice.")
+			return
+		}
+		moved, err := h.noteService.ArrangeBoard(board, how)
+		if err != nil {
+			fmt.Printf("Error arranging board: %v\n", err)
+			return
+		}
+		fmt.Printf("Arranged board %s; %d notes moved.\n", board, len(moved))
+		return
+	default:
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error placing note: %v\n", err)
+		return
+	}
+	h.printNote(note)
+}
+
+// manageChecklists creates checklists, changes the items of one and
+// converts notes between plain text and checklists.
+func (h *CLIHandler) manageChecklists() {
+	fmt.Println("\n1. New checklist")
+	fmt.Println("2. Edit a checklist")
+	fmt.Println("3. Convert a note to a checklist")
+	fmt.Println("4. Convert a checklist to text")
+	fmt.Println("5. Back")
+	var note *model.Note
+	var err error
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		title := h.readInput("Title (optional): ")
+		fmt.Println("Items, one per line; an empty line ends the list:")
+		var items []string
+		for {
+			item := h.readInput("- [ ] ")
+			if item == "" {
+				break
+			}
+			items = append(items, item)
+		}
+		color := h.selectColor("")
+		tags := splitTags(h.readInput("Tags (comma separated, optional): "))
+		note, err = h.noteService.CreateChecklist(title, color, items, tags...)
+	case "2":
+		note, err = h.noteService.GetNote(h.readInput("Enter note ID: "))
+		if err != nil {
+			fmt.Printf("Error finding note: %v\n", err)
+			return
+		}
+		if !note.IsChecklist() {
+			fmt.Println("This note is not a checklist; convert it first.")
+			return
+		}
+		h.printNote(note)
+		note, err = h.editChecklist(note.ID)
+		if note == nil && err == nil {
+			return
+		}
+	case "3":
+		note, err = h.noteService.ConvertToChecklist(h.readInput("Enter note ID: "))
+	case "4":
+		note, err = h.noteService.ConvertToText(h.readInput("Enter note ID: "))
+	default:
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error saving checklist: %v\n", err)
+		return
+	}
+	h.printNote(note)
+}
+
+// editChecklist applies one change to the items of a checklist. It returns
+// a nil note and error if the user backed out.
+func (h *CLIHandler) editChecklist(id string) (*model.Note, error) {
+	fmt.Println("\n1. Check or uncheck an item")
+	fmt.Println("2. Add an item")
+	fmt.Println("3. Remove an item")
+	fmt.Println("4. Move an item")
+	fmt.Println("5. Back")
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		if n, ok := h.readItemNumber("Item number: "); ok {
+			return h.noteService.ToggleChecklistItem(id, n)
+		}
+	case "2":
+		return h.noteService.AddChecklistItem(id, h.readInput("Item: "))
+	case "3":
+		if n, ok := h.readItemNumber("Item number: "); ok {
+			return h.noteService.RemoveChecklistItem(id, n)
+		}
+	case "4":
+		from, ok := h.readItemNumber("Item number: ")
+		if !ok {
+			return nil, nil
+		}
+		if to, ok := h.readItemNumber("New position: "); ok {
+			return h.noteService.MoveChecklistItem(id, from, to)
+		}
+	}
+	return nil, nil
+}
+
+// manageReminders lists due dates and reminders, and sets, snoozes or
+// dismisses them.
+func (h *CLIHandler) manageReminders() {
+	due, err := h.noteService.DueNotes()
+	if err != nil {
+		fmt.Printf("Error getting due dates: %v\n", err)
+		return
+	}
+	reminders, err := h.noteService.Reminders()
+	if err != nil {
+		fmt.Printf("Error getting reminders: %v\n", err)
+		return
+	}
+	now := time.Now()
+	fmt.Println("\nDue dates:")
+	for _, note := range due {
+		overdue := ""
+		if note.DueAt.Before(now) {
+			overdue = "  (overdue)"
+		}
+		fmt.Printf("  %s  %s  %s%s\n", note.ID, formatWhen(*note.DueAt), summarize(note.Text()), overdue)
+	}
+	fmt.Println("Reminders:")
+	for _, note := range reminders {
+		state := ""
+		if note.RemindedAt != nil {
+			state = "  (fired)"
+		}
+		fmt.Printf("  %s  %s  %s%s\n", note.ID, formatWhen(*note.RemindAt), summarize(note.Text()), state)
+	}
+
+	fmt.Println("\n1. Set a due date")
+	fmt.Println("2. Set a reminder")
+	fmt.Println("3. Snooze a reminder")
+	fmt.Println("4. Dismiss a reminder")
+	fmt.Println("5. Back")
+	var note *model.Note
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		id := h.readInput("Enter note ID: ")
+		at, ok := h.readWhen("Due (YYYY-MM-DD [HH:MM], HH:MM, +1h30m, or - to clear): ")
+		if !ok {
+			return
+		}
+		note, err = h.noteService.SetDueDate(id, at)
+	case "2":
+		id := h.readInput("Enter note ID: ")
+		at, ok := h.readWhen("Remind at (YYYY-MM-DD [HH:MM], HH:MM, +1h30m, or - to clear): ")
+		if !ok {
+			return
+		}
+		note, err = h.noteService.SetReminder(id, at)
+	case "3":
+		id := h.readInput("Enter note ID: ")
+		d, parseErr := time.ParseDuration(orDefault(h.readInput("Snooze for [10m]: "), "10m"))
+		if parseErr != nil {
+			fmt.Println("Invalid duration. Use a duration such as 10m or 1h.")
+			return
+		}
+		note, err = h.noteService.SnoozeReminder(id, d)
+	case "4":
+		note, err = h.noteService.DismissReminder(h.readInput("Enter note ID: "))
 	default:
-		return model.Yellow
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error scheduling note: %v\n", err)
+		return
+	}
+	h.printNote(note)
+}
+
+// readWhen reads a time as a date with an optional time of day, a time of
+// day today (or tomorrow if it has passed), or a duration from now after a
+// "+". A "-" returns nil, for clearing.
+func (h *CLIHandler) readWhen(prompt string) (*time.Time, bool) {
+	input := h.readInput(prompt)
+	if input == "-" {
+		return nil, true
+	}
+	now := time.Now()
+	if d, isDuration := strings.CutPrefix(input, "+"); isDuration {
+		if d, err := time.ParseDuration(d); err == nil && d > 0 {
+			at := now.Add(d)
+			return &at, true
+		}
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if at, err := time.ParseInLocation(layout, input, time.Local); err == nil {
+			return &at, true
+		}
+	}
+	if clock, err := time.ParseInLocation("15:04", input, time.Local); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return &at, true
+	}
+	fmt.Println("Invalid time.")
+	return nil, false
+}
+
+func formatWhen(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// readItemNumber reads an item number as shown, counting from 1, and
+// returns it as an index.
+func (h *CLIHandler) readItemNumber(prompt string) (int, bool) {
+	n, err := strconv.Atoi(h.readInput(prompt))
+	if err != nil || n < 1 {
+		fmt.Println("Invalid item number.")
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// readPair reads two integers separated by a comma, an x or spaces.
+func (h *CLIHandler) readPair(prompt string) (int, int, bool) {
+	fields := strings.FieldsFunc(strings.ToLower(h.readInput(prompt)), func(r rune) bool {
+		return r == ',' || r == 'x' || r == ' '
+	})
+	if len(fields) == 2 {
+		a, errA := strconv.Atoi(fields[0])
+		b, errB := strconv.Atoi(fields[1])
+		if errA == nil && errB == nil {
+			return a, b, true
+		}
+	}
+	fmt.Println("Invalid input. Enter two whole numbers.")
+	return 0, 0, false
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// splitTags reads tags separated by commas or spaces.
+func splitTags(input string) []string {
+	return strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+func (h *CLIHandler) confirm(prompt string) bool {
+	answer := strings.ToLower(h.readInput(prompt + " (y/N): "))
+	return answer == "y" || answer == "yes"
+}
+
+func (h *CLIHandler) searchNotes() {
+	input := h.readInput("Enter search query (word, prefix*, \"exact phrase\", color:blue, created:2024-01-01..): ")
+	query, err := repository.ParseQuery(input)
+	if err != nil {
+		fmt.Printf("Invalid search: %v\n", err)
+		return
+	}
+	if query.Text == "" {
+		fmt.Println("Enter some text to search for, or use the list to filter notes.")
+		return
+	}
+
+	results, err := h.noteService.SearchNotesMatching(query)
+	if err != nil {
+		fmt.Printf("Error searching notes: %v\n", err)
+		return
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No matching notes found.")
+		return
+	}
+
+	fmt.Printf("\nFound %d matching notes:\n", len(results))
+	for _, result := range results {
+		fmt.Printf("\nScore: %.2f", result.Score)
+		h.printNote(result.Note)
+	}
+}
+
+func (h *CLIHandler) noteHistory() {
+	id := h.readInput("Enter note ID: ")
+
+	revisions, err := h.noteService.ListRevisions(id)
+	if err != nil {
+		fmt.Printf("Error getting revisions: %v\n", err)
+		return
+	}
+
+	fmt.Println("\nRevisions:")
+	for _, rev := range revisions {
+		label := ""
+		if rev.Number == len(revisions) {
+			label = " (current)"
+		}
+		fmt.Printf("%d. %s [%s]%s %s\n", rev.Number, rev.CreatedAt.Format("2006-01-02 15:04:05"),
+			rev.Color, label, summarize(rev.Content))
+	}
+
+	fmt.Println("\n1. Show diff")
+	fmt.Println("2. Restore revision")
+	fmt.Println("3. Back")
+	switch h.readInput("Enter your choice: ") {
+	case "1":
+		from, ok := h.readRevisionNumber("Diff from revision: ")
+		if !ok {
+			return
+		}
+		to, ok := h.readRevisionNumber(fmt.Sprintf("Diff to revision [default: %d]: ", len(revisions)))
+		if !ok {
+			to = len(revisions)
+		}
+
+		d, err := h.noteService.DiffRevisions(id, from, to)
+		if err != nil {
+			fmt.Printf("Error comparing revisions: %v\n", err)
+			return
+		}
+		fmt.Printf("\n--- revision %d\n+++ revision %d\n", d.From.Number, d.To.Number)
+		if d.ColorFrom != d.ColorTo {
+			fmt.Printf("Color: %s -> %s\n", d.ColorFrom, d.ColorTo)
+		}
+		if !diff.Changed(d.Lines) {
+			fmt.Println("Content is identical.")
+			return
+		}
+		fmt.Print(diff.Format(d.Lines))
+	case "2":
+		number, ok := h.readRevisionNumber("Revision to restore: ")
+		if !ok {
+			return
+		}
+
+		note, err := h.noteService.RestoreRevision(id, number)
+		if err != nil {
+			fmt.Printf("Error restoring revision: %v\n", err)
+			return
+		}
+		fmt.Printf("Revision %d restored successfully!\n", number)
+		h.printNote(note)
+	}
+}
+
+func (h *CLIHandler) readRevisionNumber(prompt string) (int, bool) {
+	input := h.readInput(prompt)
+	if input == "" {
+		return 0, false
+	}
+	number, err := strconv.Atoi(input)
+	if err != nil {
+		fmt.Println("Invalid revision number.")
+		return 0, false
 	}
+	return number, true
+}
+
+// summarize returns the first line of content, shortened for listings.
+func summarize(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	if runes := []rune(line); len(runes) > 40 {
+		line = string(runes[:37]) + "..."
+	}
+	return line
+}
+
+// selectColor asks for a palette color by number or name. Enter keeps
+// current, or picks the palette's default if current is empty.
+func (h *CLIHandler) selectColor(current model.Color) model.Color {
+	if current == "" {
+		current = h.palette.Default
+	}
+	fmt.Println("\nAvailable colors:")
+	for i, c := range h.palette.Colors {
+		fmt.Printf("%d. %s\n", i+1, h.colorLabel(c.Name))
+	}
+
+	for {
+		choice := strings.ToLower(h.readInput(fmt.Sprintf("Select color (1-%d) [default: %s]: ", len(h.palette.Colors), current)))
+		if choice == "" {
+			return current
+		}
+		if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(h.palette.Colors) {
+			return h.palette.Colors[n-1].Name
+		}
+		if h.palette.Has(model.Color(choice)) {
+			return model.Color(choice)
+		}
+		fmt.Println("Invalid color. Please try again.")
+	}
+}
+
+// colorLabel renders a color with its swatch and meaning, and marks colors
+// that are no longer in the palette.
+func (h *CLIHandler) colorLabel(name model.Color) string {
+	c, found := h.palette.Lookup(name)
+	if !found {
+		return fmt.Sprintf("%s (not in the palette)", name)
+	}
+	label := string(name)
+	if h.swatches {
+		r, g, b := c.RGB()
+		label = fmt.Sprintf("\x1b[48;2;%d;%d;%dm  \x1b[0m %s", r, g, b, label)
+	}
+	if c.Meaning != "" {
+		label += " - " + c.Meaning
+	}
+	return label
+}
+
+func (h *CLIHandler) loadPalette() {
+	palette, err := h.noteService.Palette()
+	if err != nil {
+		fmt.Printf("\nWarning: could not read the palette, using the default colors: %v\n", err)
+		palette = model.DefaultPalette()
+	}
+	h.palette = palette
 }
 
 func (h *CLIHandler) printNote(note *model.Note) {
 	fmt.Printf("\nID: %s\n", note.ID)
-	fmt.Printf("Content: %s\n", note.Content)
-	fmt.Printf("Color: %s\n", note.Color)
+	if note.IsChecklist() {
+		if note.Content != "" {
+			fmt.Printf("Title: %s\n", note.Content)
+		}
+		done, total := note.Progress()
+		fmt.Printf("Checklist: %d/%d done\n", done, total)
+		for i, item := range note.Items {
+			box := " "
+			if item.Done {
+				box = "x"
+			}
+			fmt.Printf("  %d. [%s] %s\n", i+1, box, item.Text)
+		}
+	} else {
+		fmt.Printf("Content: %s\n", note.Content)
+	}
+	fmt.Printf("Color: %s\n", h.colorLabel(note.Color))
+	fmt.Printf("Version: %d\n", note.Version)
+	if len(note.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(note.Tags, ", "))
+	}
+	if g := note.Geometry; g != nil {
+		fmt.Printf("Board: %s at %d,%d, %dx%d, z %d\n", g.Board, g.X, g.Y, g.Width, g.Height, g.Z)
+	}
+	if note.DueAt != nil {
+		fmt.Printf("Due: %s\n", formatWhen(*note.DueAt))
+	}
+	if note.RemindAt != nil {
+		if note.RemindedAt != nil {
+			fmt.Printf("Reminder: %s (fired %s)\n", formatWhen(*note.RemindAt), formatWhen(*note.RemindedAt))
+		} else {
+			fmt.Printf("Reminder: %s\n", formatWhen(*note.RemindAt))
+		}
+	}
 	fmt.Printf("Created: %s\n", note.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("Updated: %s\n", note.UpdatedAt.Format("2006-01-02 15:04:05"))
+	if note.DeletedAt != nil {
+		fmt.Printf("Deleted: %s\n", note.DeletedAt.Format("2006-01-02 15:04:05"))
+	}
 	fmt.Println("------------------------")
 }
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind says how a note's body is kept. The zero Kind is a plain text note.
+type Kind string
+
+const (
+	KindText Kind = ""
+	// KindChecklist notes keep a title in Content and their ordered items
+	// in Items.
+	KindChecklist Kind = "checklist"
+)
+
+// MaxItemLength caps the length of a checklist item in bytes.
+const MaxItemLength = 500
+
+// ChecklistItem is one line of a checklist.
+type ChecklistItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done,omitempty"`
+}
+
+// IsChecklist reports whether the note is a checklist.
+func (n *Note) IsChecklist() bool {
+	return n.Kind == KindChecklist
+}
+
+// Progress returns how many of a checklist's items are done, and how many
+// there are.
+func (n *Note) Progress() (done, total int) {
+	for _, item := range n.Items {
+		if item.Done {
+			done++
+		}
+	}
+	return done, len(n.Items)
+}
+
+// Text returns the note as plain text: the content of a text note, or the
+// title of a checklist followed by its items in "- [ ]" syntax.
+func (n *Note) Text() string {
+	if !n.IsChecklist() {
+		return n.Content
+	}
+	return FormatChecklist(n.Content, n.Items)
+}
+
+// SetText replaces the note's body with text as Text returns it. A
+// checklist takes its title and items from text; see ParseChecklist.
+func (n *Note) SetText(text string) {
+	if !n.IsChecklist() {
+		n.Content = text
+		return
+	}
+	n.Content, n.Items = ParseChecklist(text)
+}
+
+// NormalizeItem trims a checklist item's text and checks that it is a
+// single line of at most MaxItemLength bytes.
+func NormalizeItem(text string) (string, error) {
+	item := strings.TrimSpace(text)
+	switch {
+	case item == "":
+		return "", fmt.Errorf("checklist item cannot be empty")
+	case len(item) > MaxItemLength:
+		return "", fmt.Errorf("checklist item is longer than %d characters", MaxItemLength)
+	case strings.ContainsAny(item, "\r\n"):
+		return "", fmt.Errorf("checklist item must be a single line")
+	}
+	return item, nil
+}
+
+// FormatChecklist writes a checklist as its title followed by one
+// "- [ ] item" or "- [x] item" line per item. Title lines that would read
+// back as items, or that start with a backslash, are escaped with a
+// leading backslash.
+func FormatChecklist(title string, items []ChecklistItem) string {
+	var b strings.Builder
+	if title != "" {
+		for i, line := range strings.Split(title, "\n") {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			if strings.HasPrefix(line, `\`) || isItemLine(line) {
+				b.WriteString(`\`)
+			}
+			b.WriteString(line)
+		}
+		b.WriteString("\n")
+	}
+	for _, item := range items {
+		if item.Done {
+			b.WriteString("- [x] ")
+		} else {
+			b.WriteString("- [ ] ")
+		}
+		b.WriteString(item.Text)
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// ParseChecklist reads text written by FormatChecklist or by hand. The
+// lines before the first list line ("- ", "* " or "+ ", with or without a
+// "[ ]" or "[x]" box) are the title, without trailing blank lines; every
+// non-blank line from there on is an item, open unless its box is
+// checked.
+func ParseChecklist(text string) (string, []ChecklistItem) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	first := len(lines)
+	for i, line := range lines {
+		if isItemLine(line) {
+			first = i
+			break
+		}
+	}
+
+	title := lines[:first]
+	for i, line := range title {
+		title[i] = strings.TrimPrefix(line, `\`)
+	}
+	var items []ChecklistItem
+	for _, line := range lines[first:] {
+		if item, ok := parseItem(line); ok {
+			items = append(items, item)
+		}
+	}
+	return strings.TrimRight(strings.Join(title, "\n"), "\n"), items
+}
+
+// isItemLine reports whether a line starts a list item.
+func isItemLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, marker := range []string{"- ", "* ", "+ "} {
+		if strings.HasPrefix(trimmed, marker) {
+			return true
+		}
+	}
+	return trimmed == "-" || trimmed == "*" || trimmed == "+" ||
+		strings.HasPrefix(trimmed, "[ ]") || strings.HasPrefix(strings.ToLower(trimmed), "[x]")
+}
+
+func parseItem(line string) (ChecklistItem, bool) {
+	text := strings.TrimSpace(line)
+	if text == "-" || text == "*" || text == "+" {
+		return ChecklistItem{}, false
+	}
+	for _, marker := range []string{"- ", "* ", "+ "} {
+		if rest, found := strings.CutPrefix(text, marker); found {
+			text = strings.TrimSpace(rest)
+			break
+		}
+	}
+	var item ChecklistItem
+	switch {
+	case strings.HasPrefix(text, "[ ]"):
+		text = text[3:]
+	case strings.HasPrefix(strings.ToLower(text), "[x]"):
+		text, item.Done = text[3:], true
+	}
+	item.Text = strings.TrimSpace(text)
+	return item, item.Text != ""
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultBoard is the board of notes that have not been put on another.
+const DefaultBoard = "main"
+
+// Sizes and positions are in board units, which a UI draws as pixels at
+// 100% zoom.
+const (
+	DefaultNoteWidth  = 200
+	DefaultNoteHeight = 200
+	MinNoteSize       = 40
+	MaxNoteSize       = 4000
+	// MaxCoordinate bounds positions in either direction.
+	MaxCoordinate = 1_000_000
+)
+
+// MaxBoardLength caps the length of a board name in bytes.
+const MaxBoardLength = 64
+
+// Geometry places a note on a board. X grows to the right and Y downwards
+// from the board's top left corner. Where notes overlap, the one with the
+// higher Z is on top.
+type Geometry struct {
+	Board  string `json:"board"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Z      int    `json:"z"`
+}
+
+// NewGeometry returns a note of the default size at the top left corner of
+// a board.
+func NewGeometry(board string) *Geometry {
+	return &Geometry{Board: board, Width: DefaultNoteWidth, Height: DefaultNoteHeight}
+}
+
+// NormalizeBoard lowercases and trims a board name. An empty name is the
+// default board; otherwise the name may hold letters, digits and - _ .
+func NormalizeBoard(name string) (string, error) {
+	board := strings.ToLower(strings.TrimSpace(name))
+	if board == "" {
+		return DefaultBoard, nil
+	}
+	if len(board) > MaxBoardLength {
+		return "", fmt.Errorf("board name %q is longer than %d characters", name, MaxBoardLength)
+	}
+	for _, r := range board {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.", r) {
+			return "", fmt.Errorf("invalid board name %q: use letters, digits and - _ .", name)
+		}
+	}
+	return board, nil
+}
+
+// Validate checks that the board name is normalized and that the note's
+// size and position are in range.
+func (g *Geometry) Validate() error {
+	if board, err := NormalizeBoard(g.Board); err != nil || board != g.Board {
+		return fmt.Errorf("invalid board name %q", g.Board)
+	}
+	if g.Width < MinNoteSize || g.Width > MaxNoteSize || g.Height < MinNoteSize || g.Height > MaxNoteSize {
+		return fmt.Errorf("invalid note size %dx%d: each side must be %d to %d", g.Width, g.Height, MinNoteSize, MaxNoteSize)
+	}
+	if abs(g.X) > MaxCoordinate || abs(g.Y) > MaxCoordinate {
+		return fmt.Errorf("invalid note position %d,%d: coordinates must be within %d of the origin", g.X, g.Y, MaxCoordinate)
+	}
+	return nil
+}
+
+// Clamp brings an invalid geometry into range: an unusable board name
+// becomes the default board, and sizes and coordinates are cut to their
+// limits.
+func (g *Geometry) Clamp() {
+	if board, err := NormalizeBoard(g.Board); err == nil {
+		g.Board = board
+	} else {
+		g.Board = DefaultBoard
+	}
+	g.Width = clamp(g.Width, MinNoteSize, MaxNoteSize)
+	g.Height = clamp(g.Height, MinNoteSize, MaxNoteSize)
+	g.X = clamp(g.X, -MaxCoordinate, MaxCoordinate)
+	g.Y = clamp(g.Y, -MaxCoordinate, MaxCoordinate)
+}
+
+// Rect returns the area the note covers.
+func (g *Geometry) Rect() Rect {
+	return Rect{X: g.X, Y: g.Y, Width: g.Width, Height: g.Height}
+}
+
+// Rect is an area of a board.
+type Rect struct {
+	X, Y, Width, Height int
+}
+
+// Intersect returns the area two rectangles share, and false if they only
+// touch or do not meet at all.
+func (r Rect) Intersect(o Rect) (Rect, bool) {
+	x1, y1 := max(r.X, o.X), max(r.Y, o.Y)
+	x2, y2 := min(r.X+r.Width, o.X+o.Width), min(r.Y+r.Height, o.Y+o.Height)
+	if x2 <= x1 || y2 <= y1 {
+		return Rect{}, false
+	}
+	return Rect{X: x1, Y: y1, Width: x2 - x1, Height: y2 - y1}, true
+}
+
+func (r Rect) Area() int {
+	return r.Width * r.Height
+}
+
+// Board returns the board the note is on. Notes without a geometry are on
+// the default board.
+func (n *Note) Board() string {
+	if n.Geometry == nil {
+		return DefaultBoard
+	}
+	return n.Geometry.Board
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
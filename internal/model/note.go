@@ -1,9 +1,14 @@
 package model
 
-import "time"
+import (
+	"time"
+	"unicode"
+)
 
+// Color names one of the colors of a Palette.
 type Color string
 
+// The colors of the default palette.
 const (
 	Yellow Color = "yellow"
 	Blue   Color = "blue"
@@ -12,10 +17,89 @@ const (
 	Orange Color = "orange"
 )
 
+// maxColorLength caps the length of a color name in bytes.
+const maxColorLength = 32
+
+// Valid reports whether c is a well-formed color name: a lower case letter
+// followed by lower case letters, digits and dashes. Whether a color may be
+// given to a note is up to the store's palette.
+func (c Color) Valid() bool {
+	if c == "" || len(c) > maxColorLength {
+		return false
+	}
+	for i, r := range c {
+		switch {
+		case unicode.IsLetter(r) && !unicode.IsUpper(r):
+		case i > 0 && (unicode.IsDigit(r) || r == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 type Note struct {
-	ID        string    `json:"id"`
-	Content   string    `json:"content"`
-	Color     Color     `json:"color"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID string `json:"id"`
+	// Kind is empty for text notes. The Content of a checklist is its
+	// title.
+	Kind    Kind            `json:"kind,omitempty"`
+	Content string          `json:"content"`
+	Items   []ChecklistItem `json:"items,omitempty"`
+	Color   Color           `json:"color"`
+	// Version counts the changes stored for the note. An update is only
+	// accepted if it was made to the version currently stored.
+	Version int64 `json:"version"`
+	// Tags are normalized, sorted and free of duplicates; see
+	// NormalizeTags.
+	Tags []string `json:"tags,omitempty"`
+	// Geometry places the note on a board. It is nil until the note is
+	// first moved, resized or arranged.
+	Geometry *Geometry `json:"geometry,omitempty"`
+	// DueAt is when the note's task is due, if it has a deadline.
+	DueAt *time.Time `json:"due_at,omitempty"`
+	// RemindAt is when to be reminded of the note. RemindedAt is set once
+	// the reminder has fired; snoozing sets a new RemindAt and clears it.
+	RemindAt   *time.Time `json:"remind_at,omitempty"`
+	RemindedAt *time.Time `json:"reminded_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// DeletedAt is set while the note is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Clone returns a deep copy of the note, or nil for a nil note.
+func (n *Note) Clone() *Note {
+	if n == nil {
+		return nil
+	}
+	clone := *n
+	if n.Tags != nil {
+		clone.Tags = append([]string(nil), n.Tags...)
+	}
+	if n.Items != nil {
+		clone.Items = append([]ChecklistItem(nil), n.Items...)
+	}
+	if n.Geometry != nil {
+		geometry := *n.Geometry
+		clone.Geometry = &geometry
+	}
+	clone.DueAt = cloneTime(n.DueAt)
+	clone.RemindAt = cloneTime(n.RemindAt)
+	clone.RemindedAt = cloneTime(n.RemindedAt)
+	clone.DeletedAt = cloneTime(n.DeletedAt)
+	return &clone
+}
+
+// ReminderPending reports whether the note has a reminder that has not
+// fired yet.
+func (n *Note) ReminderPending() bool {
+	return n.RemindAt != nil && n.RemindedAt == nil
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
 }
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -37,20 +39,26 @@ func TestColorValidation(t *testing.T) {
 			color: Orange,
 			want:  true,
 		},
+		{
+			name:  "Custom Color",
+			color: "dark-red2",
+			want:  true,
+		},
 		{
 			name:  "Invalid Color",
-			color: "purple",
+			color: "Purple!",
+			want:  false,
+		},
+		{
+			name:  "Empty Color",
+			color: "",
 			want:  false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			isValid := false
-			switch tt.color {
-			case Yellow, Blue, Green, Pink, Orange:
-				isValid = true
-			}
+			isValid := tt.color.Valid()
 
 			if isValid != tt.want {
 				t.Errorf("Color validation failed for %s, got: %v, want: %v", tt.color, isValid, tt.want)
@@ -84,3 +92,221 @@ func TestNoteCreation(t *testing.T) {
 		t.Errorf("Expected note updated at to be non-zero, got: %s", note.UpdatedAt)
 	}
 }
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", tags: nil, want: nil},
+		{name: "sorted and deduplicated", tags: []string{"UI", " bug", "#ui"}, want: []string{"bug", "ui"}},
+		{name: "punctuation", tags: []string{"release/1.2", "needs_review", "wip-2"}, want: []string{"needs_review", "release/1.2", "wip-2"}},
+		{name: "empty", tags: []string{"#"}, wantErr: true},
+		{name: "space", tags: []string{"two words"}, wantErr: true},
+		{name: "keyword", tags: []string{"NOT"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.tags)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to normalize tags: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Tags mismatch, got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloneCopiesTags(t *testing.T) {
+	note := &Note{ID: "test-id", Tags: []string{"bug"}, Geometry: NewGeometry("work")}
+	clone := note.Clone()
+	clone.Tags[0] = "changed"
+	clone.Geometry.X = 100
+	if note.Tags[0] != "bug" {
+		t.Errorf("Expected the original tags to be unchanged, got: %v", note.Tags)
+	}
+	if note.Geometry.X != 0 {
+		t.Errorf("Expected the original geometry to be unchanged, got: %+v", note.Geometry)
+	}
+
+	remindAt := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	note.RemindAt = &remindAt
+	clone = note.Clone()
+	*clone.RemindAt = clone.RemindAt.Add(time.Hour)
+	if !note.RemindAt.Equal(remindAt) || !note.ReminderPending() {
+		t.Errorf("Expected the original reminder to be unchanged, got: %v", note.RemindAt)
+	}
+}
+
+func TestPalette(t *testing.T) {
+	palette := DefaultPalette()
+	if err := palette.Validate(); err != nil {
+		t.Fatalf("Expected the default palette to be valid: %v", err)
+	}
+
+	if err := palette.Set(PaletteColor{Name: "red", Hex: "E53", Meaning: " blocker "}); err != nil {
+		t.Fatalf("Failed to add color: %v", err)
+	}
+	red, found := palette.Lookup("red")
+	if !found || red.Hex != "#ee5533" || red.Meaning != "blocker" {
+		t.Errorf("Unexpected color: %+v", red)
+	}
+	if r, g, b := red.RGB(); r != 0xee || g != 0x55 || b != 0x33 {
+		t.Errorf("RGB mismatch, got: %d,%d,%d", r, g, b)
+	}
+	if err := palette.Set(PaletteColor{Name: "red", Hex: "#b71c1c"}); err != nil || len(palette.Colors) != 6 {
+		t.Errorf("Expected the color to be replaced, got: %d colors (%v)", len(palette.Colors), err)
+	}
+	for _, c := range []PaletteColor{{Name: "Red", Hex: "#fff"}, {Name: "red", Hex: "#ggg"}, {Name: "red", Hex: "#ffff"}} {
+		if err := palette.Set(c); err == nil {
+			t.Errorf("Expected %+v to be refused", c)
+		}
+	}
+
+	clone := palette.Clone()
+	clone.Remove(Yellow)
+	if !palette.Has(Yellow) || clone.Has(Yellow) {
+		t.Error("Expected Remove to change only the clone")
+	}
+	if err := clone.Validate(); err == nil {
+		t.Error("Expected a palette without its default to be invalid")
+	}
+}
+
+func TestGeometry(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry Geometry
+		wantErr  bool
+	}{
+		{
+			name:     "Default Size",
+			geometry: *NewGeometry(DefaultBoard),
+		},
+		{
+			name:     "Negative Position",
+			geometry: Geometry{Board: "work", X: -300, Y: -20, Width: MinNoteSize, Height: MaxNoteSize},
+		},
+		{
+			name:     "Too Small",
+			geometry: Geometry{Board: "work", Width: MinNoteSize - 1, Height: 100},
+			wantErr:  true,
+		},
+		{
+			name:     "Too Far",
+			geometry: Geometry{Board: "work", X: MaxCoordinate + 1, Width: 100, Height: 100},
+			wantErr:  true,
+		},
+		{
+			name:     "Unnormalized Board",
+			geometry: Geometry{Board: "Work", Width: 100, Height: 100},
+			wantErr:  true,
+		},
+		{
+			name:     "Empty Board",
+			geometry: Geometry{Width: 100, Height: 100},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.geometry.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			tt.geometry.Clamp()
+			if err := tt.geometry.Validate(); err != nil {
+				t.Errorf("Expected a clamped geometry to be valid, got: %v", err)
+			}
+		})
+	}
+
+	if board, err := NormalizeBoard(" Project.X "); err != nil || board != "project.x" {
+		t.Errorf("Board mismatch, got: %s (%v), want: project.x", board, err)
+	}
+	if _, err := NormalizeBoard("my board"); err == nil {
+		t.Error("Expected a board name with a space to be refused")
+	}
+}
+
+func TestRectIntersect(t *testing.T) {
+	a := Rect{X: 0, Y: 0, Width: 100, Height: 100}
+	tests := []struct {
+		name   string
+		b      Rect
+		want   Rect
+		wantOK bool
+	}{
+		{name: "Overlap", b: Rect{X: 50, Y: 60, Width: 100, Height: 100}, want: Rect{X: 50, Y: 60, Width: 50, Height: 40}, wantOK: true},
+		{name: "Inside", b: Rect{X: 10, Y: 10, Width: 20, Height: 20}, want: Rect{X: 10, Y: 10, Width: 20, Height: 20}, wantOK: true},
+		{name: "Touching", b: Rect{X: 100, Y: 0, Width: 100, Height: 100}},
+		{name: "Apart", b: Rect{X: -300, Y: 0, Width: 100, Height: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := a.Intersect(tt.b)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Intersect mismatch, got: %+v %v, want: %+v %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestChecklistText(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		items []ChecklistItem
+		want  string
+	}{
+		{name: "Title And Items", title: "Groceries", items: []ChecklistItem{{Text: "milk", Done: true}, {Text: "eggs"}}, want: "Groceries\n- [x] milk\n- [ ] eggs"},
+		{name: "No Title", items: []ChecklistItem{{Text: "one"}}, want: "- [ ] one"},
+		{name: "No Items", title: "Empty list", want: "Empty list"},
+		{name: "Title Like Items", title: "Plan\n- not an item\n\\escaped", items: []ChecklistItem{{Text: "[ ] boxed"}}, want: "Plan\n\\- not an item\n\\\\escaped\n- [ ] [ ] boxed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note := &Note{Kind: KindChecklist, Content: tt.title, Items: tt.items}
+			if got := note.Text(); got != tt.want {
+				t.Errorf("Text mismatch, got: %q, want: %q", got, tt.want)
+			}
+			parsed := &Note{Kind: KindChecklist}
+			parsed.SetText(note.Text())
+			if parsed.Content != tt.title || fmt.Sprint(parsed.Items) != fmt.Sprint(tt.items) {
+				t.Errorf("Round trip mismatch, got: %q %v, want: %q %v", parsed.Content, parsed.Items, tt.title, tt.items)
+			}
+		})
+	}
+}
+
+func TestParseChecklist(t *testing.T) {
+	title, items := ParseChecklist("Weekend\n\n* [X] mow the lawn\n+ call mum\n-\n  - [ ]  fix bike \nwash car\n")
+	want := []ChecklistItem{{Text: "mow the lawn", Done: true}, {Text: "call mum"}, {Text: "fix bike"}, {Text: "wash car"}}
+	if title != "Weekend" {
+		t.Errorf("Title mismatch, got: %q, want: %q", title, "Weekend")
+	}
+	if fmt.Sprint(items) != fmt.Sprint(want) {
+		t.Errorf("Items mismatch, got: %v, want: %v", items, want)
+	}
+
+	note := &Note{Kind: KindChecklist, Items: items}
+	if done, total := note.Progress(); done != 1 || total != 4 {
+		t.Errorf("Progress mismatch, got: %d/%d, want: 1/4", done, total)
+	}
+	if _, err := NormalizeItem("two\nlines"); err == nil {
+		t.Error("Expected a multi-line item to be refused")
+	}
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Palette is the set of colors notes can be given. Notes keep their color
+// when it is taken out of the palette; only new colors have to be in it.
+type Palette struct {
+	Colors []PaletteColor `json:"colors"`
+	// Default is the color of notes created without choosing one.
+	Default Color `json:"default"`
+}
+
+// PaletteColor is a named color in a palette.
+type PaletteColor struct {
+	Name Color `json:"name"`
+	// Hex is the color as #rrggbb.
+	Hex string `json:"hex"`
+	// Meaning optionally says what the color stands for, like "blocker".
+	Meaning string `json:"meaning,omitempty"`
+}
+
+// DefaultPalette returns the palette of stores that have not defined their
+// own: the five classic sticky note colors, yellow first.
+func DefaultPalette() *Palette {
+	return &Palette{
+		Colors: []PaletteColor{
+			{Name: Yellow, Hex: "#fff176"},
+			{Name: Blue, Hex: "#90caf9"},
+			{Name: Green, Hex: "#a5d6a7"},
+			{Name: Pink, Hex: "#f48fb1"},
+			{Name: Orange, Hex: "#ffcc80"},
+		},
+		Default: Yellow,
+	}
+}
+
+// Validate checks that every color is well formed and named once, and that
+// the default is one of them.
+func (p *Palette) Validate() error {
+	if len(p.Colors) == 0 {
+		return fmt.Errorf("palette has no colors")
+	}
+	seen := make(map[Color]bool, len(p.Colors))
+	for _, c := range p.Colors {
+		if !c.Name.Valid() {
+			return fmt.Errorf("invalid color name %q", c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("color %s is in the palette twice", c.Name)
+		}
+		seen[c.Name] = true
+		if _, err := ParseHex(c.Hex); err != nil {
+			return fmt.Errorf("color %s: %w", c.Name, err)
+		}
+	}
+	if !seen[p.Default] {
+		return fmt.Errorf("default color %q is not in the palette", p.Default)
+	}
+	return nil
+}
+
+// Lookup returns the palette entry for a color.
+func (p *Palette) Lookup(name Color) (PaletteColor, bool) {
+	for _, c := range p.Colors {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return PaletteColor{}, false
+}
+
+// Has reports whether a color is in the palette.
+func (p *Palette) Has(name Color) bool {
+	_, found := p.Lookup(name)
+	return found
+}
+
+// Set adds a color to the end of the palette, or replaces the color of the
+// same name where it is.
+func (p *Palette) Set(c PaletteColor) error {
+	if !c.Name.Valid() {
+		return fmt.Errorf("invalid color name %q: use lower case letters, digits and -", c.Name)
+	}
+	hex, err := ParseHex(c.Hex)
+	if err != nil {
+		return err
+	}
+	c.Hex = hex
+	c.Meaning = strings.TrimSpace(c.Meaning)
+	for i := range p.Colors {
+		if p.Colors[i].Name == c.Name {
+			p.Colors[i] = c
+			return nil
+		}
+	}
+	p.Colors = append(p.Colors, c)
+	return nil
+}
+
+// Remove takes a color out of the palette.
+func (p *Palette) Remove(name Color) {
+	for i, c := range p.Colors {
+		if c.Name == name {
+			p.Colors = append(p.Colors[:i:i], p.Colors[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clone returns a copy of the palette that can be changed independently.
+func (p *Palette) Clone() *Palette {
+	clone := *p
+	clone.Colors = append([]PaletteColor(nil), p.Colors...)
+	return &clone
+}
+
+// RGB returns the red, green and blue components of the color.
+func (c PaletteColor) RGB() (uint8, uint8, uint8) {
+	hex, err := ParseHex(c.Hex)
+	if err != nil {
+		return 0, 0, 0
+	}
+	v, _ := strconv.ParseUint(hex[1:], 16, 32)
+	return uint8(v >> 16), uint8(v >> 8), uint8(v)
+}
+
+// ParseHex reads a color written as #rrggbb or #rgb, with or without the
+// #, and returns it as lower case #rrggbb.
+func ParseHex(s string) (string, error) {
+	digits := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "#"))
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	if len(digits) != 6 {
+		return "", fmt.Errorf("invalid hex color %q: use #rrggbb", s)
+	}
+	if _, err := strconv.ParseUint(digits, 16, 32); err != nil {
+		return "", fmt.Errorf("invalid hex color %q: use #rrggbb", s)
+	}
+	return "#" + digits, nil
+}
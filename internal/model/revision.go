@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Revision is a past version of a note. Number counts up from 1 for each
+// note; CreatedAt is when that version was written.
+type Revision struct {
+	NoteID    string    `json:"note_id"`
+	Number    int       `json:"number"`
+	Content   string    `json:"content"`
+	Color     Color     `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+}
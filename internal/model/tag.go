@@ -0,0 +1,69 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MaxTagLength caps the length of a tag in bytes.
+const MaxTagLength = 64
+
+// reservedTags are the words of the tag query syntax, which cannot be used
+// as tags.
+var reservedTags = map[string]bool{"and": true, "or": true, "not": true}
+
+// NormalizeTag returns a tag the way notes store it: lower case, without a
+// leading #. Tags are single words of letters, digits and - _ / . so that
+// they can be written in queries without quoting.
+func NormalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if normalized == "" {
+		return "", fmt.Errorf("tag cannot be empty")
+	}
+	if len(normalized) > MaxTagLength {
+		return "", fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+	}
+	for _, r := range normalized {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_/.", r) {
+			return "", fmt.Errorf("invalid tag %q: use letters, digits and - _ / . only", tag)
+		}
+	}
+	if reservedTags[normalized] {
+		return "", fmt.Errorf("invalid tag %q: it is a query keyword", tag)
+	}
+	return normalized, nil
+}
+
+// NormalizeTags normalizes every tag and returns them sorted without
+// duplicates, or nil if there are none.
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		t, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[t] {
+			seen[t] = true
+			normalized = append(normalized, t)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// HasTag reports whether the note carries tag, which must be normalized.
+func (n *Note) HasTag(tag string) bool {
+	for _, t := range n.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCommandTimeout is how long a CommandNotifier waits for its
+// command when Timeout is zero.
+const DefaultCommandTimeout = 30 * time.Second
+
+// TerminalNotifier rings the terminal bell, prints a message or both.
+type TerminalNotifier struct {
+	Out     io.Writer
+	Bell    bool
+	Message bool
+
+	mutex sync.Mutex
+}
+
+func (n *TerminalNotifier) Notify(r Reminder) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	var buf bytes.Buffer
+	if n.Bell {
+		buf.WriteString("\a")
+	}
+	if n.Message {
+		fmt.Fprintf(&buf, "\n%s\n", describe(r))
+	}
+	_, err := n.Out.Write(buf.Bytes())
+	return err
+}
+
+// CommandNotifier runs a command for each reminder with the note as a line
+// of JSON on its standard input. The environment also holds STICKY_NOTES_NOTE_ID,
+// STICKY_NOTES_REMIND_AT (RFC 3339) and STICKY_NOTES_REMINDER_MISSED
+// ("true" or "false").
+type CommandNotifier struct {
+	Path string
+	Args []string
+	// Timeout stops a command that runs too long; zero means
+	// DefaultCommandTimeout.
+	Timeout time.Duration
+}
+
+func (n *CommandNotifier) Notify(r Reminder) error {
+	input, err := json.Marshal(r.Note)
+	if err != nil {
+		return fmt.Errorf("failed to encode note: %w", err)
+	}
+	timeout := n.Timeout
+	if timeout == 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.Path, n.Args...)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	// Children the command leaves behind may hold its output open; stop
+	// waiting for them soon after the command itself is gone.
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"STICKY_NOTES_NOTE_ID="+r.Note.ID,
+		"STICKY_NOTES_REMIND_AT="+r.At.Format(time.RFC3339),
+		fmt.Sprintf("STICKY_NOTES_REMINDER_MISSED=%t", r.Missed),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if text := strings.TrimSpace(string(output)); text != "" {
+			return fmt.Errorf("failed to run %s: %w: %s", n.Path, err, text)
+		}
+		return fmt.Errorf("failed to run %s: %w", n.Path, err)
+	}
+	return nil
+}
+
+// LogNotifier appends a line for each reminder to a file.
+type LogNotifier struct {
+	Path string
+
+	mutex sync.Mutex
+}
+
+func (n *LogNotifier) Notify(r Reminder) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	file, err := os.OpenFile(n.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open reminder log: %w", err)
+	}
+	line := fmt.Sprintf("%s note=%s remind_at=%s missed=%t %q\n",
+		r.FiredAt.Format(time.RFC3339), r.Note.ID, r.At.Format(time.RFC3339), r.Missed, firstLine(r.Note.Text()))
+	if _, err := file.WriteString(line); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write reminder log: %w", err)
+	}
+	return file.Close()
+}
+
+// ParseNotifiers reads a comma-separated list of notifiers:
+//
+//	bell             ring the terminal bell
+//	message          print the reminder to out
+//	command:PATH ARG run a command; arguments are separated by spaces
+//	log:PATH         append to a log file
+//
+// An empty spec means "bell,message" and "none" turns reminders off.
+func ParseNotifiers(spec string, out io.Writer) ([]Notifier, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "":
+		spec = "bell,message"
+	case "none":
+		return nil, nil
+	}
+
+	var notifiers []Notifier
+	var terminal *TerminalNotifier
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		name, value, _ := strings.Cut(item, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "bell", "message":
+			if terminal == nil {
+				terminal = &TerminalNotifier{Out: out}
+				notifiers = append(notifiers, terminal)
+			}
+			if name == "bell" {
+				terminal.Bell = true
+			} else {
+				terminal.Message = true
+			}
+		case "command":
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("notifier %q has no command", item)
+			}
+			notifiers = append(notifiers, &CommandNotifier{Path: fields[0], Args: fields[1:]})
+		case "log":
+			path := strings.TrimSpace(value)
+			if path == "" {
+				return nil, fmt.Errorf("notifier %q has no file", item)
+			}
+			notifiers = append(notifiers, &LogNotifier{Path: path})
+		default:
+			return nil, fmt.Errorf("unknown notifier %q (use bell, message, command:PATH or log:PATH)", item)
+		}
+	}
+	return notifiers, nil
+}
+
+// describe says what a reminder is about in one line.
+func describe(r Reminder) string {
+	text := firstLine(r.Note.Text())
+	if text == "" {
+		text = "(empty note)"
+	}
+	if r.Missed {
+		return fmt.Sprintf("Missed reminder (due %s): %s [%s]", r.At.Local().Format("2006-01-02 15:04"), text, r.Note.ID)
+	}
+	return fmt.Sprintf("Reminder: %s [%s]", text, r.Note.ID)
+}
+
+func firstLine(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	return line
+}
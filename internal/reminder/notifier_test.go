@@ -0,0 +1,159 @@
+package reminder
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func testReminder(missed bool) Reminder {
+	at := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	return Reminder{
+		Note:    &model.Note{ID: "n1", Content: "Call the bank\nabout the card", Color: model.Yellow},
+		At:      at,
+		FiredAt: at.Add(time.Second),
+		Missed:  missed,
+	}
+}
+
+func TestParseNotifiers(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "", want: []string{"terminal bell message"}},
+		{spec: "none", want: nil},
+		{spec: "Message", want: []string{"terminal message"}},
+		{spec: "bell, log:/tmp/reminders.log", want: []string{"terminal bell", "log /tmp/reminders.log"}},
+		{spec: "command:notify-send -u critical,message", want: []string{"command notify-send -u critical", "terminal message"}},
+		{spec: "command:", wantErr: true},
+		{spec: "log:", wantErr: true},
+		{spec: "email", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		notifiers, err := ParseNotifiers(tt.spec, os.Stdout)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for %q", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.spec, err)
+			continue
+		}
+		var got []string
+		for _, notifier := range notifiers {
+			switch n := notifier.(type) {
+			case *TerminalNotifier:
+				name := "terminal"
+				if n.Bell {
+					name += " bell"
+				}
+				if n.Message {
+					name += " message"
+				}
+				got = append(got, name)
+			case *CommandNotifier:
+				got = append(got, strings.Join(append([]string{"command", n.Path}, n.Args...), " "))
+			case *LogNotifier:
+				got = append(got, "log "+n.Path)
+			}
+		}
+		if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+			t.Errorf("Notifiers mismatch for %q, got: %v, want: %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestTerminalNotifier(t *testing.T) {
+	var out bytes.Buffer
+	notifier := &TerminalNotifier{Out: &out, Bell: true, Message: true}
+	if err := notifier.Notify(testReminder(false)); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if got, want := out.String(), "\a\nReminder: Call the bank [n1]\n"; got != want {
+		t.Errorf("Output mismatch, got: %q, want: %q", got, want)
+	}
+
+	out.Reset()
+	notifier.Bell = false
+	if err := notifier.Notify(testReminder(true)); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "\nMissed reminder (due ") {
+		t.Errorf("Expected a missed reminder, got: %q", out.String())
+	}
+}
+
+func TestLogNotifier(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sticky-notes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	notifier := &LogNotifier{Path: filepath.Join(tempDir, "reminders.log")}
+	for _, missed := range []bool{false, true} {
+		if err := notifier.Notify(testReminder(missed)); err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+	}
+	data, err := os.ReadFile(notifier.Path)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := `2024-05-01T09:00:01Z note=n1 remind_at=2024-05-01T09:00:00Z missed=false "Call the bank"`
+	if len(lines) != 2 || lines[0] != want || !strings.Contains(lines[1], "missed=true") {
+		t.Errorf("Log mismatch, got: %q", lines)
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to run commands with")
+	}
+	tempDir, err := os.MkdirTemp("", "sticky-notes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	out := filepath.Join(tempDir, "note.json")
+	notifier := &CommandNotifier{Path: sh, Args: []string{"-c", `cat > "$0"; echo "$STICKY_NOTES_NOTE_ID $STICKY_NOTES_REMINDER_MISSED" >> "$0"`, out}}
+	if err := notifier.Notify(testReminder(true)); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read command output: %v", err)
+	}
+	input, env, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	var note model.Note
+	if err := json.Unmarshal([]byte(input), &note); err != nil || note.ID != "n1" || note.Content != "Call the bank\nabout the card" {
+		t.Errorf("Unexpected note on stdin: %s (%v)", input, err)
+	}
+	if env != "n1 true" {
+		t.Errorf("Environment mismatch, got: %s, want: n1 true", env)
+	}
+
+	failing := &CommandNotifier{Path: sh, Args: []string{"-c", "echo broken >&2; exit 3"}}
+	if err := failing.Notify(testReminder(false)); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected the command's error output, got: %v", err)
+	}
+	slow := &CommandNotifier{Path: sh, Args: []string{"-c", "sleep 5"}, Timeout: 50 * time.Millisecond}
+	if err := slow.Notify(testReminder(false)); err == nil {
+		t.Error("Expected a command that runs too long to fail")
+	}
+}
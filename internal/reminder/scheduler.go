@@ -0,0 +1,207 @@
+// Package reminder fires note reminders when they are due.
+//
+// A Scheduler runs in the background of the application. It claims each
+// due reminder in the note store before passing it to its notifiers, so a
+// reminder fires once even when several instances share a store. Reminders
+// that came due while no instance was running fire as soon as one starts.
+package reminder
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// DefaultPoll is how often a Scheduler looks at the store when Options
+// leaves Poll at zero.
+const DefaultPoll = time.Minute
+
+// Reminder is a note whose reminder fired.
+type Reminder struct {
+	// Note is the note as stored after the reminder was claimed.
+	Note *model.Note
+	// At is when the reminder was due and FiredAt when it fired.
+	At      time.Time
+	FiredAt time.Time
+	// Missed is set when the reminder fired later than the scheduler polls,
+	// which means no instance was running when it was due.
+	Missed bool
+}
+
+// Source is where a Scheduler finds reminders; *service.NoteService is
+// one.
+type Source interface {
+	// PendingReminders returns the notes whose reminder has not fired.
+	PendingReminders() ([]*model.Note, error)
+	// MarkReminded claims a note's reminder. It fails with a
+	// *repository.ConflictError if the note changed since it was read.
+	MarkReminded(note *model.Note, at time.Time) (*model.Note, error)
+	// Events returns the bus note changes are published on.
+	Events() *events.Bus
+}
+
+// Notifier tells the user about a reminder.
+type Notifier interface {
+	Notify(r Reminder) error
+}
+
+// Options configures a Scheduler.
+type Options struct {
+	// Poll is the longest the scheduler waits before looking at the store
+	// again, which bounds how late it notices reminders set by other
+	// processes. Reminders set through the source fire on time.
+	Poll time.Duration
+	// OnError is called with errors reading the store, claiming reminders
+	// or notifying. Nil ignores them.
+	OnError func(error)
+}
+
+// Scheduler fires reminders in the background until it is closed.
+type Scheduler struct {
+	source    Source
+	notifiers []Notifier
+	opts      Options
+	sub       *events.Subscription
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Start fires the reminders that are already due, including ones missed
+// while the application was closed, and keeps firing reminders as they
+// come due until the scheduler is closed.
+func Start(source Source, notifiers []Notifier, opts Options) (*Scheduler, error) {
+	if opts.Poll < 0 {
+		return nil, fmt.Errorf("invalid poll interval %s", opts.Poll)
+	}
+	if opts.Poll == 0 {
+		opts.Poll = DefaultPoll
+	}
+	sub, err := source.Events().Subscribe(events.SubscribeOptions{
+		Kinds: []events.Kind{events.Created, events.Updated, events.Restored},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to note events: %w", err)
+	}
+
+	s := &Scheduler{
+		source:    source,
+		notifiers: notifiers,
+		opts:      opts,
+		sub:       sub,
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.watch()
+	go s.run()
+	return s, nil
+}
+
+// Wake makes the scheduler look at the store now instead of when it next
+// expects a reminder.
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the scheduler and waits for a reminder being fired to
+// finish.
+func (s *Scheduler) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		s.sub.Close()
+	})
+	<-s.done
+}
+
+// watch wakes the scheduler whenever a note gets a reminder that has not
+// fired, which may be due before the one it is waiting for.
+func (s *Scheduler) watch() {
+	for e := range s.sub.Events() {
+		if e.After != nil && e.After.ReminderPending() {
+			s.Wake()
+		}
+	}
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		next := s.fireDue()
+		timer.Reset(time.Until(next))
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// fireDue fires every pending reminder that is due and returns when to
+// look again: when the next reminder is due, or after Poll at the latest.
+func (s *Scheduler) fireDue() time.Time {
+	now := time.Now()
+	next := now.Add(s.opts.Poll)
+	notes, err := s.source.PendingReminders()
+	if err != nil {
+		s.report(fmt.Errorf("failed to list reminders: %w", err))
+		return next
+	}
+	for _, note := range notes {
+		select {
+		case <-s.stop:
+			return next
+		default:
+		}
+		if note.RemindAt.After(now) {
+			if note.RemindAt.Before(next) {
+				next = *note.RemindAt
+			}
+			continue
+		}
+		s.fire(note)
+	}
+	return next
+}
+
+// fire claims a due reminder and passes it to every notifier. A reminder
+// that another instance claimed first is left to it; one that fails to be
+// claimed because the note was just edited is tried again on the next
+// look.
+func (s *Scheduler) fire(note *model.Note) {
+	at, firedAt := *note.RemindAt, time.Now()
+	claimed, err := s.source.MarkReminded(note, firedAt)
+	if err != nil {
+		var conflict *repository.ConflictError
+		if !errors.As(err, &conflict) {
+			s.report(fmt.Errorf("failed to claim reminder of note %s: %w", note.ID, err))
+		}
+		return
+	}
+
+	r := Reminder{Note: claimed, At: at, FiredAt: firedAt, Missed: firedAt.Sub(at) > s.opts.Poll}
+	for _, notifier := range s.notifiers {
+		if err := notifier.Notify(r); err != nil {
+			s.report(fmt.Errorf("failed to notify reminder of note %s: %w", note.ID, err))
+		}
+	}
+}
+
+func (s *Scheduler) report(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
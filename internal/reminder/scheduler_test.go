@@ -0,0 +1,165 @@
+package reminder
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+	"github.com/bllexe/sticky-notes/internal/service"
+)
+
+// recordingNotifier passes every reminder it is given to a channel.
+type recordingNotifier struct {
+	reminders chan Reminder
+	err       error
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{reminders: make(chan Reminder, 16)}
+}
+
+func (n *recordingNotifier) Notify(r Reminder) error {
+	n.reminders <- r
+	return n.err
+}
+
+// next waits for the next reminder, failing the test if none fires.
+func (n *recordingNotifier) next(t *testing.T) Reminder {
+	t.Helper()
+	select {
+	case r := <-n.reminders:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a reminder to fire")
+		return Reminder{}
+	}
+}
+
+// none checks that no reminder fires for a while.
+func (n *recordingNotifier) none(t *testing.T) {
+	t.Helper()
+	select {
+	case r := <-n.reminders:
+		t.Errorf("Unexpected reminder of note %s", r.Note.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func createWithReminder(t *testing.T, notes *service.NoteService, content string, at time.Time) *model.Note {
+	t.Helper()
+	note, err := notes.CreateNote(content, model.Yellow)
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	if note, err = notes.SetReminder(note.ID, &at); err != nil {
+		t.Fatalf("Failed to set reminder: %v", err)
+	}
+	return note
+}
+
+func TestSchedulerCatchesUp(t *testing.T) {
+	notes := service.NewNoteService(repository.NewMemoryRepository())
+	now := time.Now()
+	missed := createWithReminder(t, notes, "missed", now.Add(-time.Hour))
+	soon := createWithReminder(t, notes, "soon", now.Add(50*time.Millisecond))
+	createWithReminder(t, notes, "later", now.Add(time.Hour))
+
+	notifier := newRecordingNotifier()
+	scheduler, err := Start(notes, []Notifier{notifier}, Options{Poll: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to start scheduler: %v", err)
+	}
+	first := notifier.next(t)
+	if first.Note.ID != missed.ID || !first.Missed || first.Note.RemindedAt == nil {
+		t.Errorf("Expected the missed reminder first, got: %+v", first)
+	}
+	second := notifier.next(t)
+	if second.Note.ID != soon.ID || second.Missed || second.FiredAt.Before(*soon.RemindAt) {
+		t.Errorf("Expected the next reminder on time, got: %+v", second)
+	}
+	notifier.none(t)
+	scheduler.Close()
+
+	// A restarted scheduler does not fire the same reminders again.
+	notifier = newRecordingNotifier()
+	scheduler, err = Start(notes, []Notifier{notifier}, Options{Poll: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to start scheduler: %v", err)
+	}
+	defer scheduler.Close()
+	notifier.none(t)
+
+	// Snoozing arms a fired reminder again, and the scheduler notices
+	// without waiting for its poll.
+	if _, err := notes.SnoozeReminder(soon.ID, 20*time.Millisecond); err != nil {
+		t.Fatalf("Failed to snooze reminder: %v", err)
+	}
+	if r := notifier.next(t); r.Note.ID != soon.ID {
+		t.Errorf("Expected the snoozed reminder, got: %+v", r)
+	}
+	if _, err := notes.DismissReminder(missed.ID); err != nil {
+		t.Fatalf("Failed to dismiss reminder: %v", err)
+	}
+	notifier.none(t)
+}
+
+func TestSchedulerFiresOnce(t *testing.T) {
+	notes := service.NewNoteService(repository.NewMemoryRepository())
+	for _, content := range []string{"a", "b", "c", "d"} {
+		createWithReminder(t, notes, content, time.Now().Add(-time.Minute))
+	}
+
+	// Two instances sharing a store fire each reminder once between them.
+	notifier := newRecordingNotifier()
+	for range 2 {
+		scheduler, err := Start(notes, []Notifier{notifier}, Options{})
+		if err != nil {
+			t.Fatalf("Failed to start scheduler: %v", err)
+		}
+		defer scheduler.Close()
+	}
+	fired := make(map[string]bool)
+	for range 4 {
+		r := notifier.next(t)
+		if fired[r.Note.ID] {
+			t.Errorf("Reminder of note %s fired twice", r.Note.ID)
+		}
+		fired[r.Note.ID] = true
+	}
+	notifier.none(t)
+}
+
+func TestSchedulerReportsErrors(t *testing.T) {
+	notes := service.NewNoteService(repository.NewMemoryRepository())
+	note := createWithReminder(t, notes, "a", time.Now())
+
+	notifier := newRecordingNotifier()
+	notifier.err = errors.New("no terminal")
+	errs := make(chan error, 1)
+	scheduler, err := Start(notes, []Notifier{notifier}, Options{OnError: func(err error) { errs <- err }})
+	if err != nil {
+		t.Fatalf("Failed to start scheduler: %v", err)
+	}
+	defer scheduler.Close()
+
+	notifier.next(t)
+	select {
+	case err := <-errs:
+		if !errors.Is(err, notifier.err) {
+			t.Errorf("Error mismatch, got: %v, want: %v", err, notifier.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the notifier error to be reported")
+	}
+	// A reminder is claimed before it is passed on, so a failed
+	// notification is not retried.
+	if stored, _ := notes.GetNote(note.ID); stored.ReminderPending() {
+		t.Error("Expected the reminder to be marked as fired")
+	}
+
+	if _, err := Start(notes, nil, Options{Poll: -time.Second}); err == nil {
+		t.Error("Expected a negative poll interval to be refused")
+	}
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// ConflictError is returned by Update when the note was changed after the
+// version being written was read, so storing it would silently discard
+// that change.
+type ConflictError struct {
+	NoteID string
+	// Version is the version the rejected update was made to.
+	Version int64
+	// Current is the note as it is stored now.
+	Current *model.Note
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("note %s was changed by someone else: it is at version %d, the update was made to version %d",
+		e.NoteID, e.Current.Version, e.Version)
+}
+
+// nextVersion checks an update against the stored note and returns the
+// version to store it with.
+func nextVersion(current, note *model.Note) (int64, error) {
+	if current.Version != note.Version {
+		return 0, &ConflictError{NoteID: note.ID, Version: note.Version, Current: cloneNote(current)}
+	}
+	return current.Version + 1, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestUpdateConflicts(t *testing.T) {
+	fileRepo, fileDir := setupTestRepo(t)
+	defer cleanupTestRepo(fileDir)
+	logRepo, logDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(logDir)
+	mdRepo, mdDir := setupMarkdownRepo(t)
+	defer cleanupTestRepo(mdDir)
+	defer mdRepo.Close()
+
+	tests := []struct {
+		name string
+		repo NoteRepository
+	}{
+		{name: "file", repo: fileRepo},
+		{name: "jsonl", repo: logRepo},
+		{name: "markdown", repo: mdRepo},
+		{name: "memory", repo: NewMemoryRepository()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note := createTestNote()
+			note.Version = 1
+			if err := tt.repo.Save(note); err != nil {
+				t.Fatalf("Failed to save note: %v", err)
+			}
+			mine, _ := tt.repo.GetById(note.ID)
+			theirs, _ := tt.repo.GetById(note.ID)
+
+			theirs.Content = "theirs"
+			if err := tt.repo.Update(theirs); err != nil {
+				t.Fatalf("Failed to update note: %v", err)
+			}
+			if theirs.Version != 2 {
+				t.Errorf("Version mismatch, got: %d, want: 2", theirs.Version)
+			}
+
+			mine.Content = "mine"
+			err := tt.repo.Update(mine)
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("Expected a conflict, got: %v", err)
+			}
+			if conflict.Version != 1 || conflict.Current.Version != 2 || conflict.Current.Content != "theirs" {
+				t.Errorf("Unexpected conflict: %+v (current %+v)", conflict, conflict.Current)
+			}
+			if mine.Version != 1 {
+				t.Errorf("Expected a rejected note to keep its version, got: %d", mine.Version)
+			}
+
+			mine.Version = conflict.Current.Version
+			if err := tt.repo.Update(mine); err != nil {
+				t.Fatalf("Failed to overwrite note: %v", err)
+			}
+			if stored, _ := tt.repo.GetById(note.ID); stored.Content != "mine" || stored.Version != 3 {
+				t.Errorf("Unexpected stored note: %+v", stored)
+			}
+
+			txRepo, ok := tt.repo.(TxRepository)
+			if !ok {
+				return
+			}
+			tx, _ := txRepo.Begin()
+			stale := &model.Note{ID: note.ID, Content: "stale", Color: model.Blue, Version: 2}
+			tx.Update(stale)
+			if err := tx.Commit(); !errors.As(err, &conflict) {
+				t.Errorf("Expected a conflict from the transaction, got: %v", err)
+			}
+			tx, _ = txRepo.Begin()
+			fresh := &model.Note{ID: note.ID, Content: "fresh", Color: model.Blue, Version: 3}
+			tx.Update(fresh)
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Failed to commit: %v", err)
+			}
+			if fresh.Version != 4 {
+				t.Errorf("Version mismatch after commit, got: %d, want: 4", fresh.Version)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+type IssueKind string
+
+const (
+	IssueUndecodable   IssueKind = "undecodable"
+	IssueIDMismatch    IssueKind = "id-mismatch"
+	IssueInvalidColor  IssueKind = "invalid-color"
+	IssueBadTimestamps IssueKind = "bad-timestamps"
+	IssueBadGeometry   IssueKind = "bad-geometry"
+	IssueStrayFile     IssueKind = "stray-file"
+	IssueMisplaced     IssueKind = "misplaced"
+)
+
+// Issue is a problem found in the data directory.
+type Issue struct {
+	Kind IssueKind
+	// Path is relative to the data directory.
+	Path    string
+	NoteID  string
+	Message string
+	// Repairable is set when Repair can fix the file in place. Every issue
+	// can be quarantined.
+	Repairable bool
+}
+
+type CheckReport struct {
+	Scanned int
+	Issues  []Issue
+}
+
+// HealthReporter is implemented by backends that skip unreadable data when
+// listing notes, so callers can tell users about it.
+type HealthReporter interface {
+	// Warnings describes what the last listing had to skip.
+	Warnings() []string
+}
+
+// internalFiles are the bookkeeping files the repository itself keeps in
+// the data directory.
+var internalFiles = map[string]bool{
+	lockFile:     true,
+	keystoreFile: true,
+	journalFile:  true,
+	manifestFile: true,
+	paletteFile:  true,
+}
+
+// Check walks the data directory and reports every file that is damaged,
+// inconsistent or does not belong there. It does not change anything.
+func (r *FileRepository) Check() (*CheckReport, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	report := &CheckReport{}
+	files, err := os.ReadDir(r.dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	for _, file := range files {
+		name := file.Name()
+		switch {
+		case file.IsDir() && (name == trashDir || name == revisionsDir):
+			if err := r.checkDir(report, name); err != nil {
+				return nil, err
+			}
+		case file.IsDir() && (name == quarantineDir || name == restoreDir):
+		case internalFiles[name]:
+		default:
+			if err := r.checkEntry(report, "", "", file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return report, nil
+}
+
+func (r *FileRepository) checkDir(report *CheckReport, dir string) error {
+	files, err := os.ReadDir(filepath.Join(r.dataDir, dir))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, file := range files {
+		if err := r.checkEntry(report, dir, "", file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEntry checks one entry of a note directory (dir is "", trashDir or
+// revisionsDir), or of one of its shards when shard is set.
+func (r *FileRepository) checkEntry(report *CheckReport, dir, shard string, file os.DirEntry) error {
+	rel := filepath.Join(dir, shard, file.Name())
+	sharded := r.layout() == LayoutSharded
+	id := strings.TrimSuffix(file.Name(), noteExt)
+
+	switch {
+	case shard == "" && isShardDir(file):
+		// Shards are looked into in a flat store too, to find notes left
+		// behind by a layout change.
+		files, err := os.ReadDir(filepath.Join(r.dataDir, rel))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		for _, inner := range files {
+			if err := r.checkEntry(report, dir, file.Name(), inner); err != nil {
+				return err
+			}
+		}
+	case !isNoteFile(file):
+		report.Issues = append(report.Issues, strayIssue(rel, file.IsDir()))
+	case sharded != (shard != "") || (sharded && shardOf(id) != shard):
+		want, _ := filepath.Rel(r.dataDir, r.pathIn(r.layout(), dir, id))
+		report.Issues = append(report.Issues, Issue{
+			Kind:       IssueMisplaced,
+			Path:       rel,
+			NoteID:     id,
+			Message:    fmt.Sprintf("file belongs in %s in the %s layout", want, r.layout()),
+			Repairable: true,
+		})
+	case dir == revisionsDir:
+		report.Scanned++
+		if _, err := r.readRevisions(id); err != nil {
+			report.Issues = append(report.Issues, Issue{
+				Kind:    IssueUndecodable,
+				Path:    rel,
+				Message: err.Error(),
+			})
+		}
+	default:
+		r.checkNote(report, rel)
+	}
+	return nil
+}
+
+func (r *FileRepository) checkNote(report *CheckReport, rel string) {
+	report.Scanned++
+	id := strings.TrimSuffix(filepath.Base(rel), noteExt)
+
+	note, err := r.readNote(filepath.Join(r.dataDir, rel))
+	if err != nil {
+		if errors.Is(err, ErrLocked) || errors.Is(err, ErrUnsupportedSchema) {
+			return
+		}
+		report.Issues = append(report.Issues, Issue{
+			Kind:    IssueUndecodable,
+			Path:    rel,
+			NoteID:  id,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	for _, kind := range noteProblems(note, id) {
+		report.Issues = append(report.Issues, Issue{
+			Kind:       kind,
+			Path:       rel,
+			NoteID:     id,
+			Message:    problemMessage(kind, note, rel),
+			Repairable: true,
+		})
+	}
+}
+
+func problemMessage(kind IssueKind, note *model.Note, rel string) string {
+	switch kind {
+	case IssueIDMismatch:
+		return fmt.Sprintf("file is named %s but holds note %q", filepath.Base(rel), note.ID)
+	case IssueInvalidColor:
+		return fmt.Sprintf("invalid color %q", note.Color)
+	case IssueBadTimestamps:
+		return fmt.Sprintf("updated at %s, before it was created at %s",
+			note.UpdatedAt.Format("2006-01-02 15:04:05"), note.CreatedAt.Format("2006-01-02 15:04:05"))
+	case IssueBadGeometry:
+		return note.Geometry.Validate().Error()
+	}
+	return string(kind)
+}
+
+func noteProblems(note *model.Note, id string) []IssueKind {
+	var kinds []IssueKind
+	if note.ID != id {
+		kinds = append(kinds, IssueIDMismatch)
+	}
+	if !note.Color.Valid() {
+		kinds = append(kinds, IssueInvalidColor)
+	}
+	if note.UpdatedAt.Before(note.CreatedAt) {
+		kinds = append(kinds, IssueBadTimestamps)
+	}
+	if note.Geometry != nil && note.Geometry.Validate() != nil {
+		kinds = append(kinds, IssueBadGeometry)
+	}
+	return kinds
+}
+
+func strayIssue(rel string, dir bool) Issue {
+	msg := "file does not belong in the data directory"
+	if dir {
+		msg = "directory does not belong in the data directory"
+	}
+	return Issue{Kind: IssueStrayFile, Path: rel, Message: msg}
+}
+
+// Repair fixes a repairable issue in place. The note takes its ID from the
+// file name, invalid colors become the palette's default, an update time
+// before the creation time is reset to the creation time and a note's
+// size and position are brought into range.
+func (r *FileRepository) Repair(issue Issue) error {
+	if !issue.Repairable {
+		return fmt.Errorf("%s cannot be repaired, only quarantined", issue.Path)
+	}
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	path := filepath.Join(r.dataDir, issue.Path)
+	if issue.Kind == IssueMisplaced {
+		return r.relocate(issue, path)
+	}
+	note, err := r.readNote(path)
+	if err != nil {
+		return fmt.Errorf("failed to repair %s: %w", issue.Path, err)
+	}
+	switch issue.Kind {
+	case IssueIDMismatch:
+		note.ID = issue.NoteID
+	case IssueInvalidColor:
+		note.Color = defaultColor(filepath.Join(r.dataDir, paletteFile))
+	case IssueBadTimestamps:
+		note.UpdatedAt = note.CreatedAt
+	case IssueBadGeometry:
+		if note.Geometry != nil {
+			note.Geometry.Clamp()
+		}
+	default:
+		return fmt.Errorf("don't know how to repair %s", issue.Kind)
+	}
+
+	data, err := r.marshalNote(note, path)
+	if err != nil {
+		return fmt.Errorf("failed to encode note: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to repair %s: %w", issue.Path, err)
+	}
+	r.cacheEvict(issue.NoteID)
+	r.track(path)
+	return nil
+}
+
+// relocate moves a misplaced file to where the store's layout keeps it.
+func (r *FileRepository) relocate(issue Issue, path string) error {
+	dir, _, _ := strings.Cut(filepath.ToSlash(issue.Path), "/")
+	if dir != trashDir && dir != revisionsDir {
+		dir = ""
+	}
+	target := r.pathIn(r.layout(), dir, issue.NoteID)
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("failed to repair %s: %s already exists", issue.Path, target)
+	}
+	if err := r.prepareDir(target); err != nil {
+		return err
+	}
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("failed to repair %s: %w", issue.Path, err)
+	}
+	r.cacheEvict(issue.NoteID)
+	r.track(target)
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(target))
+}
+
+// Quarantine moves the file behind an issue into the quarantine directory.
+func (r *FileRepository) Quarantine(issue Issue) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	if err := r.quarantine(filepath.Join(r.dataDir, issue.Path)); err != nil {
+		return err
+	}
+	r.cacheEvict(issue.NoteID)
+	r.track(filepath.Join(r.dataDir, issue.Path))
+	return syncDir(filepath.Dir(filepath.Join(r.dataDir, issue.Path)))
+}
+
+// Warnings implements HealthReporter.
+func (r *FileRepository) Warnings() []string {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
+	return append([]string(nil), r.warnings...)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestCheckAndRepair(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if err := repo.Save(createTestNote()); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Format(time.RFC3339)
+	files := map[string]string{
+		"broken.json":    `{"id":"broken","content":`,
+		"renamed.json":   `{"schema_version":1,"id":"other","content":"x","color":"yellow","created_at":"` + created + `","updated_at":"` + created + `"}`,
+		"colored.json":   `{"schema_version":1,"id":"colored","content":"x","color":"light blue","created_at":"` + created + `","updated_at":"` + created + `"}`,
+		"backwards.json": `{"schema_version":1,"id":"backwards","content":"x","color":"blue","created_at":"` + created + `","updated_at":"2020-01-01T00:00:00Z"}`,
+		"placed.json":    `{"schema_version":2,"id":"placed","content":"x","color":"blue","geometry":{"board":"Work","x":0,"y":0,"width":5,"height":200,"z":1},"created_at":"` + created + `","updated_at":"` + created + `"}`,
+		"notes.txt":      "not a note",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	notes, err := repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get all notes: %v", err)
+	}
+	if len(notes) != 5 {
+		t.Errorf("Readable notes count mismatch, got: %d, want: 5", len(notes))
+	}
+	if warnings := repo.Warnings(); len(warnings) != 1 {
+		t.Errorf("Expected one warning for the undecodable note, got: %v", warnings)
+	}
+
+	report, err := repo.Check()
+	if err != nil {
+		t.Fatalf("Failed to check store: %v", err)
+	}
+	if report.Scanned != 6 {
+		t.Errorf("Scanned count mismatch, got: %d, want: 6", report.Scanned)
+	}
+
+	want := map[string]IssueKind{
+		"broken.json":    IssueUndecodable,
+		"renamed.json":   IssueIDMismatch,
+		"colored.json":   IssueInvalidColor,
+		"backwards.json": IssueBadTimestamps,
+		"placed.json":    IssueBadGeometry,
+		"notes.txt":      IssueStrayFile,
+	}
+	if len(report.Issues) != len(want) {
+		t.Fatalf("Issue count mismatch, got: %+v", report.Issues)
+	}
+	for _, issue := range report.Issues {
+		if want[issue.Path] != issue.Kind {
+			t.Errorf("Issue kind mismatch for %s, got: %s, want: %s", issue.Path, issue.Kind, want[issue.Path])
+		}
+
+		if issue.Repairable {
+			err = repo.Repair(issue)
+		} else {
+			err = repo.Quarantine(issue)
+		}
+		if err != nil {
+			t.Errorf("Failed to resolve %s: %v", issue.Path, err)
+		}
+	}
+
+	report, err = repo.Check()
+	if err != nil {
+		t.Fatalf("Failed to check store: %v", err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected a clean store after repair, got: %+v", report.Issues)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tempDir, quarantineDir, "broken.json.*")); len(matches) != 1 {
+		t.Errorf("Expected undecodable note in quarantine, got: %v", matches)
+	}
+
+	renamed, err := repo.GetById("renamed")
+	if err != nil {
+		t.Fatalf("Failed to get repaired note: %v", err)
+	}
+	if renamed.ID != "renamed" {
+		t.Errorf("Repaired note ID mismatch, got: %s, want: renamed", renamed.ID)
+	}
+	backwards, err := repo.GetById("backwards")
+	if err != nil {
+		t.Fatalf("Failed to get repaired note: %v", err)
+	}
+	if !backwards.UpdatedAt.Equal(backwards.CreatedAt) {
+		t.Errorf("Expected updated time reset to creation time, got: %s", backwards.UpdatedAt)
+	}
+	placed, err := repo.GetById("placed")
+	if err != nil {
+		t.Fatalf("Failed to get repaired note: %v", err)
+	}
+	if want := (model.Geometry{Board: "work", Width: model.MinNoteSize, Height: 200, Z: 1}); *placed.Geometry != want {
+		t.Errorf("Geometry mismatch, got: %+v, want: %+v", placed.Geometry, want)
+	}
+
+	if _, err := repo.GetAll(); err != nil {
+		t.Fatalf("Failed to get all notes: %v", err)
+	}
+	if warnings := repo.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings after repair, got: %v", warnings)
+	}
+}
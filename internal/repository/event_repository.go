@@ -0,0 +1,500 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// DefaultCompactThreshold is the number of events appended after the last
+// snapshot that triggers an automatic compaction.
+const DefaultCompactThreshold = 1000
+
+type EventType string
+
+const (
+	EventSave   EventType = "save"
+	EventUpdate EventType = "update"
+	EventDelete EventType = "delete"
+	// EventRevision records a past version of a note; it does not change
+	// the note itself.
+	EventRevision EventType = "revision"
+	// EventBatch groups the events of a transaction into one record so they
+	// are replayed all or none.
+	EventBatch EventType = "batch"
+)
+
+// Event is a single record in the append-only log.
+type Event struct {
+	Seq    uint64      `json:"seq"`
+	Type   EventType   `json:"type"`
+	Time   time.Time   `json:"time"`
+	NoteID string      `json:"note_id"`
+	Note   *model.Note `json:"note,omitempty"`
+
+	Revision *model.Revision `json:"revision,omitempty"`
+	Batch    []Event         `json:"batch,omitempty"`
+}
+
+// snapshot is the compacted state of the log up to and including Seq.
+type snapshot struct {
+	Seq   uint64                 `json:"seq"`
+	Time  time.Time              `json:"time"`
+	Notes map[string]*model.Note `json:"notes"`
+
+	Revisions map[string][]*model.Revision `json:"revisions,omitempty"`
+	History   map[string][]Event           `json:"history,omitempty"`
+}
+
+// EventLogRepository stores every change as an event in a single JSON-lines
+// log and keeps the current state in memory. The state is rebuilt at open
+// time from the latest snapshot plus the events appended after it.
+type EventLogRepository struct {
+	path      string
+	file      *os.File
+	mutex     sync.RWMutex
+	notes     map[string]*model.Note
+	revisions map[string][]*model.Revision
+	history   map[string][]Event
+	tags      *tagIndex
+	events    []Event
+	seq       uint64
+	threshold int
+
+	// broken is set when a failed append could not be undone; the log may
+	// end in a partial record, so nothing more is appended to it.
+	broken error
+	// compactErr is the error of the last automatic compaction, if it failed.
+	compactErr error
+}
+
+func NewEventLogRepository(path string) (*EventLogRepository, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	r := &EventLogRepository{
+		path:      path,
+		notes:     make(map[string]*model.Note),
+		revisions: make(map[string][]*model.Revision),
+		history:   make(map[string][]Event),
+		tags:      newTagIndex(),
+		threshold: DefaultCompactThreshold,
+	}
+	if err := r.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := r.replay(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	r.file = file
+	return r, nil
+}
+
+// SetCompactThreshold changes how many events may accumulate after the last
+// snapshot before the log is compacted. Zero or less disables compaction.
+func (r *EventLogRepository) SetCompactThreshold(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.threshold = n
+}
+
+// Close releases the log file.
+func (r *EventLogRepository) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.file.Close()
+}
+
+func (r *EventLogRepository) Save(note *model.Note) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.append(EventSave, note.ID, note)
+}
+
+func (r *EventLogRepository) Update(note *model.Note) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	current, exists := r.notes[note.ID]
+	if !exists {
+		return fmt.Errorf("failed to update note: note %s not found", note.ID)
+	}
+	version, err := nextVersion(current, note)
+	if err != nil {
+		return err
+	}
+	stored := cloneNote(note)
+	stored.Version = version
+	if err := r.append(EventUpdate, note.ID, stored); err != nil {
+		return err
+	}
+	note.Version = version
+	return nil
+}
+
+func (r *EventLogRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.notes[id]; !exists {
+		return fmt.Errorf("failed to delete note: note %s not found", id)
+	}
+	return r.append(EventDelete, id, nil)
+}
+
+func (r *EventLogRepository) GetById(id string) (*model.Note, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	note, exists := r.notes[id]
+	if !exists {
+		return nil, fmt.Errorf("note %s not found", id)
+	}
+	return cloneNote(note), nil
+}
+
+func (r *EventLogRepository) GetAll() ([]*model.Note, error) {
+	return Collect(r.All())
+}
+
+func (r *EventLogRepository) Find(q Query) (*Page, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return findIn(r.notes, q)
+}
+
+func (r *EventLogRepository) Search(query string) ([]*model.Note, error) {
+	return Collect(r.SearchSeq(query))
+}
+
+// All streams the notes oldest first.
+func (r *EventLogRepository) All() iter.Seq2[*model.Note, error] {
+	return streamMap(&r.mutex, r.notes)
+}
+
+// SearchSeq streams the notes containing query, ignoring case.
+func (r *EventLogRepository) SearchSeq(query string) iter.Seq2[*model.Note, error] {
+	return containing(r.All(), query)
+}
+
+// Tags implements TagRepository.
+func (r *EventLogRepository) Tags() ([]TagCount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.tags.list(), nil
+}
+
+func (r *EventLogRepository) SaveRevision(rev *model.Revision) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	saved := *rev
+	saved.Number = len(r.revisions[rev.NoteID]) + 1
+	if err := r.appendEvent(Event{Type: EventRevision, NoteID: rev.NoteID, Revision: &saved}); err != nil {
+		return err
+	}
+	rev.Number = saved.Number
+	return nil
+}
+
+func (r *EventLogRepository) GetRevisions(noteID string) ([]*model.Revision, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	revisions := make([]*model.Revision, len(r.revisions[noteID]))
+	for i, rev := range r.revisions[noteID] {
+		clone := *rev
+		revisions[i] = &clone
+	}
+	return revisions, nil
+}
+
+// History returns every change recorded for a note, oldest first. Changes
+// made in a transaction carry the sequence number and time of its batch.
+func (r *EventLogRepository) History(id string) []Event {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var history []Event
+	for _, event := range r.history[id] {
+		history = append(history, cloneEvent(event))
+	}
+	for _, event := range r.events {
+		for _, change := range changes(event) {
+			if change.NoteID == id {
+				history = append(history, cloneEvent(change))
+			}
+		}
+	}
+	return history
+}
+
+// Events returns every event recorded since the last compaction.
+func (r *EventLogRepository) Events() []Event {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	events := make([]Event, len(r.events))
+	for i, event := range r.events {
+		events[i] = cloneEvent(event)
+	}
+	return events
+}
+
+// Compact writes a snapshot of the current state and truncates the log.
+func (r *EventLogRepository) Compact() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.compact()
+}
+
+// CompactError returns the error of the last automatic compaction, or nil
+// if it succeeded. The change that triggered it was stored regardless, and
+// the compaction is retried on the next append.
+func (r *EventLogRepository) CompactError() error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.compactErr
+}
+
+func (r *EventLogRepository) append(eventType EventType, id string, note *model.Note) error {
+	return r.appendEvent(Event{Type: eventType, NoteID: id, Note: cloneNote(note)})
+}
+
+// appendEvent stores event durably before applying it. A failed write or
+// sync is cut off the log again so it is neither replayed after a reopen
+// nor followed by the next record.
+func (r *EventLogRepository) appendEvent(event Event) error {
+	if r.broken != nil {
+		return fmt.Errorf("failed to append event: event log is unusable: %w", r.broken)
+	}
+	event.Seq = r.seq + 1
+	event.Time = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	data = append(data, '\n')
+
+	offset, err := r.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to find end of event log: %w", err)
+	}
+	if _, err := r.file.Write(data); err != nil {
+		return r.undoAppend(offset, fmt.Errorf("failed to append event: %w", err))
+	}
+	if err := r.file.Sync(); err != nil {
+		return r.undoAppend(offset, fmt.Errorf("failed to sync event log: %w", err))
+	}
+
+	r.apply(event)
+	if r.threshold > 0 && len(r.events) >= r.threshold {
+		r.compactErr = r.compact()
+	}
+	return nil
+}
+
+func (r *EventLogRepository) undoAppend(offset int64, cause error) error {
+	if err := r.file.Truncate(offset); err != nil {
+		r.broken = err
+		return cause
+	}
+	if err := r.file.Sync(); err != nil {
+		r.broken = err
+	}
+	return cause
+}
+
+func (r *EventLogRepository) apply(event Event) {
+	r.seq = event.Seq
+	r.events = append(r.events, event)
+	switch event.Type {
+	case EventRevision:
+		r.revisions[event.NoteID] = append(r.revisions[event.NoteID], event.Revision)
+	case EventBatch:
+		for _, inner := range event.Batch {
+			r.applyChange(inner)
+		}
+	default:
+		r.applyChange(event)
+	}
+}
+
+func (r *EventLogRepository) applyChange(event Event) {
+	switch event.Type {
+	case EventSave, EventUpdate:
+		r.notes[event.NoteID] = event.Note
+		r.tags.set(event.NoteID, event.Note.Tags)
+	case EventDelete:
+		delete(r.notes, event.NoteID)
+		r.tags.remove(event.NoteID)
+	}
+}
+
+// compact persists the snapshot before truncating the log. A crash in
+// between is harmless: replay skips events already covered by the snapshot.
+func (r *EventLogRepository) compact() error {
+	history := make(map[string][]Event, len(r.history))
+	for id, events := range r.history {
+		history[id] = slices.Clip(events)
+	}
+	for _, event := range r.events {
+		for _, change := range changes(event) {
+			history[change.NoteID] = append(history[change.NoteID], change)
+		}
+	}
+	snap := snapshot{
+		Seq:       r.seq,
+		Time:      time.Now(),
+		Notes:     r.notes,
+		Revisions: r.revisions,
+		History:   history,
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := writeFileAtomic(r.snapshotPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if err := r.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate event log: %w", err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync event log: %w", err)
+	}
+	r.history = history
+	r.events = nil
+	return nil
+}
+
+// changes returns the note changes recorded by event, with the changes of
+// a batch stamped with the batch's sequence number and time.
+func changes(event Event) []Event {
+	switch event.Type {
+	case EventRevision:
+		return nil
+	case EventBatch:
+		batch := make([]Event, len(event.Batch))
+		for i, inner := range event.Batch {
+			inner.Seq, inner.Time = event.Seq, event.Time
+			batch[i] = inner
+		}
+		return batch
+	default:
+		return []Event{event}
+	}
+}
+
+func (r *EventLogRepository) snapshotPath() string {
+	return r.path + ".snapshot"
+}
+
+func (r *EventLogRepository) loadSnapshot() error {
+	data, err := os.ReadFile(r.snapshotPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	r.seq = snap.Seq
+	if snap.Notes != nil {
+		r.notes = snap.Notes
+		for id, note := range r.notes {
+			r.tags.set(id, note.Tags)
+		}
+	}
+	if snap.Revisions != nil {
+		r.revisions = snap.Revisions
+	}
+	if snap.History != nil {
+		r.history = snap.History
+	}
+	return nil
+}
+
+// replay applies the events in the log on top of the snapshot. A final
+// record without its trailing newline was torn by a crash mid-append and is
+// cut off; a damaged record anywhere else is reported as corruption.
+func (r *EventLogRepository) replay() error {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read event log: %w", err)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	var offset int64
+	for line := 1; ; line++ {
+		record, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(record) > 0 {
+				return r.truncateTorn(offset)
+			}
+			return nil
+		}
+
+		var event Event
+		if err := json.Unmarshal(record, &event); err != nil {
+			return fmt.Errorf("failed to decode event log line %d: %w", line, err)
+		}
+		offset += int64(len(record))
+		if event.Seq <= r.seq {
+			continue
+		}
+		r.apply(event)
+	}
+}
+
+func (r *EventLogRepository) truncateTorn(size int64) error {
+	if err := os.Truncate(r.path, size); err != nil {
+		return fmt.Errorf("failed to truncate torn event: %w", err)
+	}
+	return nil
+}
+
+func cloneEvent(event Event) Event {
+	event.Note = cloneNote(event.Note)
+	if event.Batch != nil {
+		batch := make([]Event, len(event.Batch))
+		for i, inner := range event.Batch {
+			batch[i] = cloneEvent(inner)
+		}
+		event.Batch = batch
+	}
+	if event.Revision != nil {
+		rev := *event.Revision
+		event.Revision = &rev
+	}
+	return event
+}
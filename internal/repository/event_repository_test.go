@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func setupEventLogRepo(t *testing.T) (*EventLogRepository, string) {
+	tempDir, err := os.MkdirTemp("", "sticky-notes-log-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	repo, err := NewEventLogRepository(filepath.Join(tempDir, "notes.log"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	return repo, tempDir
+}
+
+func reopenEventLogRepo(t *testing.T, repo *EventLogRepository) *EventLogRepository {
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Failed to close repository: %v", err)
+	}
+	reopened, err := NewEventLogRepository(repo.path)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	return reopened
+}
+
+func TestEventLogReplay(t *testing.T) {
+	repo, tempDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	note.Content = "updated content"
+	if err := repo.Update(note); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	other := &model.Note{ID: "other", Content: "other", Color: model.Pink}
+	if err := repo.Save(other); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if err := repo.Delete(other.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+
+	repo = reopenEventLogRepo(t, repo)
+	defer repo.Close()
+
+	retrieved, err := repo.GetById(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get note: %v", err)
+	}
+	if retrieved.Content != "updated content" {
+		t.Errorf("Replayed note content mismatch, got: %s, want: updated content", retrieved.Content)
+	}
+	if _, err := repo.GetById(other.ID); err == nil {
+		t.Error("Expected deleted note to stay deleted after replay")
+	}
+
+	history := repo.History(note.ID)
+	if len(history) != 2 || history[0].Type != EventSave || history[1].Type != EventUpdate {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	rev := &model.Revision{NoteID: note.ID, Content: "test content", Color: model.Yellow}
+	if err := repo.SaveRevision(rev); err != nil {
+		t.Fatalf("Failed to save revision: %v", err)
+	}
+	if err := repo.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	repo = reopenEventLogRepo(t, repo)
+	defer repo.Close()
+
+	revisions, err := repo.GetRevisions(note.ID)
+	if err != nil || len(revisions) != 1 || revisions[0].Number != 1 {
+		t.Errorf("Expected revision to survive compaction, got: %+v (%v)", revisions, err)
+	}
+	if err := repo.Delete(note.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	history = repo.History(note.ID)
+	if len(history) != 3 || history[0].Type != EventSave || history[2].Type != EventDelete {
+		t.Errorf("Expected history to survive compaction, got: %+v", history)
+	}
+}
+
+func TestEventLogFailedAppend(t *testing.T) {
+	repo, tempDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+
+	// A write that stopped halfway is cut off again.
+	offset, err := repo.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("Failed to seek log: %v", err)
+	}
+	repo.file.WriteString(`{"seq":2,"type":"delete","note_i`)
+	if err := repo.undoAppend(offset, errors.New("short write")); err == nil {
+		t.Error("Expected undoAppend to return the write error")
+	}
+	other := &model.Note{ID: "other", Content: "other", Color: model.Pink}
+	if err := repo.Save(other); err != nil {
+		t.Fatalf("Failed to save note after a failed append: %v", err)
+	}
+	repo = reopenEventLogRepo(t, repo)
+
+	all, err := repo.GetAll()
+	if err != nil || len(all) != 2 {
+		t.Errorf("Expected both notes after reopen, got: %d (%v)", len(all), err)
+	}
+
+	// A log that cannot be cut back refuses further appends.
+	repo.file.Close()
+	repo.file, err = os.Open(repo.path)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer repo.Close()
+	if err := repo.Delete(note.ID); err == nil {
+		t.Fatal("Expected delete to fail on a read-only log")
+	}
+	if _, err := repo.GetById(note.ID); err != nil {
+		t.Errorf("Expected failed delete not to be applied: %v", err)
+	}
+	repo.file.Close()
+	repo.file, err = os.OpenFile(repo.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	if err := repo.Delete(other.ID); err == nil {
+		t.Error("Expected appends to stay refused once the log could not be cut back")
+	}
+}
+
+func TestEventLogCompactionFailure(t *testing.T) {
+	repo, tempDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	repo.SetCompactThreshold(1)
+	if err := os.Mkdir(repo.snapshotPath(), 0755); err != nil {
+		t.Fatalf("Failed to block snapshot: %v", err)
+	}
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Expected save to succeed when compaction fails: %v", err)
+	}
+	if repo.CompactError() == nil {
+		t.Error("Expected the compaction error to be reported")
+	}
+
+	os.Remove(repo.snapshotPath())
+	repo = reopenEventLogRepo(t, repo)
+	defer repo.Close()
+	if _, err := repo.GetById(note.ID); err != nil {
+		t.Errorf("Expected note saved before the failed compaction: %v", err)
+	}
+}
+
+func TestEventLogTornRecord(t *testing.T) {
+	repo, tempDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	repo.Close()
+
+	// Simulate a crash halfway through appending the next event.
+	file, err := os.OpenFile(repo.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	file.WriteString(`{"seq":2,"type":"delete","note_i`)
+	file.Close()
+
+	reopened, err := NewEventLogRepository(repo.path)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository with torn record: %v", err)
+	}
+	defer reopened.Close()
+
+	if _, err := reopened.GetById(note.ID); err != nil {
+		t.Errorf("Expected note to survive torn record: %v", err)
+	}
+
+	// The torn bytes must be gone so new events start on a clean line.
+	if err := reopened.Delete(note.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	again := reopenEventLogRepo(t, reopened)
+	defer again.Close()
+	if _, err := again.GetById(note.ID); err == nil {
+		t.Error("Expected note to be deleted after replay")
+	}
+}
+
+func TestEventLogCompaction(t *testing.T) {
+	repo, tempDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	repo.SetCompactThreshold(3)
+	notes := []*model.Note{
+		{ID: "note1", Content: "content1", Color: model.Yellow},
+		{ID: "note2", Content: "content2", Color: model.Blue},
+		{ID: "note3", Content: "content3", Color: model.Green},
+		{ID: "note4", Content: "content4", Color: model.Pink},
+	}
+	for _, note := range notes {
+		if err := repo.Save(note); err != nil {
+			t.Fatalf("Failed to save note: %v", err)
+		}
+	}
+
+	if events := repo.Events(); len(events) != 1 {
+		t.Errorf("Expected one event after compaction, got: %d", len(events))
+	}
+	if _, err := os.Stat(repo.snapshotPath()); err != nil {
+		t.Errorf("Expected snapshot file: %v", err)
+	}
+
+	repo = reopenEventLogRepo(t, repo)
+	defer repo.Close()
+
+	all, err := repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get all notes: %v", err)
+	}
+	if len(all) != len(notes) {
+		t.Errorf("Retrieved notes count mismatch, got: %d, want: %d", len(all), len(notes))
+	}
+}
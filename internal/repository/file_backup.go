@@ -0,0 +1,834 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+const (
+	// backupFormatVersion is the layout of the archive itself, independent
+	// of the note schema version of the files inside it.
+	backupFormatVersion = 1
+
+	backupManifest = "manifest.json"
+	// maxManifestSize bounds how much of an archive is read before its
+	// manifest says how large the other files are.
+	maxManifestSize = 64 << 20
+	// backupDataPrefix is where the store's files live inside an archive.
+	backupDataPrefix = "data/"
+
+	backupNamePrefix = "notes-"
+	backupNameSuffix = ".tar.gz"
+	backupTimeFormat = "20060102-150405"
+
+	// restoreDir holds a backup that is being moved into place by a
+	// replacing restore. Finding it on open means the move was
+	// interrupted and is resumed; backups still being staged next to it
+	// are discarded.
+	restoreDir = ".restore"
+)
+
+// BackupManifest describes the contents of a backup archive.
+type BackupManifest struct {
+	FormatVersion int          `json:"format_version"`
+	CreatedAt     time.Time    `json:"created_at"`
+	SchemaVersion int          `json:"schema_version"`
+	Encrypted     bool         `json:"encrypted"`
+	Notes         int          `json:"notes"`
+	Trashed       int          `json:"trashed"`
+	Files         []BackupFile `json:"files"`
+}
+
+// BackupFile is a file in a backup archive. Path is relative to the data
+// directory and uses forward slashes.
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup is a verified archive read into memory.
+type Backup struct {
+	Manifest *BackupManifest
+	files    map[string][]byte
+}
+
+type RestoreOptions struct {
+	// Replace makes the store an exact copy of the backup. Otherwise the
+	// backup is merged in: notes missing from the store are added, and a
+	// note present in both keeps whichever copy was updated last.
+	Replace bool
+}
+
+type RestoreReport struct {
+	Added   int
+	Updated int
+	Skipped int
+	Removed int
+}
+
+// BackupRetention says how many backups to keep when rotating: the newest
+// backup of each of the last Daily days and of each of the last Weekly
+// weeks. A backup can count towards both.
+type BackupRetention struct {
+	Daily  int
+	Weekly int
+}
+
+// Backup writes a compressed archive of every note, trashed note, revision
+// and the keystore to w. It holds the shared lock throughout, so no other
+// process can change the store while it is being copied. Encrypted files
+// are archived as they are and stay encrypted.
+func (r *FileRepository) Backup(w io.Writer) (*BackupManifest, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	manifest := &BackupManifest{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: CurrentSchemaVersion,
+		Encrypted:     r.encrypted,
+	}
+	paths, err := r.storeFiles()
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[string][]byte, len(paths))
+	for _, rel := range paths {
+		data, err := os.ReadFile(r.storePath(rel))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		contents[rel] = data
+		manifest.Files = append(manifest.Files, BackupFile{Path: rel, Size: int64(len(data)), SHA256: checksum(data)})
+
+		switch kind, _ := classifyStorePath(rel); kind {
+		case storeNote:
+			manifest.Notes++
+		case storeTrash:
+			manifest.Trashed++
+		}
+	}
+
+	if err := writeBackup(w, manifest, contents); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return manifest, nil
+}
+
+// BackupTo writes a timestamped backup archive into dir and returns its
+// path.
+func (r *FileRepository) BackupTo(dir string) (string, *BackupManifest, error) {
+	var buf bytes.Buffer
+	manifest, err := r.Backup(&buf)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	stamp := backupNamePrefix + manifest.CreatedAt.Local().Format(backupTimeFormat)
+	archive := filepath.Join(dir, stamp+backupNameSuffix)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(archive); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		archive = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stamp, n, backupNameSuffix))
+	}
+	if err := writeFileAtomic(archive, buf.Bytes(), 0600); err != nil {
+		return "", nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return archive, manifest, nil
+}
+
+// ReadBackup reads an archive written by Backup and verifies it against its
+// manifest.
+func ReadBackup(rd io.Reader) (*Backup, error) {
+	gz, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer gz.Close()
+
+	// The manifest comes first, and no file is read past the size it
+	// gives, so a crafted archive cannot make us hold more than it claims.
+	var manifest *BackupManifest
+	sizes := make(map[string]int64)
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %s in backup", header.Name)
+		}
+
+		switch {
+		case header.Name == backupManifest && manifest == nil:
+			data, err := readEntry(tr, header.Name, maxManifestSize)
+			if err != nil {
+				return nil, err
+			}
+			manifest = &BackupManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("failed to decode backup manifest: %w", err)
+			}
+			for _, file := range manifest.Files {
+				sizes[file.Path] = file.Size
+			}
+		case strings.HasPrefix(header.Name, backupDataPrefix):
+			if manifest == nil {
+				return nil, fmt.Errorf("backup has no manifest before %s", header.Name)
+			}
+			rel := strings.TrimPrefix(header.Name, backupDataPrefix)
+			if _, err := classifyStorePath(rel); err != nil {
+				return nil, err
+			}
+			size, ok := sizes[rel]
+			if !ok {
+				return nil, fmt.Errorf("backup holds %s, which its manifest does not list", rel)
+			}
+			if _, dup := files[rel]; dup {
+				return nil, fmt.Errorf("backup holds %s twice", rel)
+			}
+			data, err := readEntry(tr, header.Name, size)
+			if err != nil {
+				return nil, err
+			}
+			files[rel] = data
+		default:
+			return nil, fmt.Errorf("unexpected entry %s in backup", header.Name)
+		}
+	}
+
+	if manifest == nil {
+		return nil, errors.New("backup has no manifest")
+	}
+	if err := verifyBackup(manifest, files); err != nil {
+		return nil, err
+	}
+	return &Backup{Manifest: manifest, files: files}, nil
+}
+
+// readEntry reads the current entry of an archive, failing if it holds
+// more than limit bytes.
+func readEntry(tr *tar.Reader, name string, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(tr, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from backup: %w", name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s in backup is larger than %d bytes", name, limit)
+	}
+	return data, nil
+}
+
+// VerifyBackup checks the archive at path against its manifest.
+func VerifyBackup(archive string) (*BackupManifest, error) {
+	backup, err := openBackup(archive)
+	if err != nil {
+		return nil, err
+	}
+	return backup.Manifest, nil
+}
+
+// RestoreBackup verifies the archive at path and then merges it into the
+// store or replaces the store with it. Replacing a store with an encrypted
+// backup that uses a different keystore leaves the store locked.
+func (r *FileRepository) RestoreBackup(archive string, opts RestoreOptions) (*RestoreReport, error) {
+	backup, err := openBackup(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.lock(); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+	defer r.cacheClear()
+
+	if opts.Replace {
+		return r.replaceWith(backup)
+	}
+	return r.mergeWith(backup)
+}
+
+// replaceWith stages the backup in a directory next to the store's files
+// and only then moves it into place, so a backup that cannot be written
+// leaves the store as it was.
+func (r *FileRepository) replaceWith(backup *Backup) (*RestoreReport, error) {
+	stage, err := os.MkdirTemp(r.dataDir, restoreDir+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create restore directory: %w", err)
+	}
+	if err := stageBackup(stage, backup); err != nil {
+		os.RemoveAll(stage)
+		return nil, err
+	}
+
+	if err := os.Rename(stage, filepath.Join(r.dataDir, restoreDir)); err != nil {
+		os.RemoveAll(stage)
+		return nil, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	if err := syncDir(r.dataDir); err != nil {
+		return nil, err
+	}
+	return r.finishRestore()
+}
+
+// stageBackup writes the manifest and files of a backup to dir, laid out
+// as in the archive.
+func stageBackup(dir string, backup *Backup) error {
+	manifest, err := json.MarshalIndent(backup.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup manifest: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, backupManifest), manifest, 0644); err != nil {
+		return fmt.Errorf("failed to stage backup: %w", err)
+	}
+	dirs := map[string]bool{dir: true}
+	for _, file := range backup.Manifest.Files {
+		target := filepath.Join(dir, filepath.FromSlash(backupDataPrefix+file.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to stage backup: %w", err)
+		}
+		dirs[filepath.Dir(target)] = true
+		perm := os.FileMode(0644)
+		if file.Path == keystoreFile {
+			perm = 0600
+		}
+		if err := writeFileAtomic(target, backup.files[file.Path], perm); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", file.Path, err)
+		}
+	}
+	for d := range dirs {
+		if err := syncDir(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishRestore moves the files of a staged backup into place and removes
+// those the backup does not have. The keystore goes first and is removed
+// last. Each file is renamed, and the staging directory is only removed at
+// the end, so the move can be repeated after a crash; an interrupted move
+// is finished when the store is next opened, before any file is read.
+func (r *FileRepository) finishRestore() (*RestoreReport, error) {
+	stage := filepath.Join(r.dataDir, restoreDir)
+	data, err := os.ReadFile(filepath.Join(stage, backupManifest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staged backup: %w", err)
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode staged backup: %w", err)
+	}
+	staged := func(rel string) string {
+		return filepath.Join(stage, filepath.FromSlash(backupDataPrefix+rel))
+	}
+
+	keystorePath := filepath.Join(r.dataDir, keystoreFile)
+	if ks, err := os.ReadFile(staged(keystoreFile)); err == nil {
+		var archived keystore
+		if err := json.Unmarshal(ks, &archived); err != nil {
+			return nil, fmt.Errorf("failed to decode keystore in backup: %w", err)
+		}
+		current, _ := os.ReadFile(keystorePath)
+		if err := os.Rename(staged(keystoreFile), keystorePath); err != nil {
+			return nil, fmt.Errorf("failed to restore keystore: %w", err)
+		}
+		if !bytes.Equal(ks, current) {
+			r.keys = nil
+			r.currentKey = ""
+		}
+		r.encrypted = true
+		r.legacy = archived.legacy()
+	}
+
+	report := &RestoreReport{}
+	listed := make(map[string]bool)
+	for _, file := range manifest.Files {
+		listed[file.Path] = true
+		if file.Path == keystoreFile {
+			continue
+		}
+		from, target := staged(file.Path), r.storePath(file.Path)
+		if _, err := os.Stat(from); errors.Is(err, os.ErrNotExist) {
+			// Moved before an earlier attempt was interrupted.
+			continue
+		}
+		if err := r.prepareDir(target); err != nil {
+			return report, err
+		}
+		if err := os.Rename(from, target); err != nil {
+			return report, fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+		r.track(target)
+		report.Added++
+	}
+
+	existing, err := r.storeFiles()
+	if err != nil {
+		return report, err
+	}
+	for _, rel := range existing {
+		if listed[rel] || rel == keystoreFile {
+			continue
+		}
+		if err := os.Remove(r.storePath(rel)); err != nil {
+			return report, fmt.Errorf("failed to remove %s: %w", rel, err)
+		}
+		r.track(r.storePath(rel))
+		report.Removed++
+	}
+	if !manifest.Encrypted {
+		if err := os.Remove(keystorePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return report, fmt.Errorf("failed to remove keystore: %w", err)
+		}
+		r.encrypted = false
+		r.legacy = false
+		r.keys = nil
+		r.currentKey = ""
+	}
+
+	for _, dir := range []string{"", trashDir, revisionsDir} {
+		if err := r.syncNoteDirs(dir); err != nil {
+			return report, err
+		}
+	}
+	if err := os.RemoveAll(stage); err != nil {
+		return report, fmt.Errorf("failed to remove restore directory: %w", err)
+	}
+	return report, syncDir(r.dataDir)
+}
+
+// removeStaleRestores removes backups that were still being staged when
+// an earlier restore failed or was interrupted.
+func (r *FileRepository) removeStaleRestores() error {
+	stale, err := filepath.Glob(filepath.Join(r.dataDir, restoreDir+"-*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range stale {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", filepath.Base(dir), err)
+		}
+	}
+	return nil
+}
+
+func (r *FileRepository) mergeWith(backup *Backup) (*RestoreReport, error) {
+	var archived *keystore
+	if ks, ok := backup.files[keystoreFile]; ok {
+		archived = &keystore{}
+		if err := json.Unmarshal(ks, archived); err != nil {
+			return nil, fmt.Errorf("failed to decode keystore in backup: %w", err)
+		}
+		for _, key := range archived.Keys {
+			if _, known := r.keys[key.ID]; !known {
+				return nil, errors.New("backup is encrypted with keys this store does not have; restore it with replace instead")
+			}
+		}
+		if err := archived.verify(r.keys); err != nil {
+			return nil, fmt.Errorf("failed to verify keystore in backup: %w", err)
+		}
+	}
+
+	// Decode everything before writing anything so a bad file leaves the
+	// store untouched.
+	type incoming struct {
+		note    *model.Note
+		trashed bool
+	}
+	var notes []incoming
+	var palette []byte
+	revisions := make(map[string][]byte)
+	for _, file := range backup.Manifest.Files {
+		kind, _ := classifyStorePath(file.Path)
+		if kind == storeKeystore {
+			continue
+		}
+		if kind == storePalette {
+			palette = backup.files[file.Path]
+			continue
+		}
+		// A backup without a keystore holds plaintext files, whether or
+		// not this store is encrypted.
+		data := backup.files[file.Path]
+		if archived != nil {
+			var err error
+			if data, err = r.openWith(r.storePath(file.Path), data, archived.legacy()); err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %w", file.Path, err)
+			}
+		}
+		if kind == storeRevisions {
+			revisions[strings.TrimSuffix(path.Base(file.Path), noteExt)] = data
+			continue
+		}
+		note, _, err := decodeNote(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", file.Path, err)
+		}
+		notes = append(notes, incoming{note: note, trashed: kind == storeTrash})
+	}
+
+	report := &RestoreReport{}
+	for _, in := range notes {
+		local, err := r.readNote(r.notePath(in.note.ID))
+		localTrashed := false
+		if err != nil {
+			local, err = r.readNote(r.trashPath(in.note.ID))
+			localTrashed = err == nil
+		}
+		if local != nil && !in.note.UpdatedAt.After(local.UpdatedAt) {
+			report.Skipped++
+			continue
+		}
+
+		target := r.notePath(in.note.ID)
+		if in.trashed {
+			target = r.trashPath(in.note.ID)
+		}
+		data, err := r.marshalNote(in.note, target)
+		if err != nil {
+			return report, fmt.Errorf("failed to encode note: %w", err)
+		}
+		if err := r.prepareDir(target); err != nil {
+			return report, err
+		}
+		if err := writeFileAtomic(target, data, 0644); err != nil {
+			return report, fmt.Errorf("failed to restore note %s: %w", in.note.ID, err)
+		}
+		r.track(target)
+
+		switch {
+		case local == nil:
+			report.Added++
+			continue
+		case localTrashed && !in.trashed:
+			err = r.removeTrashed(in.note.ID)
+		case !localTrashed && in.trashed:
+			err = os.Remove(r.notePath(in.note.ID))
+			r.track(r.notePath(in.note.ID))
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to restore note %s: %w", in.note.ID, err)
+		}
+		report.Updated++
+	}
+
+	// Revision histories are only restored for notes that have none.
+	for id, data := range revisions {
+		if _, err := os.Stat(r.revisionsPath(id)); err == nil {
+			continue
+		}
+		sealed, err := r.seal(r.revisionsPath(id), data)
+		if err != nil {
+			return report, fmt.Errorf("failed to encrypt revisions: %w", err)
+		}
+		if err := r.prepareDir(r.revisionsPath(id)); err != nil {
+			return report, fmt.Errorf("failed to create revisions directory: %w", err)
+		}
+		if err := writeFileAtomic(r.revisionsPath(id), sealed, 0644); err != nil {
+			return report, fmt.Errorf("failed to restore revisions: %w", err)
+		}
+	}
+
+	// Like revision histories, the palette is only restored into a store
+	// that has none.
+	palettePath := filepath.Join(r.dataDir, paletteFile)
+	if _, err := os.Stat(palettePath); palette != nil && errors.Is(err, os.ErrNotExist) {
+		if err := writeFileAtomic(palettePath, palette, 0644); err != nil {
+			return report, fmt.Errorf("failed to restore palette: %w", err)
+		}
+	}
+
+	if err := r.syncNoteDirs(""); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// ListBackups returns the backup archives in dir, newest first.
+func ListBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	type backupFile struct {
+		name    string
+		created time.Time
+		seq     int
+	}
+	var backups []backupFile
+	for _, entry := range entries {
+		if created, seq, ok := backupTime(entry.Name()); ok && !entry.IsDir() {
+			backups = append(backups, backupFile{name: entry.Name(), created: created, seq: seq})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].created.Equal(backups[j].created) {
+			return backups[i].created.After(backups[j].created)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+
+	archives := make([]string, len(backups))
+	for i, backup := range backups {
+		archives[i] = filepath.Join(dir, backup.name)
+	}
+	return archives, nil
+}
+
+// PruneBackups deletes the backups in dir that the retention policy does
+// not keep and returns their paths. A policy keeping nothing deletes
+// nothing.
+func PruneBackups(dir string, keep BackupRetention) ([]string, error) {
+	if keep.Daily <= 0 && keep.Weekly <= 0 {
+		return nil, nil
+	}
+	archives, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	var removed []string
+	for _, archive := range archives {
+		created, _, _ := backupTime(filepath.Base(archive))
+		day := created.Format("2006-01-02")
+		year, week := created.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%02d", year, week)
+
+		kept := false
+		if !days[day] && len(days) < keep.Daily {
+			days[day] = true
+			kept = true
+		}
+		if !weeks[weekKey] && len(weeks) < keep.Weekly {
+			weeks[weekKey] = true
+			kept = true
+		}
+		if kept {
+			continue
+		}
+		if err := os.Remove(archive); err != nil {
+			return removed, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		removed = append(removed, archive)
+	}
+	return removed, nil
+}
+
+// backupTime returns when the backup with the given file name was taken,
+// and its number among the backups taken within the same second.
+func backupTime(name string) (time.Time, int, bool) {
+	if !strings.HasPrefix(name, backupNamePrefix) || !strings.HasSuffix(name, backupNameSuffix) {
+		return time.Time{}, 0, false
+	}
+	// Backups taken within the same second get a -N suffix after the time,
+	// starting at 2.
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupNamePrefix), backupNameSuffix)
+	seq := 1
+	if len(stamp) > len(backupTimeFormat) {
+		n, err := strconv.Atoi(strings.TrimPrefix(stamp[len(backupTimeFormat):], "-"))
+		if err != nil || n < 2 {
+			return time.Time{}, 0, false
+		}
+		stamp, seq = stamp[:len(backupTimeFormat)], n
+	}
+	t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+	return t, seq, err == nil
+}
+
+type storeKind int
+
+const (
+	storeNote storeKind = iota
+	storeTrash
+	storeRevisions
+	storeKeystore
+	storePalette
+)
+
+// classifyStorePath says what a slash-separated path relative to the data
+// directory holds, and rejects anything a backup should not contain.
+func classifyStorePath(rel string) (storeKind, error) {
+	dir, name := path.Split(rel)
+	valid := name != "" && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, noteExt)
+	switch {
+	case rel == keystoreFile:
+		return storeKeystore, nil
+	case rel == paletteFile:
+		return storePalette, nil
+	case dir == "" && valid:
+		return storeNote, nil
+	case dir == trashDir+"/" && valid:
+		return storeTrash, nil
+	case dir == revisionsDir+"/" && valid:
+		return storeRevisions, nil
+	}
+	return 0, fmt.Errorf("unexpected file %s in backup", rel)
+}
+
+// storeFiles lists the files a backup covers as slash-separated paths
+// relative to the data directory. The paths are those of the flat layout
+// whatever layout the store uses, so an archive can be restored into a
+// store of either layout; storePath maps them back.
+func (r *FileRepository) storeFiles() ([]string, error) {
+	var paths []string
+	for _, dir := range []string{"", trashDir, revisionsDir} {
+		files, err := r.listNotes(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			paths = append(paths, path.Join(dir, file.id+noteExt))
+		}
+	}
+	for _, name := range []string{keystoreFile, paletteFile} {
+		if _, err := os.Stat(filepath.Join(r.dataDir, name)); err == nil {
+			paths = append(paths, name)
+		}
+	}
+	return paths, nil
+}
+
+// storePath returns where the file a backup path names lives in the
+// store's layout.
+func (r *FileRepository) storePath(rel string) string {
+	id := strings.TrimSuffix(path.Base(rel), noteExt)
+	switch kind, err := classifyStorePath(rel); {
+	case err != nil || kind == storeKeystore || kind == storePalette:
+		return filepath.Join(r.dataDir, filepath.FromSlash(rel))
+	case kind == storeTrash:
+		return r.trashPath(id)
+	case kind == storeRevisions:
+		return r.revisionsPath(id)
+	}
+	return r.notePath(id)
+}
+
+func openBackup(archive string) (*Backup, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	return ReadBackup(file)
+}
+
+func writeBackup(w io.Writer, manifest *BackupManifest, contents map[string][]byte) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	entries := []struct {
+		name string
+		data []byte
+	}{{backupManifest, manifestData}}
+	for _, file := range manifest.Files {
+		entries = append(entries, struct {
+			name string
+			data []byte
+		}{backupDataPrefix + file.Path, contents[file.Path]})
+	}
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    0600,
+			Size:    int64(len(entry.data)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func verifyBackup(manifest *BackupManifest, files map[string][]byte) error {
+	if manifest.FormatVersion != backupFormatVersion {
+		return fmt.Errorf("unsupported backup format version %d", manifest.FormatVersion)
+	}
+	if manifest.SchemaVersion > CurrentSchemaVersion {
+		return fmt.Errorf("%w: backup uses version %d, newer than %d", ErrUnsupportedSchema, manifest.SchemaVersion, CurrentSchemaVersion)
+	}
+	if len(manifest.Files) != len(files) {
+		return fmt.Errorf("backup holds %d files but its manifest lists %d", len(files), len(manifest.Files))
+	}
+
+	notes, trashed := 0, 0
+	for _, file := range manifest.Files {
+		data, ok := files[file.Path]
+		if !ok {
+			return fmt.Errorf("backup is missing %s", file.Path)
+		}
+		if int64(len(data)) != file.Size || checksum(data) != file.SHA256 {
+			return fmt.Errorf("checksum mismatch for %s", file.Path)
+		}
+		switch kind, _ := classifyStorePath(file.Path); kind {
+		case storeNote:
+			notes++
+		case storeTrash:
+			trashed++
+		}
+	}
+	if notes != manifest.Notes || trashed != manifest.Trashed {
+		return fmt.Errorf("backup holds %d notes and %d trashed notes but its manifest says %d and %d",
+			notes, trashed, manifest.Notes, manifest.Trashed)
+	}
+	_, hasKeystore := files[keystoreFile]
+	if hasKeystore != manifest.Encrypted {
+		return errors.New("backup keystore does not match its manifest")
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	trashed := &model.Note{ID: "trashed", Content: "old", Color: model.Blue, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := repo.Save(trashed); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if err := repo.Delete(trashed.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	if err := repo.SaveRevision(&model.Revision{NoteID: note.ID, Content: "first", Color: model.Yellow}); err != nil {
+		t.Fatalf("Failed to save revision: %v", err)
+	}
+
+	backupDir := filepath.Join(tempDir, "..", filepath.Base(tempDir)+"-backups")
+	defer os.RemoveAll(backupDir)
+	archive, manifest, err := repo.BackupTo(backupDir)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if manifest.Notes != 1 || manifest.Trashed != 1 || len(manifest.Files) != 3 {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+	if manifest.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("Manifest schema version mismatch, got: %d, want: %d", manifest.SchemaVersion, CurrentSchemaVersion)
+	}
+	if _, err := VerifyBackup(archive); err != nil {
+		t.Fatalf("Failed to verify backup: %v", err)
+	}
+
+	// Changes made after the backup.
+	note.Content = "changed after backup"
+	note.UpdatedAt = note.UpdatedAt.Add(time.Minute)
+	if err := repo.Update(note); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	extra := &model.Note{ID: "extra", Content: "extra", Color: model.Green, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := repo.Save(extra); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if err := repo.Purge(trashed.ID); err != nil {
+		t.Fatalf("Failed to purge note: %v", err)
+	}
+
+	report, err := repo.RestoreBackup(archive, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("Failed to merge backup: %v", err)
+	}
+	if report.Added != 1 || report.Skipped != 1 {
+		t.Errorf("Unexpected merge report: %+v", report)
+	}
+	retrieved, err := repo.GetById(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get note: %v", err)
+	}
+	if retrieved.Content != "changed after backup" {
+		t.Errorf("Merge should keep the newer note, got: %s", retrieved.Content)
+	}
+	if trash, _ := repo.ListTrash(); len(trash) != 1 {
+		t.Errorf("Expected trashed note to be merged back, got: %d", len(trash))
+	}
+
+	report, err = repo.RestoreBackup(archive, RestoreOptions{Replace: true})
+	if err != nil {
+		t.Fatalf("Failed to replace from backup: %v", err)
+	}
+	if report.Removed != 1 {
+		t.Errorf("Expected the note saved after the backup to be removed, got: %+v", report)
+	}
+	retrieved, err = repo.GetById(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get note: %v", err)
+	}
+	if retrieved.Content != "test content" {
+		t.Errorf("Replace should restore the backed up note, got: %s", retrieved.Content)
+	}
+	if _, err := repo.GetById(extra.ID); err == nil {
+		t.Error("Expected note missing from the backup to be removed")
+	}
+	if revisions, _ := repo.GetRevisions(note.ID); len(revisions) != 1 {
+		t.Errorf("Expected revisions to be restored, got: %d", len(revisions))
+	}
+}
+
+func TestBackupVerification(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if err := repo.Save(createTestNote()); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := repo.Backup(&buf); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(name string, data []byte) (string, []byte)
+		wantErr string
+	}{
+		{
+			name: "modified note",
+			tamper: func(name string, data []byte) (string, []byte) {
+				if strings.HasPrefix(name, backupDataPrefix) {
+					data = bytes.Replace(data, []byte("test content"), []byte("evil content"), 1)
+				}
+				return name, data
+			},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name: "path outside the store",
+			tamper: func(name string, data []byte) (string, []byte) {
+				if strings.HasPrefix(name, backupDataPrefix) {
+					name = backupDataPrefix + "../escape.json"
+				}
+				return name, data
+			},
+			wantErr: "unexpected file",
+		},
+		{
+			name: "missing manifest",
+			tamper: func(name string, data []byte) (string, []byte) {
+				if name == backupManifest {
+					return "", nil
+				}
+				return name, data
+			},
+			wantErr: "no manifest",
+		},
+		{
+			name: "file larger than listed",
+			tamper: func(name string, data []byte) (string, []byte) {
+				if strings.HasPrefix(name, backupDataPrefix) {
+					data = append(data, bytes.Repeat([]byte(" "), 1<<20)...)
+				}
+				return name, data
+			},
+			wantErr: "larger than",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := rewriteArchive(t, buf.Bytes(), tt.tamper)
+			_, err := ReadBackup(bytes.NewReader(tampered))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRestoreResumes(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := repo.Backup(&buf); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	backup, err := ReadBackup(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+
+	note.Content = "changed after backup"
+	if err := repo.Update(note); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	extra := &model.Note{ID: "extra", Content: "extra", Color: model.Green, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := repo.Save(extra); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if err := repo.EnableEncryption([]byte("correct horse")); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+
+	// Simulate a crash after the plaintext backup was staged, and another
+	// restore that failed while staging: the next open finishes the first,
+	// which removes the keystore, and discards the second.
+	if err := os.Mkdir(filepath.Join(tempDir, restoreDir), 0755); err != nil {
+		t.Fatalf("Failed to create restore directory: %v", err)
+	}
+	if err := stageBackup(filepath.Join(tempDir, restoreDir), backup); err != nil {
+		t.Fatalf("Failed to stage backup: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tempDir, restoreDir+"-1", "data"), 0755); err != nil {
+		t.Fatalf("Failed to create restore directory: %v", err)
+	}
+
+	repo, err = NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	if retrieved, err := repo.GetById(note.ID); err != nil || retrieved.Content != "test content" {
+		t.Errorf("Expected the backed up note, got: %+v (%v)", retrieved, err)
+	}
+	if _, err := repo.GetById(extra.ID); err == nil {
+		t.Error("Expected note missing from the backup to be removed")
+	}
+	if repo.Encrypted() {
+		t.Error("Expected the store to be plaintext like the backup")
+	}
+	for _, dir := range []string{restoreDir, restoreDir + "-1"} {
+		if _, err := os.Stat(filepath.Join(tempDir, dir)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got: %v", dir, err)
+		}
+	}
+}
+
+// rewriteArchive copies a backup archive through tamper. Entries renamed to
+// "" are dropped.
+func rewriteArchive(t *testing.T, archive []byte, tamper func(string, []byte) (string, []byte)) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		name, data := tamper(header.Name, data)
+		if name == "" {
+			continue
+		}
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))})
+		tw.Write(data)
+	}
+	tw.Close()
+	gw.Close()
+	return out.Bytes()
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sticky-notes-backups-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two backups a day for the three weeks up to Sunday 2024-03-24.
+	last := time.Date(2024, 3, 24, 18, 0, 0, 0, time.Local)
+	for day := 0; day < 21; day++ {
+		for _, hour := range []int{0, 9} {
+			created := last.AddDate(0, 0, -day).Add(-time.Duration(hour) * time.Hour)
+			name := backupNamePrefix + created.Format(backupTimeFormat) + backupNameSuffix
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+				t.Fatalf("Failed to create backup: %v", err)
+			}
+		}
+	}
+
+	// Two more backups taken within the same second as the newest one.
+	for _, suffix := range []string{"-2", "-10"} {
+		name := backupNamePrefix + "20240324-180000" + suffix + backupNameSuffix
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatalf("Failed to create backup: %v", err)
+		}
+	}
+
+	if _, err := PruneBackups(dir, BackupRetention{Daily: 3, Weekly: 3}); err != nil {
+		t.Fatalf("Failed to prune backups: %v", err)
+	}
+	archives, err := ListBackups(dir)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	var kept []string
+	for _, archive := range archives {
+		kept = append(kept, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(archive), backupNamePrefix), backupNameSuffix))
+	}
+	want := []string{
+		"20240324-180000-10", // newest of today and of this week
+		"20240323-180000",
+		"20240322-180000",
+		"20240317-180000", // newest of the previous two weeks
+		"20240310-180000",
+	}
+	if strings.Join(kept, ",") != strings.Join(want, ",") {
+		t.Errorf("Kept backups mismatch, got: %v, want: %v", kept, want)
+	}
+}
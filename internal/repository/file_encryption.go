@@ -0,0 +1,597 @@
+package repository
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bllexe/sticky-notes/internal/crypt"
+)
+
+const (
+	// keystoreFile marks an encrypted store. It holds the data keys,
+	// wrapped with a key derived from the passphrase or keyfile.
+	keystoreFile = ".keystore.json"
+
+	// keystoreVersion 2 stores seal every file for its path, and their
+	// keystore is authenticated. Version 1 stores are upgraded on the next
+	// Unlock.
+	keystoreVersion = 2
+
+	sealAlgorithm = "aes-256-gcm"
+	kdfAlgorithm  = "pbkdf2-sha256"
+)
+
+var (
+	// ErrLocked is returned when an encrypted store is used before Unlock.
+	ErrLocked = errors.New("note store is encrypted and locked")
+	// ErrNotEncrypted is returned by key management on a plaintext store.
+	ErrNotEncrypted = errors.New("note store is not encrypted")
+
+	errUnsealed = errors.New("file is not sealed for this encrypted store")
+	errTampered = errors.New("keystore has been modified outside the app")
+)
+
+type keystore struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	// Keys lists the data keys, current first. Older keys are only kept
+	// while RotateKey is re-encrypting the store.
+	Keys []wrappedKey `json:"keys"`
+	// Migrating is set while every file is being sealed, when files that
+	// are not sealed yet are still read.
+	Migrating bool `json:"migrating,omitempty"`
+	// MAC authenticates the other fields with the current data key, so
+	// the store cannot be put back into migration by editing the file.
+	MAC []byte `json:"mac,omitempty"`
+}
+
+// legacy reports whether files that are not sealed for their path may
+// still be in the store. It can only be trusted once the keystore has
+// been opened or verified.
+func (ks *keystore) legacy() bool {
+	return ks.Version < keystoreVersion || ks.Migrating
+}
+
+// keyContext is the additional data the data key id is wrapped with.
+// Version 1 keystores wrapped their keys without any, so a keystore
+// cannot be passed off as one of them to skip its MAC.
+func (ks *keystore) keyContext(id string) []byte {
+	if ks.Version < keystoreVersion {
+		return nil
+	}
+	return []byte("sticky-notes/key/" + id)
+}
+
+// authData is what the MAC covers: every other field of the keystore.
+func (ks *keystore) authData() ([]byte, error) {
+	unsigned := *ks
+	unsigned.MAC = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode keystore: %w", err)
+	}
+	return append([]byte("sticky-notes/keystore/"), data...), nil
+}
+
+// sign sets the MAC using c, the current data key.
+func (ks *keystore) sign(c *crypt.Cipher) error {
+	data, err := ks.authData()
+	if err != nil {
+		return err
+	}
+	// Sealing nothing leaves just the authentication tag over data.
+	if ks.MAC, err = c.Seal(nil, data); err != nil {
+		return fmt.Errorf("failed to sign keystore: %w", err)
+	}
+	return nil
+}
+
+// verify checks the MAC with the unwrapped data keys. Version 1
+// keystores have none; their keys only unwrap as version 1 keys.
+func (ks *keystore) verify(keys map[string]*crypt.Cipher) error {
+	if ks.Version < keystoreVersion {
+		return nil
+	}
+	if len(ks.Keys) == 0 {
+		return errTampered
+	}
+	c, ok := keys[ks.Keys[0].ID]
+	if !ok {
+		return ErrLocked
+	}
+	data, err := ks.authData()
+	if err != nil {
+		return err
+	}
+	if _, err := c.Open(ks.MAC, data); err != nil {
+		return errTampered
+	}
+	return nil
+}
+
+type wrappedKey struct {
+	ID      string `json:"id"`
+	Wrapped []byte `json:"wrapped"`
+}
+
+// envelope is the on-disk form of an encrypted file. Bound envelopes were
+// sealed with the file's sealContext.
+type envelope struct {
+	Encrypted string `json:"encrypted"`
+	KeyID     string `json:"key_id"`
+	Bound     bool   `json:"bound,omitempty"`
+	Data      []byte `json:"data"`
+}
+
+// Encrypted reports whether the store is encrypted at rest.
+func (r *FileRepository) Encrypted() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.encrypted
+}
+
+// Locked reports whether the store is encrypted and not unlocked yet.
+func (r *FileRepository) Locked() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.encrypted && len(r.keys) == 0
+}
+
+// Unlock opens an encrypted store for this session using the passphrase or
+// keyfile contents it was encrypted with. A store whose encryption was
+// interrupted, or that was encrypted by an older version, has its files
+// sealed again first.
+func (r *FileRepository) Unlock(secret []byte) error {
+	upgrade, err := r.unwrap(secret)
+	if err != nil || !upgrade {
+		return err
+	}
+	return r.upgradeEncryption(secret)
+}
+
+func (r *FileRepository) unwrap(secret []byte) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ks, err := r.readKeystore()
+	if err != nil {
+		return false, err
+	}
+	_, raw, err := openKeystore(ks, secret)
+	if err != nil {
+		return false, err
+	}
+	if r.keys, err = ciphers(ks, raw); err != nil {
+		return false, err
+	}
+	r.currentKey = ks.Keys[0].ID
+	r.legacy = ks.legacy()
+	return r.legacy, nil
+}
+
+func (r *FileRepository) upgradeEncryption(secret []byte) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	ks, err := r.readKeystore()
+	if err != nil {
+		return err
+	}
+	if ks.Version < keystoreVersion {
+		kek, raw, err := openKeystore(ks, secret)
+		if err != nil {
+			return err
+		}
+		if err := upgradeKeystore(ks, kek, raw); err != nil {
+			return err
+		}
+		if err := r.writeKeystore(ks, r.keys[ks.Keys[0].ID]); err != nil {
+			return err
+		}
+	} else if err := ks.verify(r.keys); err != nil {
+		return err
+	}
+	r.legacy = ks.legacy()
+	if !r.legacy {
+		return nil
+	}
+	if err := r.reencryptAll(); err != nil {
+		return err
+	}
+	return r.finishMigration(ks)
+}
+
+// upgradeKeystore turns a version 1 keystore into a current one, marked as
+// migrating until its files have been sealed for their paths.
+func upgradeKeystore(ks *keystore, kek *crypt.Cipher, raw [][]byte) error {
+	ks.Version, ks.Migrating = keystoreVersion, true
+	for i, key := range ks.Keys {
+		wrapped, err := kek.Seal(raw[i], ks.keyContext(key.ID))
+		if err != nil {
+			return fmt.Errorf("failed to wrap key: %w", err)
+		}
+		ks.Keys[i].Wrapped = wrapped
+	}
+	return nil
+}
+
+// finishMigration records that every file is sealed for its path.
+func (r *FileRepository) finishMigration(ks *keystore) error {
+	ks.Migrating = false
+	if err := r.writeKeystore(ks, r.keys[ks.Keys[0].ID]); err != nil {
+		return err
+	}
+	r.legacy = false
+	return nil
+}
+
+// EnableEncryption turns a plaintext store into an encrypted one and
+// leaves it unlocked. Every existing note, trashed note and revision is
+// re-encrypted.
+func (r *FileRepository) EnableEncryption(secret []byte) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	if r.encrypted {
+		return errors.New("note store is already encrypted")
+	}
+
+	ks, kek, err := newKeystore(secret)
+	if err != nil {
+		return err
+	}
+	key, c, err := generateKey(ks, kek)
+	if err != nil {
+		return err
+	}
+	ks.Keys = []wrappedKey{key}
+	ks.Migrating = true
+
+	// The keystore goes first, marked as migrating so plaintext files stay
+	// readable: a crash part way leaves nothing unreadable and the next
+	// Unlock finishes the job.
+	if err := r.writeKeystore(ks, c); err != nil {
+		return err
+	}
+	r.encrypted = true
+	r.legacy = true
+	r.keys = map[string]*crypt.Cipher{key.ID: c}
+	r.currentKey = key.ID
+
+	if err := r.reencryptAll(); err != nil {
+		return err
+	}
+	return r.finishMigration(ks)
+}
+
+// ChangePassphrase re-wraps the data keys with a new passphrase or keyfile.
+// Notes themselves are not rewritten.
+func (r *FileRepository) ChangePassphrase(oldSecret, newSecret []byte) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	ks, err := r.readKeystore()
+	if err != nil {
+		return err
+	}
+	_, rawKeys, err := openKeystore(ks, oldSecret)
+	if err != nil {
+		return err
+	}
+
+	newKs, kek, err := newKeystore(newSecret)
+	if err != nil {
+		return err
+	}
+	newKs.Migrating = ks.legacy()
+	for i, key := range ks.Keys {
+		wrapped, err := kek.Seal(rawKeys[i], newKs.keyContext(key.ID))
+		if err != nil {
+			return fmt.Errorf("failed to wrap key: %w", err)
+		}
+		newKs.Keys = append(newKs.Keys, wrappedKey{ID: key.ID, Wrapped: wrapped})
+	}
+	c, err := crypt.NewCipher(rawKeys[0])
+	if err != nil {
+		return err
+	}
+	return r.writeKeystore(newKs, c)
+}
+
+// RotateKey generates a new data key and re-encrypts every file with it.
+// The old key stays in the keystore until all files have been rewritten so
+// an interrupted rotation can simply be run again.
+func (r *FileRepository) RotateKey(secret []byte) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	ks, err := r.readKeystore()
+	if err != nil {
+		return err
+	}
+	kek, raw, err := openKeystore(ks, secret)
+	if err != nil {
+		return err
+	}
+	keys, err := ciphers(ks, raw)
+	if err != nil {
+		return err
+	}
+	if ks.Version < keystoreVersion {
+		if err := upgradeKeystore(ks, kek, raw); err != nil {
+			return err
+		}
+	}
+	key, c, err := generateKey(ks, kek)
+	if err != nil {
+		return err
+	}
+
+	ks.Keys = append([]wrappedKey{key}, ks.Keys...)
+	if err := r.writeKeystore(ks, c); err != nil {
+		return err
+	}
+	keys[key.ID] = c
+	r.keys = keys
+	r.currentKey = key.ID
+	r.legacy = ks.legacy()
+
+	if err := r.reencryptAll(); err != nil {
+		return err
+	}
+
+	ks.Keys = ks.Keys[:1]
+	if err := r.finishMigration(ks); err != nil {
+		return err
+	}
+	r.keys = map[string]*crypt.Cipher{key.ID: c}
+	return nil
+}
+
+// seal encrypts the contents of the file at path if the store is
+// encrypted. The ciphertext only opens for that path.
+func (r *FileRepository) seal(path string, plaintext []byte) ([]byte, error) {
+	if !r.encrypted {
+		return plaintext, nil
+	}
+	c, ok := r.keys[r.currentKey]
+	if !ok {
+		return nil, ErrLocked
+	}
+	sealed, err := c.Seal(plaintext, r.sealContext(path))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Encrypted: sealAlgorithm, KeyID: r.currentKey, Bound: true, Data: sealed})
+}
+
+// open decrypts the contents of the file at path. Plaintext files are
+// returned as they are in a plaintext store; an encrypted store only
+// accepts them, and files not sealed for their path, while it is being
+// migrated.
+func (r *FileRepository) open(path string, data []byte) ([]byte, error) {
+	return r.openWith(path, data, r.legacy)
+}
+
+func (r *FileRepository) openWith(path string, data []byte, legacy bool) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Encrypted == "" {
+		switch {
+		case !r.encrypted:
+			return data, nil
+		case !legacy:
+			return nil, errUnsealed
+		case len(r.keys) == 0:
+			// Whether the store is migrating is only known once its
+			// keystore has been verified.
+			return nil, ErrLocked
+		}
+		return data, nil
+	}
+	if env.Encrypted != sealAlgorithm {
+		return nil, fmt.Errorf("unsupported encryption %q", env.Encrypted)
+	}
+	c, ok := r.keys[env.KeyID]
+	if !ok {
+		if len(r.keys) == 0 {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("file was encrypted with unknown key %s", env.KeyID)
+	}
+	if !env.Bound {
+		if !legacy {
+			return nil, errUnsealed
+		}
+		return c.Open(env.Data, nil)
+	}
+	return c.Open(env.Data, r.sealContext(path))
+}
+
+// sealContext is the additional data the file at path is sealed with:
+// what the file holds and which note it belongs to, so a sealed file
+// cannot stand in for another. Temp files are sealed for the file they
+// replace.
+func (r *FileRepository) sealContext(path string) []byte {
+	name := filepath.Base(path)
+	if target, ok := tempTarget(name); ok {
+		name = target
+	}
+	kind := "note"
+	rel, _ := filepath.Rel(r.dataDir, path)
+	switch dir, _, _ := strings.Cut(filepath.ToSlash(rel), "/"); dir {
+	case trashDir:
+		kind = "trash"
+	case revisionsDir:
+		kind = "revision"
+	}
+	return []byte("sticky-notes/" + kind + "/" + strings.TrimSuffix(name, noteExt))
+}
+
+// reencryptAll rewrites every note, trashed note and revision file with
+// the current key.
+func (r *FileRepository) reencryptAll() error {
+	for _, dir := range []string{"", trashDir, revisionsDir} {
+		files, err := r.listNotes(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, note := range files {
+			file, path := note.entry, note.path
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file.Name(), err)
+			}
+			plaintext, err := r.open(path, data)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", file.Name(), err)
+			}
+			sealed, err := r.seal(path, plaintext)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt %s: %w", file.Name(), err)
+			}
+			if err := writeFileAtomic(path, sealed, 0644); err != nil {
+				return fmt.Errorf("failed to rewrite %s: %w", file.Name(), err)
+			}
+			r.track(path)
+		}
+	}
+	return nil
+}
+
+func (r *FileRepository) readKeystore() (*keystore, error) {
+	data, err := os.ReadFile(filepath.Join(r.dataDir, keystoreFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotEncrypted
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	var ks keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("failed to decode keystore: %w", err)
+	}
+	if ks.KDF != kdfAlgorithm || len(ks.Keys) == 0 {
+		return nil, fmt.Errorf("unsupported keystore (kdf %q, %d keys)", ks.KDF, len(ks.Keys))
+	}
+	return &ks, nil
+}
+
+// writeKeystore signs ks with c, its current data key, and writes it.
+func (r *FileRepository) writeKeystore(ks *keystore, c *crypt.Cipher) error {
+	if err := ks.sign(c); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode keystore: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(r.dataDir, keystoreFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	return nil
+}
+
+// newKeystore creates an empty keystore for secret and returns it with
+// the key-encryption key derived from the secret.
+func newKeystore(secret []byte) (*keystore, *crypt.Cipher, error) {
+	salt, err := crypt.RandomBytes(crypt.SaltSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	ks := &keystore{
+		Version:    keystoreVersion,
+		KDF:        kdfAlgorithm,
+		Iterations: crypt.DefaultIterations,
+		Salt:       salt,
+	}
+	kek, err := crypt.NewCipher(crypt.DeriveKey(secret, salt, ks.Iterations))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ks, kek, nil
+}
+
+// generateKey creates a random data key wrapped with kek for ks.
+func generateKey(ks *keystore, kek *crypt.Cipher) (wrappedKey, *crypt.Cipher, error) {
+	raw, err := crypt.RandomBytes(crypt.KeySize)
+	if err != nil {
+		return wrappedKey{}, nil, err
+	}
+	c, err := crypt.NewCipher(raw)
+	if err != nil {
+		return wrappedKey{}, nil, err
+	}
+	id, err := newKeyID()
+	if err != nil {
+		return wrappedKey{}, nil, err
+	}
+	wrapped, err := kek.Seal(raw, ks.keyContext(id))
+	if err != nil {
+		return wrappedKey{}, nil, fmt.Errorf("failed to wrap key: %w", err)
+	}
+	return wrappedKey{ID: id, Wrapped: wrapped}, c, nil
+}
+
+// openKeystore unwraps the data keys with the key-encryption key derived
+// from secret and verifies the keystore with them. It returns the
+// key-encryption key and the data keys in keystore order.
+func openKeystore(ks *keystore, secret []byte) (*crypt.Cipher, [][]byte, error) {
+	kek, err := crypt.NewCipher(crypt.DeriveKey(secret, ks.Salt, ks.Iterations))
+	if err != nil {
+		return nil, nil, err
+	}
+	raw := make([][]byte, len(ks.Keys))
+	for i, key := range ks.Keys {
+		if raw[i], err = kek.Open(key.Wrapped, ks.keyContext(key.ID)); err != nil {
+			return nil, nil, errors.New("wrong passphrase or keyfile")
+		}
+	}
+	keys, err := ciphers(ks, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ks.verify(keys); err != nil {
+		return nil, nil, err
+	}
+	return kek, raw, nil
+}
+
+// ciphers maps the IDs of the keys in ks to ciphers for the raw keys.
+func ciphers(ks *keystore, raw [][]byte) (map[string]*crypt.Cipher, error) {
+	keys := make(map[string]*crypt.Cipher, len(ks.Keys))
+	for i, key := range ks.Keys {
+		c, err := crypt.NewCipher(raw[i])
+		if err != nil {
+			return nil, err
+		}
+		keys[key.ID] = c
+	}
+	return keys, nil
+}
+
+func newKeyID() (string, error) {
+	b, err := crypt.RandomBytes(8)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bllexe/sticky-notes/internal/crypt"
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func init() {
+	// Keep key derivation cheap in tests.
+	crypt.DefaultIterations = 1000
+}
+
+func assertNotOnDisk(t *testing.T, dir string, secret string) {
+	t.Helper()
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, _ := os.ReadFile(path)
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("Found plaintext %q in %s", secret, path)
+		}
+		return nil
+	})
+}
+
+func TestEncryption(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := &model.Note{ID: "note1", Content: "wifi password hunter2", Color: model.Yellow}
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if err := repo.SaveRevision(&model.Revision{NoteID: "note1", Content: "old password hunter1"}); err != nil {
+		t.Fatalf("Failed to save revision: %v", err)
+	}
+	trashed := &model.Note{ID: "note2", Content: "customer phone 555-0100", Color: model.Blue}
+	repo.Save(trashed)
+	repo.Delete(trashed.ID)
+
+	if err := repo.EnableEncryption([]byte("correct horse")); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+	assertNotOnDisk(t, tempDir, "hunter2")
+	assertNotOnDisk(t, tempDir, "hunter1")
+	assertNotOnDisk(t, tempDir, "555-0100")
+
+	// A new session starts locked.
+	repo, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	if !repo.Locked() {
+		t.Fatal("Expected reopened store to be locked")
+	}
+	if _, err := repo.GetByID("note1"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got: %v", err)
+	}
+	if err := repo.Save(note); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked on save, got: %v", err)
+	}
+	if err := repo.Unlock([]byte("wrong")); err == nil {
+		t.Fatal("Expected error for wrong passphrase, got nil")
+	}
+	if err := repo.Unlock([]byte("correct horse")); err != nil {
+		t.Fatalf("Failed to unlock: %v", err)
+	}
+
+	results, err := repo.Search("hunter2")
+	if err != nil || len(results) != 1 {
+		t.Errorf("Expected search over decrypted content, got: %d (%v)", len(results), err)
+	}
+	revisions, err := repo.GetRevisions("note1")
+	if err != nil || len(revisions) != 1 || revisions[0].Content != "old password hunter1" {
+		t.Errorf("Expected decrypted revision, got: %+v (%v)", revisions, err)
+	}
+	if trash, _ := repo.ListTrash(); len(trash) != 1 {
+		t.Errorf("Expected decrypted trash, got: %d", len(trash))
+	}
+
+	if err := repo.ChangePassphrase([]byte("correct horse"), []byte("battery staple")); err != nil {
+		t.Fatalf("Failed to change passphrase: %v", err)
+	}
+	if err := repo.RotateKey([]byte("battery staple")); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	assertNotOnDisk(t, tempDir, "hunter2")
+
+	repo, _ = NewFileRepository(tempDir)
+	if err := repo.Unlock([]byte("correct horse")); err == nil {
+		t.Error("Expected old passphrase to stop working")
+	}
+	if err := repo.Unlock([]byte("battery staple")); err != nil {
+		t.Fatalf("Failed to unlock with new passphrase: %v", err)
+	}
+	retrieved, err := repo.GetByID("note1")
+	if err != nil || retrieved.Content != note.Content {
+		t.Errorf("Expected note to survive key rotation, got: %+v (%v)", retrieved, err)
+	}
+}
+
+func TestEncryptionRejectsForeignFiles(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	for _, id := range []string{"note1", "note2"} {
+		if err := repo.Save(&model.Note{ID: id, Content: "secret " + id, Color: model.Yellow}); err != nil {
+			t.Fatalf("Failed to save note: %v", err)
+		}
+	}
+	repo.Delete("note2")
+	if err := repo.EnableEncryption([]byte("correct horse")); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+
+	copyFile := func(from, to string) {
+		t.Helper()
+		data, err := os.ReadFile(from)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", from, err)
+		}
+		if err := os.WriteFile(to, data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", to, err)
+		}
+	}
+
+	// A plaintext note dropped into the store is not read.
+	planted, _ := encodeNote(&model.Note{ID: "planted", Content: "planted", Color: model.Yellow})
+	if err := os.WriteFile(repo.notePath("planted"), planted, 0644); err != nil {
+		t.Fatalf("Failed to write note: %v", err)
+	}
+	// Nor is a sealed file copied to another note or out of the trash.
+	copyFile(repo.notePath("note1"), repo.notePath("note3"))
+	copyFile(repo.trashPath("note2"), repo.notePath("note2"))
+
+	for _, id := range []string{"planted", "note3", "note2"} {
+		if note, err := repo.GetByID(id); err == nil {
+			t.Errorf("Expected %s to be rejected, got: %+v", id, note)
+		}
+	}
+	if note, err := repo.GetByID("note1"); err != nil || note.Content != "secret note1" {
+		t.Errorf("Expected note1 to stay readable, got: %+v (%v)", note, err)
+	}
+}
+
+// writeVersion1Keystore rewrites the store's keystore the way version 1
+// wrote it: keys wrapped without additional data and no MAC.
+func writeVersion1Keystore(t *testing.T, repo *FileRepository, secret string) {
+	t.Helper()
+	ks, err := repo.readKeystore()
+	if err != nil {
+		t.Fatalf("Failed to read keystore: %v", err)
+	}
+	kek, raw, err := openKeystore(ks, []byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to open keystore: %v", err)
+	}
+	ks.Version, ks.Migrating, ks.MAC = 1, false, nil
+	for i := range ks.Keys {
+		if ks.Keys[i].Wrapped, err = kek.Seal(raw[i], nil); err != nil {
+			t.Fatalf("Failed to wrap key: %v", err)
+		}
+	}
+	writeKeystoreFile(t, repo, ks)
+}
+
+// writeKeystoreFile writes ks as it is, without signing it.
+func writeKeystoreFile(t *testing.T, repo *FileRepository, ks *keystore) {
+	t.Helper()
+	data, _ := json.Marshal(ks)
+	if err := os.WriteFile(filepath.Join(repo.dataDir, keystoreFile), data, 0600); err != nil {
+		t.Fatalf("Failed to write keystore: %v", err)
+	}
+}
+
+func TestEncryptionTamperedKeystore(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(ks *keystore)
+	}{
+		{"migrating flag set", func(ks *keystore) { ks.Migrating = true }},
+		{"passed off as version 1", func(ks *keystore) { ks.Version, ks.MAC = 1, nil }},
+		{"MAC removed", func(ks *keystore) { ks.Migrating, ks.MAC = true, nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, tempDir := setupTestRepo(t)
+			defer cleanupTestRepo(tempDir)
+
+			if err := repo.Save(&model.Note{ID: "note1", Content: "secret", Color: model.Yellow}); err != nil {
+				t.Fatalf("Failed to save note: %v", err)
+			}
+			if err := repo.EnableEncryption([]byte("correct horse")); err != nil {
+				t.Fatalf("Failed to enable encryption: %v", err)
+			}
+			ks, _ := repo.readKeystore()
+			tt.tamper(ks)
+			writeKeystoreFile(t, repo, ks)
+			planted, _ := encodeNote(&model.Note{ID: "planted", Content: "planted", Color: model.Yellow})
+			if err := os.WriteFile(repo.notePath("planted"), planted, 0644); err != nil {
+				t.Fatalf("Failed to write note: %v", err)
+			}
+
+			repo, err := NewFileRepository(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to reopen repository: %v", err)
+			}
+			if err := repo.Unlock([]byte("correct horse")); err == nil {
+				t.Error("Expected unlock to fail with a modified keystore")
+			}
+			if note, err := repo.GetByID("planted"); err == nil {
+				t.Errorf("Expected planted note to be rejected, got: %+v", note)
+			}
+		})
+	}
+}
+
+func TestEncryptionUpgrade(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if err := repo.Save(&model.Note{ID: "note1", Content: "secret", Color: model.Yellow}); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if err := repo.EnableEncryption([]byte("correct horse")); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+
+	// Turn the store into one written by an older version, whose files
+	// are not sealed for their path.
+	plaintext, _ := encodeNote(&model.Note{ID: "note1", Content: "secret", Color: model.Yellow})
+	sealed, err := repo.keys[repo.currentKey].Seal(plaintext, nil)
+	if err != nil {
+		t.Fatalf("Failed to seal note: %v", err)
+	}
+	data, _ := json.Marshal(envelope{Encrypted: sealAlgorithm, KeyID: repo.currentKey, Data: sealed})
+	if err := os.WriteFile(repo.notePath("note1"), data, 0644); err != nil {
+		t.Fatalf("Failed to write note: %v", err)
+	}
+	writeVersion1Keystore(t, repo, "correct horse")
+
+	repo, err = NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	if err := repo.Unlock([]byte("correct horse")); err != nil {
+		t.Fatalf("Failed to unlock: %v", err)
+	}
+	if note, err := repo.GetByID("note1"); err != nil || note.Content != "secret" {
+		t.Errorf("Expected the note to survive the upgrade, got: %+v (%v)", note, err)
+	}
+	if ks, _ := repo.readKeystore(); ks.Version != keystoreVersion || ks.Migrating {
+		t.Errorf("Keystore mismatch, got: version %d migrating %t, want: version %d", ks.Version, ks.Migrating, keystoreVersion)
+	}
+	data, _ = os.ReadFile(repo.notePath("note1"))
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || !env.Bound {
+		t.Errorf("Expected the note to be sealed for its path, got: %s", data)
+	}
+}
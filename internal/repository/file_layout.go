@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Layout is how a file store arranges note files in its directories.
+type Layout string
+
+const (
+	// LayoutFlat keeps every note file directly in its directory.
+	LayoutFlat Layout = "flat"
+	// LayoutSharded keeps each note file in a subdirectory named after the
+	// first shardWidth characters of its ID, e.g. 3f/3f2a...json, so no
+	// directory grows too large to list.
+	LayoutSharded Layout = "sharded"
+)
+
+// manifestFile records the layout of the store. A store without one is
+// flat.
+const manifestFile = ".manifest.json"
+
+const (
+	manifestVersion = 1
+	shardWidth      = 2
+)
+
+type storeManifest struct {
+	Version int    `json:"version"`
+	Layout  Layout `json:"layout"`
+	// MigratingFrom is set while files are moved out of an old layout.
+	// Finding it on open means the move was interrupted and is resumed.
+	MigratingFrom Layout `json:"migrating_from,omitempty"`
+}
+
+// layoutState is the manifest as last read, with the file's modification
+// time and size so changes made by other processes are noticed.
+type layoutState struct {
+	manifest storeManifest
+	exists   bool
+	modTime  time.Time
+	size     int64
+}
+
+// LayoutReport describes a layout change.
+type LayoutReport struct {
+	From  Layout
+	To    Layout
+	Moved int
+}
+
+func (l Layout) valid() bool {
+	return l == LayoutFlat || l == LayoutSharded
+}
+
+// Layout returns the layout the store uses.
+func (r *FileRepository) Layout() Layout {
+	return r.layout()
+}
+
+func (r *FileRepository) layout() Layout {
+	if state := r.layoutState.Load(); state != nil && state.manifest.Layout != "" {
+		return state.manifest.Layout
+	}
+	return LayoutFlat
+}
+
+// syncLayout rereads the manifest if it changed since it was last read. It
+// is called whenever the directory lock is taken, so a layout change made
+// by another process is followed before any file is touched.
+func (r *FileRepository) syncLayout() error {
+	info, err := os.Stat(filepath.Join(r.dataDir, manifestFile))
+	current := r.layoutState.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		if current == nil || current.exists {
+			r.layoutState.Store(&layoutState{manifest: storeManifest{Layout: LayoutFlat}})
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read store manifest: %w", err)
+	}
+	if current != nil && current.exists && current.size == info.Size() && current.modTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.dataDir, manifestFile))
+	if err != nil {
+		return fmt.Errorf("failed to read store manifest: %w", err)
+	}
+	var manifest storeManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("failed to decode store manifest: %w", err)
+	}
+	if manifest.Version > manifestVersion || !manifest.Layout.valid() {
+		return fmt.Errorf("store uses layout %q (manifest version %d), which this version does not support", manifest.Layout, manifest.Version)
+	}
+	r.layoutState.Store(&layoutState{manifest: manifest, exists: true, modTime: info.ModTime(), size: info.Size()})
+	return nil
+}
+
+func (r *FileRepository) writeManifest(manifest storeManifest) error {
+	manifest.Version = manifestVersion
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode store manifest: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(r.dataDir, manifestFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write store manifest: %w", err)
+	}
+	return r.syncLayout()
+}
+
+// shardOf returns the shard directory for a note ID. IDs too short to
+// fill a shard name are padded, and a leading dot is replaced so a shard
+// is never mistaken for one of the store's own directories.
+func shardOf(id string) string {
+	shard := id
+	if len(shard) > shardWidth {
+		shard = shard[:shardWidth]
+	}
+	shard += strings.Repeat("_", shardWidth-len(shard))
+	if strings.HasPrefix(shard, ".") {
+		shard = "_" + shard[1:]
+	}
+	return shard
+}
+
+func isShardDir(entry os.DirEntry) bool {
+	name := entry.Name()
+	return entry.IsDir() && len(name) == shardWidth && !strings.HasPrefix(name, ".")
+}
+
+// pathIn returns where a note file lives under dir ("" for live notes,
+// trashDir or revisionsDir) in the given layout.
+func (r *FileRepository) pathIn(layout Layout, dir, id string) string {
+	if layout == LayoutSharded {
+		return filepath.Join(r.dataDir, dir, shardOf(id), id+noteExt)
+	}
+	return filepath.Join(r.dataDir, dir, id+noteExt)
+}
+
+// noteDirs returns the directories holding note files under dir in the
+// given layout: dir itself when flat, and each of its shards when sharded.
+func (r *FileRepository) noteDirs(layout Layout, dir string) ([]string, error) {
+	base := filepath.Join(r.dataDir, dir)
+	if layout != LayoutSharded {
+		return []string{base}, nil
+	}
+	entries, err := os.ReadDir(base)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if isShardDir(entry) {
+			dirs = append(dirs, filepath.Join(base, entry.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+// noteFile is a note file found by listNotes.
+type noteFile struct {
+	id    string
+	path  string
+	entry os.DirEntry
+}
+
+// listNotes returns the note files under dir ("" for live notes, trashDir
+// or revisionsDir) in the store's layout, ordered by file name. Files that
+// are not where the layout puts them are left out.
+func (r *FileRepository) listNotes(dir string) ([]noteFile, error) {
+	return r.listNotesIn(r.layout(), dir)
+}
+
+func (r *FileRepository) listNotesIn(layout Layout, dir string) ([]noteFile, error) {
+	dirs, err := r.noteDirs(layout, dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []noteFile
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !isNoteFile(entry) {
+				continue
+			}
+			id := strings.TrimSuffix(entry.Name(), noteExt)
+			if layout == LayoutSharded && filepath.Base(d) != shardOf(id) {
+				continue
+			}
+			files = append(files, noteFile{id: id, path: filepath.Join(d, entry.Name()), entry: entry})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].entry.Name() < files[j].entry.Name() })
+	return files, nil
+}
+
+// prepareDir creates the shard directory a note file is about to be
+// written to.
+func (r *FileRepository) prepareDir(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return syncDir(filepath.Dir(dir))
+}
+
+// SetLayout moves every note, trashed note and revision history into the
+// given layout. It holds the exclusive lock throughout, so other instances
+// wait and then continue with the new layout. An interrupted change is
+// finished the next time the store is opened.
+func (r *FileRepository) SetLayout(layout Layout) (*LayoutReport, error) {
+	if !layout.valid() {
+		return nil, fmt.Errorf("unknown layout %q (use %s or %s)", layout, LayoutFlat, LayoutSharded)
+	}
+	if err := r.lock(); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+
+	report := &LayoutReport{From: r.layout(), To: layout}
+	if report.From == layout {
+		return report, nil
+	}
+	if err := r.writeManifest(storeManifest{Layout: layout, MigratingFrom: report.From}); err != nil {
+		return nil, err
+	}
+	moved, err := r.finishLayoutChange()
+	report.Moved = moved
+	return report, err
+}
+
+// finishLayoutChange moves files out of the layout recorded in the
+// manifest's MigratingFrom. Each file is renamed, so it is always in
+// exactly one of the two places and the move can be repeated after a
+// crash.
+func (r *FileRepository) finishLayoutChange() (int, error) {
+	state := r.layoutState.Load()
+	if state == nil || state.manifest.MigratingFrom == "" {
+		return 0, nil
+	}
+	from, to := state.manifest.MigratingFrom, state.manifest.Layout
+
+	moved := 0
+	for _, dir := range []string{"", trashDir, revisionsDir} {
+		files, err := r.listNotesIn(from, dir)
+		if err != nil {
+			return moved, err
+		}
+		for _, file := range files {
+			target := r.pathIn(to, dir, file.id)
+			if target == file.path {
+				continue
+			}
+			if err := r.prepareDir(target); err != nil {
+				return moved, err
+			}
+			if err := os.Rename(file.path, target); err != nil {
+				return moved, fmt.Errorf("failed to move %s: %w", file.entry.Name(), err)
+			}
+			moved++
+		}
+		if err := r.syncNoteDirs(dir); err != nil {
+			return moved, err
+		}
+		if to == LayoutFlat {
+			r.removeEmptyShards(dir)
+		}
+	}
+
+	if err := r.writeManifest(storeManifest{Layout: to}); err != nil {
+		return moved, err
+	}
+	return moved, nil
+}
+
+// syncNoteDirs syncs dir and its shards after files were moved between
+// them.
+func (r *FileRepository) syncNoteDirs(dir string) error {
+	base := filepath.Join(r.dataDir, dir)
+	if err := syncDir(base); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	shards, err := r.noteDirs(LayoutSharded, dir)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if err := syncDir(shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEmptyShards removes the shard directories left empty by a move to
+// the flat layout. Shards that still hold anything are kept for doctor to
+// report.
+func (r *FileRepository) removeEmptyShards(dir string) {
+	shards, err := r.noteDirs(LayoutSharded, dir)
+	if err != nil {
+		return
+	}
+	for _, shard := range shards {
+		os.Remove(shard)
+	}
+}
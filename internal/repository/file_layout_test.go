@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestShardOf(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "3f2a9c", want: "3f"},
+		{id: "a", want: "a_"},
+		{id: ".hidden", want: "_h"},
+	}
+
+	for _, tt := range tests {
+		if got := shardOf(tt.id); got != tt.want {
+			t.Errorf("Shard mismatch for %q, got: %s, want: %s", tt.id, got, tt.want)
+		}
+	}
+}
+
+func setupLayoutRepo(t *testing.T) (*FileRepository, string) {
+	t.Helper()
+	repo, tempDir := setupTestRepo(t)
+	for _, id := range []string{"ab-live", "cd-trashed"} {
+		note := &model.Note{ID: id, Content: id, Color: model.Yellow, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := repo.Save(note); err != nil {
+			t.Fatalf("Failed to save note: %v", err)
+		}
+	}
+	if err := repo.Delete("cd-trashed"); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	if err := repo.SaveRevision(&model.Revision{NoteID: "ab-live", Content: "first", Color: model.Yellow}); err != nil {
+		t.Fatalf("Failed to save revision: %v", err)
+	}
+	return repo, tempDir
+}
+
+func TestSetLayout(t *testing.T) {
+	repo, tempDir := setupLayoutRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if repo.Layout() != LayoutFlat {
+		t.Errorf("Layout mismatch, got: %s, want: %s", repo.Layout(), LayoutFlat)
+	}
+	if _, err := repo.SetLayout("nested"); err == nil {
+		t.Error("Expected an unknown layout to be refused")
+	}
+
+	report, err := repo.SetLayout(LayoutSharded)
+	if err != nil {
+		t.Fatalf("Failed to change layout: %v", err)
+	}
+	if report.From != LayoutFlat || report.To != LayoutSharded || report.Moved != 3 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	for _, rel := range []string{"ab/ab-live.json", ".trash/cd/cd-trashed.json", ".revisions/ab/ab-live.json"} {
+		if _, err := os.Stat(filepath.Join(tempDir, rel)); err != nil {
+			t.Errorf("Expected %s to exist: %v", rel, err)
+		}
+	}
+
+	// Another instance follows the manifest.
+	other, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	if other.Layout() != LayoutSharded {
+		t.Errorf("Layout mismatch, got: %s, want: %s", other.Layout(), LayoutSharded)
+	}
+	if note, err := other.GetById("ab-live"); err != nil || note.Content != "ab-live" {
+		t.Errorf("Expected the note to be readable: %+v (%v)", note, err)
+	}
+	if trash, err := other.ListTrash(); err != nil || len(trash) != 1 {
+		t.Errorf("Expected one trashed note, got: %d (%v)", len(trash), err)
+	}
+	if revs, err := other.GetRevisions("ab-live"); err != nil || len(revs) != 1 {
+		t.Errorf("Expected one revision, got: %d (%v)", len(revs), err)
+	}
+	if err := other.Save(&model.Note{ID: "ef-new", Content: "new", Color: model.Blue, CreatedAt: time.Now(), UpdatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if notes, err := repo.GetAll(); err != nil || len(notes) != 2 {
+		t.Errorf("Expected two notes, got: %d (%v)", len(notes), err)
+	}
+	if check, err := repo.Check(); err != nil || len(check.Issues) != 0 {
+		t.Errorf("Expected a clean check, got: %+v (%v)", check, err)
+	}
+
+	report, err = repo.SetLayout(LayoutFlat)
+	if err != nil {
+		t.Fatalf("Failed to change layout: %v", err)
+	}
+	if report.Moved != 4 {
+		t.Errorf("Moved mismatch, got: %d, want: %d", report.Moved, 4)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "ab")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty shard to be removed: %v", err)
+	}
+	if notes, err := other.GetAll(); err != nil || len(notes) != 2 {
+		t.Errorf("Expected two notes, got: %d (%v)", len(notes), err)
+	}
+}
+
+func TestLayoutChangeResumes(t *testing.T) {
+	repo, tempDir := setupLayoutRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	// A crash right after the manifest was written leaves every file in
+	// the old layout.
+	if err := repo.writeManifest(storeManifest{Layout: LayoutSharded, MigratingFrom: LayoutFlat}); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	reopened, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	if got := reopened.Recovery().Relocated; got != 3 {
+		t.Errorf("Relocated mismatch, got: %d, want: %d", got, 3)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "ab", "ab-live.json")); err != nil {
+		t.Errorf("Expected the note to be moved: %v", err)
+	}
+	if note, err := reopened.GetById("ab-live"); err != nil || note.Content != "ab-live" {
+		t.Errorf("Expected the note to be readable: %+v (%v)", note, err)
+	}
+}
+
+func TestLayoutMisplacedFile(t *testing.T) {
+	repo, tempDir := setupLayoutRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if _, err := repo.SetLayout(LayoutSharded); err != nil {
+		t.Fatalf("Failed to change layout: %v", err)
+	}
+	data, _ := encodeNote(&model.Note{ID: "gh-copied", Content: "copied", Color: model.Green, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	if err := os.WriteFile(filepath.Join(tempDir, "gh-copied.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write note: %v", err)
+	}
+	if _, err := repo.GetById("gh-copied"); err == nil {
+		t.Error("Expected a misplaced note to be ignored")
+	}
+
+	report, err := repo.Check()
+	if err != nil {
+		t.Fatalf("Failed to check: %v", err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != IssueMisplaced || !report.Issues[0].Repairable {
+		t.Fatalf("Unexpected issues: %+v", report.Issues)
+	}
+	if err := repo.Repair(report.Issues[0]); err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if note, err := repo.GetById("gh-copied"); err != nil || note.Content != "copied" {
+		t.Errorf("Expected the note to be readable: %+v (%v)", note, err)
+	}
+}
+
+func TestBackupAcrossLayouts(t *testing.T) {
+	repo, tempDir := setupLayoutRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if _, err := repo.SetLayout(LayoutSharded); err != nil {
+		t.Fatalf("Failed to change layout: %v", err)
+	}
+	backupDir := filepath.Join(tempDir, "..", filepath.Base(tempDir)+"-backups")
+	defer os.RemoveAll(backupDir)
+	archive, manifest, err := repo.BackupTo(backupDir)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	for _, file := range manifest.Files {
+		if filepath.Base(filepath.Dir(file.Path)) == "ab" || filepath.Base(filepath.Dir(file.Path)) == "cd" {
+			t.Errorf("Expected backups to use flat paths, got: %s", file.Path)
+		}
+	}
+
+	flat, flatDir := setupTestRepo(t)
+	defer cleanupTestRepo(flatDir)
+	if _, err := flat.RestoreBackup(archive, RestoreOptions{Replace: true}); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(flatDir, "ab-live.json")); err != nil {
+		t.Errorf("Expected the note in the flat layout: %v", err)
+	}
+	if trash, err := flat.ListTrash(); err != nil || len(trash) != 1 {
+		t.Errorf("Expected one trashed note, got: %d (%v)", len(trash), err)
+	}
+}
+
+func TestWatchShardedStore(t *testing.T) {
+	repo, tempDir := setupLayoutRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if _, err := repo.SetLayout(LayoutSharded); err != nil {
+		t.Fatalf("Failed to change layout: %v", err)
+	}
+	w, err := repo.Watch(WatchOptions{})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	defer w.Close()
+
+	// The shard does not exist yet, so the watcher has to notice it.
+	data, _ := encodeNote(&model.Note{ID: "zz-external", Content: "by hand", Color: model.Green, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	os.Mkdir(filepath.Join(tempDir, "zz"), 0755)
+	if err := os.WriteFile(filepath.Join(tempDir, "zz", "zz-external.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write note: %v", err)
+	}
+	change := nextChange(t, w)
+	if change.Kind != ChangeCreated || change.NoteID != "zz-external" || change.Path != filepath.Join("zz", "zz-external.json") {
+		t.Fatalf("Unexpected change: %+v", change)
+	}
+
+	os.Remove(filepath.Join(tempDir, "ab", "ab-live.json"))
+	change = nextChange(t, w)
+	if change.Kind != ChangeRemoved || change.NoteID != "ab-live" {
+		t.Fatalf("Unexpected change: %+v", change)
+	}
+}
+
+func TestWatchNewShardPartialFile(t *testing.T) {
+	repo, tempDir := setupLayoutRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	if _, err := repo.SetLayout(LayoutSharded); err != nil {
+		t.Fatalf("Failed to change layout: %v", err)
+	}
+	w, err := repo.Watch(WatchOptions{})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	defer w.Close()
+
+	// The note is still being written when the watcher finds the new
+	// shard: it is reported once, when its write completes.
+	data, _ := encodeNote(&model.Note{ID: "zz-partial", Content: "by hand", Color: model.Green, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	os.Mkdir(filepath.Join(tempDir, "zz"), 0755)
+	file, err := os.Create(filepath.Join(tempDir, "zz", "zz-partial.json"))
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	file.Write(data[:len(data)/2])
+	time.Sleep(200 * time.Millisecond)
+	file.Write(data[len(data)/2:])
+	file.Close()
+
+	change := nextChange(t, w)
+	if change.Kind != ChangeCreated || change.NoteID != "zz-partial" || change.After.Content != "by hand" {
+		t.Fatalf("Unexpected change: %+v", change)
+	}
+}
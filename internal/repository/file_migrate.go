@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+type MigrateOptions struct {
+	// DryRun reports what would be migrated without touching any file.
+	DryRun bool
+	// BackupDir receives a copy of the data directory before any note is
+	// rewritten. It defaults to a timestamped sibling of the data directory.
+	BackupDir string
+}
+
+// MigratedFile is a note document upgraded from an older schema version.
+type MigratedFile struct {
+	Path string
+	From int
+}
+
+// MigrationFailure is a note document that could not be upgraded.
+type MigrationFailure struct {
+	Path string
+	Err  error
+}
+
+type MigrationReport struct {
+	DryRun    bool
+	Scanned   int
+	Migrated  []MigratedFile
+	Failed    []MigrationFailure
+	BackupDir string
+}
+
+// Migrate upgrades every stored note, live or trashed, to the current
+// schema version. Notes are upgraded in memory whenever they are read, so
+// this is only needed to rewrite the files themselves.
+func (r *FileRepository) Migrate(opts MigrateOptions) (*MigrationReport, error) {
+	if err := r.lock(); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+
+	report := &MigrationReport{DryRun: opts.DryRun}
+	type pending struct {
+		path string
+		note *model.Note
+	}
+	var todo []pending
+
+	for _, dir := range []string{"", trashDir} {
+		files, err := r.listNotes(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			path := file.path
+			rel, _ := filepath.Rel(r.dataDir, path)
+			report.Scanned++
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				report.Failed = append(report.Failed, MigrationFailure{Path: rel, Err: err})
+				continue
+			}
+			if data, err = r.open(path, data); err != nil {
+				report.Failed = append(report.Failed, MigrationFailure{Path: rel, Err: err})
+				continue
+			}
+			note, version, err := decodeNote(data)
+			if err != nil {
+				report.Failed = append(report.Failed, MigrationFailure{Path: rel, Err: err})
+				continue
+			}
+			if version == CurrentSchemaVersion {
+				continue
+			}
+			report.Migrated = append(report.Migrated, MigratedFile{Path: rel, From: version})
+			todo = append(todo, pending{path: path, note: note})
+		}
+	}
+
+	if opts.DryRun || len(todo) == 0 {
+		return report, nil
+	}
+
+	backupDir := opts.BackupDir
+	if backupDir == "" {
+		backupDir = fmt.Sprintf("%s-backup-%s", filepath.Clean(r.dataDir), time.Now().Format("20060102-150405"))
+	}
+	if err := copyDir(r.dataDir, backupDir); err != nil {
+		return nil, fmt.Errorf("failed to back up data directory: %w", err)
+	}
+	report.BackupDir = backupDir
+
+	for _, p := range todo {
+		data, err := r.marshalNote(p.note, p.path)
+		if err != nil {
+			return report, fmt.Errorf("failed to encode note: %w", err)
+		}
+		if err := writeFileAtomic(p.path, data, 0644); err != nil {
+			return report, fmt.Errorf("failed to rewrite %s: %w", p.path, err)
+		}
+		r.track(p.path)
+	}
+
+	r.cacheClear()
+	return report, nil
+}
+
+// copyDir copies the regular files under src into dst, which must not
+// exist yet. Leftover temp files are skipped.
+func copyDir(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if rel, err := filepath.Rel(src, dst); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s is inside %s", dst, src)
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -1,123 +1,692 @@
 package repository
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/bllexe/sticky-notes/internal/crypt"
 	"github.com/bllexe/sticky-notes/internal/model"
 )
 
+const (
+	noteExt = ".json"
+
+	// quarantineDir holds note files that could not be decoded at startup.
+	// They are kept rather than deleted so they can be inspected by hand.
+	quarantineDir = ".quarantine"
+)
+
 type FileRepository struct {
-	dataDir string
-	mutex   sync.RWMutex
+	dataDir  string
+	mutex    sync.RWMutex
+	recovery RecoveryReport
+
+	// dirLock coordinates with other processes using the same data
+	// directory. It is always taken after mutex.
+	dirLock *dirLock
+
+	// cache holds decoded notes keyed by ID. Entries are validated against
+	// the file's modification time and size on every read, so edits made to
+	// the data directory by other processes are picked up.
+	cacheMutex sync.Mutex
+	cache      map[string]cacheEntry
+	// tags indexes the tags of the cached notes; Tags refreshes the cache
+	// before reading it.
+	tags *tagIndex
+
+	// layoutState is the store manifest, reread by syncLayout whenever the
+	// directory lock is taken.
+	layoutState atomic.Pointer[layoutState]
+
+	// known is the state of every note file as a running Watcher last saw
+	// it, or nil when nothing is watching. Writes made through the
+	// repository update it with track.
+	watchMutex sync.Mutex
+	known      map[string]knownFile
+	// warnings lists the files the last GetAll or Find could not read.
+	warnings []string
+
+	// encrypted is set when the store has a keystore. keys holds the
+	// unwrapped data keys by ID once the store has been unlocked. legacy
+	// is set while files that are not sealed for their path may still be
+	// read: while the store is being encrypted, and until a store
+	// encrypted by an older version is upgraded. Until the keystore has
+	// been verified by Unlock, such files are treated as locked.
+	encrypted  bool
+	legacy     bool
+	keys       map[string]*crypt.Cipher
+	currentKey string
 }
 
-// GetById implements NoteRepository.
-func (r *FileRepository) GetById(id string) (*model.Note, error) {
-	panic("unimplemented")
+type cacheEntry struct {
+	note    *model.Note
+	modTime time.Time
+	size    int64
+}
+
+func (e cacheEntry) matches(info os.FileInfo) bool {
+	return e.size == info.Size() && e.modTime.Equal(info.ModTime())
+}
+
+// RecoveryReport describes what NewFileRepository had to clean up after an
+// earlier crash.
+type RecoveryReport struct {
+	// Recovered lists note files restored from a completed temp file.
+	Recovered []string
+	// Removed lists temp files that were discarded.
+	Removed []string
+	// Quarantined lists note files moved into the quarantine directory.
+	Quarantined []string
+	// Replayed lists files rewritten to finish an interrupted transaction.
+	Replayed []string
+	// Relocated counts note files moved to finish an interrupted layout
+	// change.
+	Relocated int
+}
+
+// Empty reports whether recovery found nothing to do.
+func (r RecoveryReport) Empty() bool {
+	return len(r.Recovered) == 0 && len(r.Removed) == 0 && len(r.Quarantined) == 0 && len(r.Replayed) == 0 && r.Relocated == 0
 }
 
 func NewFileRepository(dataDir string) (*FileRepository, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
-	return &FileRepository{
+	r := &FileRepository{
 		dataDir: dataDir,
-	}, nil
+		cache:   make(map[string]cacheEntry),
+		tags:    newTagIndex(),
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, keystoreFile)); err == nil {
+		r.encrypted = true
+		if ks, err := r.readKeystore(); err == nil {
+			r.legacy = ks.legacy()
+		}
+	}
+
+	lock, err := openDirLock(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	r.dirLock = lock
+	if err := r.lock(); err != nil {
+		lock.close()
+		return nil, err
+	}
+	defer r.unlock()
+
+	moved, err := r.finishLayoutChange()
+	r.recovery.Relocated = moved
+	if err != nil {
+		lock.close()
+		return nil, fmt.Errorf("failed to finish changing the store layout: %w", err)
+	}
+	if err := r.removeStaleRestores(); err != nil {
+		lock.close()
+		return nil, err
+	}
+	if _, err := r.finishRestore(); err != nil {
+		lock.close()
+		return nil, fmt.Errorf("failed to finish restoring a backup: %w", err)
+	}
+	if err := r.recoverStore(); err != nil {
+		lock.close()
+		return nil, fmt.Errorf("failed to recover data directory: %w", err)
+	}
+	if err := r.replayJournal(); err != nil {
+		lock.close()
+		return nil, err
+	}
+	return r, nil
 }
 
-func (r *FileRepository) Save(note *model.Note) error {
+// SetLockTimeout changes how long operations wait for other processes to
+// release the data directory.
+func (r *FileRepository) SetLockTimeout(timeout time.Duration) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	filename := filepath.Join(r.dataDir, note.ID+".json")
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create note file: %w", err)
+	r.dirLock.timeout = timeout
+}
+
+// Close releases the data directory lock file.
+func (r *FileRepository) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.dirLock.close()
+}
+
+// rlock takes the shared lock used for reads, in this process and across
+// processes.
+func (r *FileRepository) rlock() error {
+	r.mutex.RLock()
+	if err := r.dirLock.lockShared(); err != nil {
+		r.mutex.RUnlock()
+		return err
+	}
+	if err := r.syncLayout(); err != nil {
+		r.runlock()
+		return err
 	}
-	defer file.Close()
+	return nil
+}
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(note); err != nil {
-		return fmt.Errorf("failed to encode note: %w", err)
+func (r *FileRepository) runlock() {
+	r.dirLock.unlockShared()
+	r.mutex.RUnlock()
+}
+
+// lock takes the exclusive lock used for writes.
+func (r *FileRepository) lock() error {
+	r.mutex.Lock()
+	if err := r.dirLock.lock(); err != nil {
+		r.mutex.Unlock()
+		return err
+	}
+	if err := r.syncLayout(); err != nil {
+		r.unlock()
+		return err
 	}
 	return nil
 }
 
+func (r *FileRepository) unlock() {
+	r.dirLock.unlock()
+	r.mutex.Unlock()
+}
+
+// Recovery returns what was repaired when the repository was opened.
+func (r *FileRepository) Recovery() RecoveryReport {
+	return r.recovery
+}
+
+func (r *FileRepository) Save(note *model.Note) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	return r.writeNote(note)
+}
+
 func (r *FileRepository) Update(note *model.Note) error {
-	return r.Save(note)
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	current, err := r.readNote(r.notePath(note.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update note: %w", err)
+	}
+	version, err := nextVersion(current, note)
+	if err != nil {
+		return err
+	}
+	stored := cloneNote(note)
+	stored.Version = version
+	if err := r.writeNote(stored); err != nil {
+		return err
+	}
+	note.Version = version
+	return nil
 }
 
+func (r *FileRepository) writeNote(note *model.Note) error {
+	path := r.notePath(note.ID)
+	data, err := r.marshalNote(note, path)
+	if err != nil {
+		return fmt.Errorf("failed to encode note: %w", err)
+	}
+	if err := r.prepareDir(path); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write note file: %w", err)
+	}
+	r.track(path)
+
+	if info, err := os.Stat(path); err == nil {
+		r.cacheStore(note.ID, cloneNote(note), info)
+	} else {
+		r.cacheEvict(note.ID)
+	}
+	return nil
+}
+
+// Delete moves a note to the trash. Use Purge to remove it for good.
 func (r *FileRepository) Delete(id string) error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
 
-	filename := filepath.Join(r.dataDir, id+".json")
-	if err := os.Remove(filename); err != nil {
+	note, err := r.readNote(r.notePath(id))
+	if err != nil {
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+	now := time.Now()
+	note.DeletedAt = &now
+
+	// Write the trashed copy before removing the note so a crash in between
+	// leaves the note in both places rather than in neither.
+	if err := r.writeTrashed(note); err != nil {
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+	r.cacheEvict(id)
+	if err := os.Remove(r.notePath(id)); err != nil {
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+	r.track(r.notePath(id))
+	if err := syncDir(filepath.Dir(r.notePath(id))); err != nil {
 		return fmt.Errorf("failed to delete note: %w", err)
 	}
 	return nil
 }
 
+// GetById implements NoteRepository.
+func (r *FileRepository) GetById(id string) (*model.Note, error) {
+	return r.GetByID(id)
+}
+
 func (r *FileRepository) GetByID(id string) (*model.Note, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
 
-	filename := filepath.Join(r.dataDir, id+".json")
-	file, err := os.Open(filename)
+	info, err := os.Stat(r.notePath(id))
 	if err != nil {
+		r.cacheEvict(id)
 		return nil, fmt.Errorf("failed to open note file: %w", err)
 	}
-	defer file.Close()
-
-	var note model.Note
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&note); err != nil {
-		return nil, fmt.Errorf("failed to decode note: %w", err)
+	note, err := r.loadNote(id, info)
+	if err != nil {
+		return nil, err
 	}
-	return &note, nil
+	return cloneNote(note), nil
 }
 
 func (r *FileRepository) GetAll() ([]*model.Note, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
 
-	files, err := os.ReadDir(r.dataDir)
+	notes, err := r.loadAll()
+	if err != nil {
+		return nil, err
+	}
+	for i, note := range notes {
+		notes[i] = cloneNote(note)
+	}
+	return notes, nil
+}
+
+// All streams the live notes in file name order. The directory is listed
+// once up front and each note is read under its own shared lock, so the
+// caller may write to the repository during iteration. Notes read go into
+// the cache, so searching again only reads the files that changed.
+// Unreadable files are skipped and recorded as warnings once iteration
+// completes.
+func (r *FileRepository) All() iter.Seq2[*model.Note, error] {
+	return func(yield func(*model.Note, error) bool) {
+		if err := r.rlock(); err != nil {
+			yield(nil, err)
+			return
+		}
+		files, err := r.listNotes("")
+		r.runlock()
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to read data directory: %w", err))
+			return
+		}
+
+		var warnings []string
+		for _, file := range files {
+			note, err := r.streamNote(file.id)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if errors.Is(err, ErrLocked) {
+				yield(nil, err)
+				return
+			}
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %v", file.entry.Name(), err))
+				continue
+			}
+			if !yield(note, nil) {
+				return
+			}
+		}
+		r.cacheMutex.Lock()
+		r.warnings = warnings
+		r.cacheMutex.Unlock()
+	}
+}
+
+// streamNote reads a note for All through the cache.
+func (r *FileRepository) streamNote(id string) (*model.Note, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	info, err := os.Stat(r.notePath(id))
+	if err != nil {
+		return nil, err
+	}
+	note, err := r.loadNote(id, info)
+	if err != nil {
+		return nil, err
+	}
+	return cloneNote(note), nil
+}
+
+// SearchSeq streams the live notes containing query, ignoring case.
+func (r *FileRepository) SearchSeq(query string) iter.Seq2[*model.Note, error] {
+	return containing(r.All(), query)
+}
+
+// Find filters the notes as they are loaded, keeping only the matches,
+// and only copies the requested page. Every note file is still visited;
+// unchanged ones come from the cache.
+func (r *FileRepository) Find(q Query) (*Page, error) {
+	keep, err := q.selector()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	notes, err := r.loadMatching(keep)
+	if err != nil {
+		return nil, err
+	}
+	page := q.page(notes)
+	for i, note := range page.Notes {
+		page.Notes[i] = cloneNote(note)
+	}
+	return page, nil
+}
+
+// loadAll returns every live note as cached, so callers must clone what
+// they hand out. Files that cannot be read are recorded as warnings.
+func (r *FileRepository) loadAll() ([]*model.Note, error) {
+	return r.loadMatching(nil)
+}
+
+// loadMatching is loadAll keeping only the notes keep accepts, or every
+// note if keep is nil.
+func (r *FileRepository) loadMatching(keep func(*model.Note) bool) ([]*model.Note, error) {
+	files, err := r.listNotes("")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read data directory: %w", err)
 	}
 
 	var notes []*model.Note
+	var warnings []string
+	seen := make(map[string]bool, len(files))
 	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".json") {
+		info, err := file.entry.Info()
+		if err != nil {
 			continue
 		}
 
-		note, err := r.GetByID(strings.TrimSuffix(file.Name(), ".json"))
+		seen[file.id] = true
+		note, err := r.loadNote(file.id, info)
+		if errors.Is(err, ErrLocked) {
+			return nil, err
+		}
 		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", file.entry.Name(), err))
 			continue
 		}
-		notes = append(notes, note)
+		if keep == nil || keep(note) {
+			notes = append(notes, note)
+		}
 	}
+	r.cacheRetain(seen)
+	r.cacheMutex.Lock()
+	r.warnings = warnings
+	r.cacheMutex.Unlock()
 	return notes, nil
 }
 
 func (r *FileRepository) Search(query string) ([]*model.Note, error) {
-	notes, err := r.GetAll()
+	return Collect(r.SearchSeq(query))
+}
+
+// Tags implements TagRepository. Loading the notes first brings the cache,
+// and with it the index, up to date with the files; unchanged files are
+// not read again.
+func (r *FileRepository) Tags() ([]TagCount, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	if _, err := r.loadAll(); err != nil {
+		return nil, err
+	}
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	return r.tags.list(), nil
+}
+
+// loadNote returns the cached note for id if the file described by info has
+// not changed since it was cached, and reads it from disk otherwise.
+func (r *FileRepository) loadNote(id string, info os.FileInfo) (*model.Note, error) {
+	r.cacheMutex.Lock()
+	entry, ok := r.cache[id]
+	r.cacheMutex.Unlock()
+	if ok && entry.matches(info) {
+		return entry.note, nil
+	}
+
+	note, err := r.readNote(r.notePath(id))
 	if err != nil {
+		r.cacheEvict(id)
 		return nil, err
 	}
+	r.cacheStore(id, note, info)
+	return note, nil
+}
+
+func (r *FileRepository) cacheStore(id string, note *model.Note, info os.FileInfo) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	r.cache[id] = cacheEntry{note: note, modTime: info.ModTime(), size: info.Size()}
+	r.tags.set(id, note.Tags)
+}
+
+func (r *FileRepository) cacheEvict(id string) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	delete(r.cache, id)
+	r.tags.remove(id)
+}
+
+// cacheClear empties the cache after files were rewritten wholesale.
+func (r *FileRepository) cacheClear() {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	r.cache = make(map[string]cacheEntry)
+	r.tags = newTagIndex()
+}
+
+// cacheRetain drops entries for notes whose files have disappeared.
+func (r *FileRepository) cacheRetain(ids map[string]bool) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	for id := range r.cache {
+		if !ids[id] {
+			delete(r.cache, id)
+			r.tags.remove(id)
+		}
+	}
+}
+
+func (r *FileRepository) notePath(id string) string {
+	return r.pathIn(r.layout(), "", id)
+}
+
+// recoverStore cleans up after a crash. Temp files whose contents are a
+// complete note replace a missing or damaged target, other temp files are
+// removed, and note files that no longer decode are quarantined.
+func (r *FileRepository) recoverStore() error {
+	dirs, err := r.noteDirs(r.layout(), "")
+	if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+	for _, dir := range dirs {
+		if err := r.recoverDir(dir); err != nil {
+			return err
+		}
+	}
 
-	query = strings.ToLower(query)
-	var results []*model.Note
-	for _, note := range notes {
-		if strings.Contains(strings.ToLower(note.Content), query) {
-			results = append(results, note)
+	// A note present both live and in the trash was caught mid-delete or
+	// mid-restore. Keep the live copy so it does not disappear from view.
+	trashed, err := r.listNotes(trashDir)
+	if err != nil {
+		return fmt.Errorf("failed to read trash directory: %w", err)
+	}
+	for _, file := range trashed {
+		if _, err := os.Stat(r.notePath(file.id)); err != nil {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil {
+			return fmt.Errorf("failed to remove duplicate trash entry %s: %w", file.entry.Name(), err)
+		}
+		rel, _ := filepath.Rel(r.dataDir, file.path)
+		r.recovery.Removed = append(r.recovery.Removed, rel)
+	}
+
+	if r.recovery.Empty() {
+		return nil
+	}
+	return r.syncNoteDirs("")
+}
+
+// recoverDir recovers the temp files and damaged notes in one directory of
+// live notes.
+func (r *FileRepository) recoverDir(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		target, ok := tempTarget(file.Name())
+		if !ok {
+			continue
+		}
+		tmpPath := filepath.Join(dir, file.Name())
+		targetPath := filepath.Join(dir, target)
+		rel, _ := filepath.Rel(r.dataDir, targetPath)
+
+		if r.isDamaged(targetPath) {
+			if !r.isDamaged(tmpPath) {
+				if err := os.Rename(tmpPath, targetPath); err != nil {
+					return fmt.Errorf("failed to restore %s: %w", target, err)
+				}
+				r.recovery.Recovered = append(r.recovery.Recovered, rel)
+				continue
+			}
+		}
+		if err := os.Remove(tmpPath); err != nil {
+			return fmt.Errorf("failed to remove temp file %s: %w", file.Name(), err)
+		}
+		tmpRel, _ := filepath.Rel(r.dataDir, tmpPath)
+		r.recovery.Removed = append(r.recovery.Removed, tmpRel)
+	}
+
+	// Re-read the directory since recovered temp files may have been
+	// renamed into place above.
+	files, err = os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+	for _, file := range files {
+		if !isNoteFile(file) {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		if !r.isDamaged(path) {
+			continue
+		}
+		if err := r.quarantine(path); err != nil {
+			return err
 		}
+		rel, _ := filepath.Rel(r.dataDir, path)
+		r.recovery.Quarantined = append(r.recovery.Quarantined, rel)
+	}
+	return nil
+}
+
+// quarantine moves a damaged file out of the way, keeping it for inspection.
+func (r *FileRepository) quarantine(path string) error {
+	dir := filepath.Join(r.dataDir, quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
 	}
-	return results, nil
+	dest := filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(path), time.Now().UnixNano()))
+	if err := os.Rename(path, dest); err != nil {
+		return fmt.Errorf("failed to quarantine %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func isNoteFile(file os.DirEntry) bool {
+	name := file.Name()
+	return !file.IsDir() && strings.HasSuffix(name, noteExt) && !strings.HasPrefix(name, ".")
+}
+
+func (r *FileRepository) readNote(path string) (*model.Note, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open note file: %w", err)
+	}
+	if data, err = r.open(path, data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt note: %w", err)
+	}
+
+	note, _, err := decodeNote(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode note: %w", err)
+	}
+	return note, nil
+}
+
+// marshalNote encodes a note for storage at path, encrypting it if the
+// store is encrypted.
+func (r *FileRepository) marshalNote(note *model.Note, path string) ([]byte, error) {
+	data, err := encodeNote(note)
+	if err != nil {
+		return nil, err
+	}
+	return r.seal(path, data)
+}
+
+// isDamaged reports whether a note file is unreadable or truncated. Notes
+// written with a newer schema or sealed while the store is locked are
+// intact, just not readable right now.
+func (r *FileRepository) isDamaged(path string) bool {
+	_, err := r.readNote(path)
+	return err != nil && !errors.Is(err, ErrUnsupportedSchema) && !errors.Is(err, ErrLocked)
 }
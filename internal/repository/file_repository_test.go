@@ -3,6 +3,7 @@ package repository
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -238,3 +239,235 @@ func TestSearch(t *testing.T) {
 		t.Errorf("Expected no results for 'banana' search, got: %d results", len(results))
 	}
 }
+
+func TestSaveLeavesNoTempFiles(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	for i := 0; i < 3; i++ {
+		if err := repo.Save(note); err != nil {
+			t.Fatalf("Failed to save note: %v", err)
+		}
+	}
+
+	files, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read data dir: %v", err)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), tempPrefix) {
+			t.Errorf("Found leftover temp file %s", file.Name())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, note.ID+".json")); err != nil {
+		t.Errorf("Expected note file: %v", err)
+	}
+}
+
+func TestRecoverStore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sticky-notes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer cleanupTestRepo(tempDir)
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// A crash after the temp file was synced but before the rename.
+	write("recovered.json", `{"id":"recov`)
+	write(".tmp-recovered.json-123", `{"id":"recovered","content":"new","color":"blue"}`)
+	// A crash while the temp file was still being written.
+	write("intact.json", `{"id":"intact","content":"old","color":"yellow"}`)
+	write(".tmp-intact.json-456", `{"id":"int`)
+	// A note truncated by an older, non-atomic write.
+	write("broken.json", `{"id":"bro`)
+
+	repo, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	report := repo.Recovery()
+	if len(report.Recovered) != 1 || len(report.Removed) != 1 || len(report.Quarantined) != 1 {
+		t.Fatalf("Unexpected recovery report: %+v", report)
+	}
+
+	note, err := repo.GetByID("recovered")
+	if err != nil {
+		t.Fatalf("Failed to get recovered note: %v", err)
+	}
+	if note.Content != "new" {
+		t.Errorf("Recovered note content mismatch, got: %s, want: new", note.Content)
+	}
+
+	note, err = repo.GetByID("intact")
+	if err != nil {
+		t.Fatalf("Failed to get intact note: %v", err)
+	}
+	if note.Content != "old" {
+		t.Errorf("Intact note content mismatch, got: %s, want: old", note.Content)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "broken.json")); !os.IsNotExist(err) {
+		t.Error("Expected broken note to be moved out of the data directory")
+	}
+	quarantined, err := os.ReadDir(filepath.Join(tempDir, quarantineDir))
+	if err != nil || len(quarantined) != 1 {
+		t.Errorf("Expected one quarantined file, got %d (%v)", len(quarantined), err)
+	}
+
+	notes, err := repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get all notes: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Errorf("Retrieved notes count mismatch, got: %d, want: 2", len(notes))
+	}
+}
+
+func TestCacheDetectsExternalChanges(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+
+	// Mutating a returned note must not leak into the cache.
+	retrieved, err := repo.GetByID(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get note: %v", err)
+	}
+	retrieved.Content = "mutated"
+
+	// Another process rewrites the note and adds a new one.
+	path := filepath.Join(tempDir, note.ID+".json")
+	if err := os.WriteFile(path, []byte(`{"id":"test-note-id","content":"edited elsewhere","color":"pink"}`), 0644); err != nil {
+		t.Fatalf("Failed to edit note file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "external.json"), []byte(`{"id":"external","content":"x","color":"blue"}`), 0644); err != nil {
+		t.Fatalf("Failed to add note file: %v", err)
+	}
+
+	notes, err := repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get all notes: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("Retrieved notes count mismatch, got: %d, want: 2", len(notes))
+	}
+	retrieved, err = repo.GetByID(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get note: %v", err)
+	}
+	if retrieved.Content != "edited elsewhere" {
+		t.Errorf("Expected external edit to be picked up, got: %s", retrieved.Content)
+	}
+
+	// And removes one.
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove note file: %v", err)
+	}
+	notes, err = repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get all notes: %v", err)
+	}
+	if len(notes) != 1 {
+		t.Errorf("Retrieved notes count mismatch, got: %d, want: 1", len(notes))
+	}
+	if _, err := repo.GetByID(note.ID); err == nil {
+		t.Error("Expected error when getting externally removed note, got nil")
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	for _, content := range []string{"v1", "v2"} {
+		rev := &model.Revision{NoteID: "note1", Content: content, Color: model.Yellow}
+		if err := repo.SaveRevision(rev); err != nil {
+			t.Fatalf("Failed to save revision: %v", err)
+		}
+	}
+
+	revisions, err := repo.GetRevisions("note1")
+	if err != nil {
+		t.Fatalf("Failed to get revisions: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Number != 1 || revisions[1].Content != "v2" {
+		t.Errorf("Unexpected revisions: %+v", revisions)
+	}
+
+	// Revision files must not show up as notes.
+	notes, err := repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get all notes: %v", err)
+	}
+	if len(notes) != 0 {
+		t.Errorf("Expected no notes, got: %d", len(notes))
+	}
+}
+
+func TestTrash(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	notes := []*model.Note{
+		{ID: "note1", Content: "content1", Color: model.Yellow},
+		{ID: "note2", Content: "content2", Color: model.Blue},
+		{ID: "note3", Content: "content3", Color: model.Green},
+	}
+	for _, note := range notes {
+		if err := repo.Save(note); err != nil {
+			t.Fatalf("Failed to save note: %v", err)
+		}
+		if err := repo.Delete(note.ID); err != nil {
+			t.Fatalf("Failed to delete note: %v", err)
+		}
+	}
+
+	trashed, err := repo.ListTrash()
+	if err != nil {
+		t.Fatalf("Failed to list trash: %v", err)
+	}
+	if len(trashed) != 3 || trashed[0].DeletedAt == nil {
+		t.Fatalf("Unexpected trash contents: %+v", trashed)
+	}
+	if all, _ := repo.GetAll(); len(all) != 0 {
+		t.Errorf("Expected trashed notes to be left out of GetAll, got: %d", len(all))
+	}
+	if results, _ := repo.Search("content"); len(results) != 0 {
+		t.Errorf("Expected trashed notes to be left out of Search, got: %d", len(results))
+	}
+
+	restored, err := repo.Restore("note1")
+	if err != nil {
+		t.Fatalf("Failed to restore note: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Error("Expected restored note to have no deletion time")
+	}
+	if _, err := repo.GetByID("note1"); err != nil {
+		t.Errorf("Failed to get restored note: %v", err)
+	}
+
+	if err := repo.Purge("note2"); err != nil {
+		t.Fatalf("Failed to purge note: %v", err)
+	}
+	if n, err := repo.PurgeBefore(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("Expected recent notes to survive retention, purged: %d (%v)", n, err)
+	}
+	if n, err := repo.EmptyTrash(); err != nil || n != 1 {
+		t.Errorf("Expected one note to be purged, got: %d (%v)", n, err)
+	}
+	if trashed, _ := repo.ListTrash(); len(trashed) != 0 {
+		t.Errorf("Expected empty trash, got: %d", len(trashed))
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// revisionsDir holds one JSON file per note listing its past versions.
+const revisionsDir = ".revisions"
+
+func (r *FileRepository) SaveRevision(rev *model.Revision) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	revisions, err := r.readRevisions(rev.NoteID)
+	if err != nil {
+		return err
+	}
+	saved := *rev
+	saved.Number = len(revisions) + 1
+	revisions = append(revisions, &saved)
+
+	data, err := json.Marshal(revisions)
+	if err != nil {
+		return fmt.Errorf("failed to encode revisions: %w", err)
+	}
+	if data, err = r.seal(r.revisionsPath(rev.NoteID), data); err != nil {
+		return fmt.Errorf("failed to encrypt revisions: %w", err)
+	}
+	if err := r.prepareDir(r.revisionsPath(rev.NoteID)); err != nil {
+		return fmt.Errorf("failed to create revisions directory: %w", err)
+	}
+	if err := writeFileAtomic(r.revisionsPath(rev.NoteID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write revisions: %w", err)
+	}
+	rev.Number = saved.Number
+	return nil
+}
+
+func (r *FileRepository) GetRevisions(noteID string) ([]*model.Revision, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	return r.readRevisions(noteID)
+}
+
+func (r *FileRepository) readRevisions(noteID string) ([]*model.Revision, error) {
+	data, err := os.ReadFile(r.revisionsPath(noteID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revisions: %w", err)
+	}
+	if data, err = r.open(r.revisionsPath(noteID), data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt revisions: %w", err)
+	}
+
+	var revisions []*model.Revision
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return nil, fmt.Errorf("failed to decode revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+func (r *FileRepository) revisionsPath(noteID string) string {
+	return r.pathIn(r.layout(), revisionsDir, noteID)
+}
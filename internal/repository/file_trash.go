@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// trashDir holds deleted notes until they are restored or purged.
+const trashDir = ".trash"
+
+func (r *FileRepository) ListTrash() ([]*model.Note, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	return r.readTrash()
+}
+
+func (r *FileRepository) Restore(id string) (*model.Note, error) {
+	if err := r.lock(); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+
+	note, err := r.readNote(r.trashPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find note in trash: %w", err)
+	}
+	if _, err := os.Stat(r.notePath(id)); err == nil {
+		return nil, fmt.Errorf("failed to restore note: note %s already exists", id)
+	}
+	note.DeletedAt = nil
+
+	data, err := r.marshalNote(note, r.notePath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode note: %w", err)
+	}
+	if err := r.prepareDir(r.notePath(id)); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(r.notePath(id), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to restore note: %w", err)
+	}
+	r.track(r.notePath(id))
+	if err := r.removeTrashed(id); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+func (r *FileRepository) Purge(id string) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	if _, err := os.Stat(r.trashPath(id)); err != nil {
+		return fmt.Errorf("failed to find note in trash: %w", err)
+	}
+	return r.purge(id)
+}
+
+func (r *FileRepository) PurgeBefore(cutoff time.Time) (int, error) {
+	return r.purgeWhere(func(note *model.Note) bool {
+		return note.DeletedAt == nil || note.DeletedAt.Before(cutoff)
+	})
+}
+
+func (r *FileRepository) EmptyTrash() (int, error) {
+	return r.purgeWhere(func(*model.Note) bool { return true })
+}
+
+func (r *FileRepository) purgeWhere(match func(*model.Note) bool) (int, error) {
+	if err := r.lock(); err != nil {
+		return 0, err
+	}
+	defer r.unlock()
+
+	notes, err := r.readTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, note := range notes {
+		if !match(note) {
+			continue
+		}
+		if err := r.purge(note.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purge removes a trashed note together with its revision history.
+func (r *FileRepository) purge(id string) error {
+	if err := r.removeTrashed(id); err != nil {
+		return err
+	}
+	if err := os.Remove(r.revisionsPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove revisions: %w", err)
+	}
+	return nil
+}
+
+func (r *FileRepository) writeTrashed(note *model.Note) error {
+	data, err := r.marshalNote(note, r.trashPath(note.ID))
+	if err != nil {
+		return fmt.Errorf("failed to encode note: %w", err)
+	}
+	if err := r.prepareDir(r.trashPath(note.ID)); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	return writeFileAtomic(r.trashPath(note.ID), data, 0644)
+}
+
+func (r *FileRepository) removeTrashed(id string) error {
+	if err := os.Remove(r.trashPath(id)); err != nil {
+		return fmt.Errorf("failed to remove note from trash: %w", err)
+	}
+	return syncDir(filepath.Dir(r.trashPath(id)))
+}
+
+func (r *FileRepository) readTrash() ([]*model.Note, error) {
+	files, err := r.listNotes(trashDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash directory: %w", err)
+	}
+
+	var notes []*model.Note
+	for _, file := range files {
+		note, err := r.readNote(file.path)
+		if err != nil {
+			continue
+		}
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+func (r *FileRepository) trashPath(id string) string {
+	return r.pathIn(r.layout(), trashDir, id)
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// journalFile records a transaction while it is being applied. It is
+// written before any note is touched and removed once all of them are, so
+// finding one at startup means a commit was interrupted.
+const journalFile = ".journal.json"
+
+type journal struct {
+	Version int            `json:"version"`
+	Time    time.Time      `json:"time"`
+	Entries []journalEntry `json:"entries"`
+}
+
+// journalEntry is one file changed by a transaction. Before holds the old
+// contents for rolling back and After the new ones for rolling forward.
+type journalEntry struct {
+	// Path is relative to the data directory, with forward slashes.
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`
+	Before  []byte `json:"before,omitempty"`
+	After   []byte `json:"after,omitempty"`
+	Remove  bool   `json:"remove,omitempty"`
+}
+
+// Begin starts a transaction. Deleted notes go to the trash as with Delete.
+func (r *FileRepository) Begin() (Tx, error) {
+	return &stagedTx{commit: r.commitTx}, nil
+}
+
+// commitTx journals the transaction and then applies it. If applying fails
+// the changes made so far are rolled back; if the process dies instead,
+// the next NewFileRepository rolls the journal forward.
+func (r *FileRepository) commitTx(ops []txOp) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	changes, err := resolveTx(ops, func(id string) (*model.Note, error) {
+		note, err := r.readNote(r.notePath(id))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return note, err
+	})
+	if err != nil {
+		return err
+	}
+
+	j := &journal{Version: 1, Time: time.Now()}
+	for _, change := range changes {
+		r.cacheEvict(change.id)
+		if change.note != nil {
+			data, err := r.marshalNote(change.note, r.notePath(change.id))
+			if err != nil {
+				return fmt.Errorf("failed to encode note: %w", err)
+			}
+			j.Entries = append(j.Entries, journalEntry{Path: r.journalPath(r.notePath(change.id)), After: data})
+			continue
+		}
+		// As in Delete, the trashed copy is written before the note is
+		// removed.
+		if change.deleted != nil {
+			data, err := r.marshalNote(change.deleted, r.trashPath(change.id))
+			if err != nil {
+				return fmt.Errorf("failed to encode note: %w", err)
+			}
+			j.Entries = append(j.Entries, journalEntry{Path: r.journalPath(r.trashPath(change.id)), After: data})
+		}
+		j.Entries = append(j.Entries, journalEntry{Path: r.journalPath(r.notePath(change.id)), Remove: true})
+	}
+	for i := range j.Entries {
+		entry := &j.Entries[i]
+		data, err := os.ReadFile(r.journalTarget(entry.Path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read %s: %w", entry.Path, err)
+		}
+		entry.Existed = err == nil
+		entry.Before = data
+	}
+
+	if err := r.writeJournal(j); err != nil {
+		return err
+	}
+	for i, entry := range j.Entries {
+		if err := r.applyEntry(entry.Path, entry.Remove, entry.After); err != nil {
+			if rbErr := r.rollbackEntries(j.Entries[:i+1]); rbErr != nil {
+				return fmt.Errorf("failed to commit transaction: %w (rollback failed too, the transaction will be completed on next open: %v)", err, rbErr)
+			}
+			return fmt.Errorf("failed to commit transaction, rolled back: %w", err)
+		}
+	}
+	return r.removeJournal()
+}
+
+// replayJournal finishes a commit interrupted by a crash. The journal holds
+// every new file in full, so the transaction is rolled forward.
+func (r *FileRepository) replayJournal() error {
+	data, err := os.ReadFile(filepath.Join(r.dataDir, journalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read transaction journal: %w", err)
+	}
+
+	var j journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		// The journal is written atomically, so this is not a torn write;
+		// keep it for inspection rather than guess.
+		if err := r.quarantine(filepath.Join(r.dataDir, journalFile)); err != nil {
+			return err
+		}
+		r.recovery.Quarantined = append(r.recovery.Quarantined, journalFile)
+		return nil
+	}
+	for _, entry := range j.Entries {
+		if err := r.applyEntry(entry.Path, entry.Remove, entry.After); err != nil {
+			return fmt.Errorf("failed to replay transaction: %w", err)
+		}
+		r.recovery.Replayed = append(r.recovery.Replayed, filepath.FromSlash(entry.Path))
+	}
+	return r.removeJournal()
+}
+
+func (r *FileRepository) rollbackEntries(entries []journalEntry) error {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if err := r.applyEntry(entry.Path, !entry.Existed, entry.Before); err != nil {
+			return err
+		}
+	}
+	return r.removeJournal()
+}
+
+// applyEntry writes data to a journaled path, or removes the file.
+func (r *FileRepository) applyEntry(rel string, remove bool, data []byte) error {
+	target := r.journalTarget(rel)
+	defer r.track(target)
+	if remove {
+		if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", rel, err)
+		}
+		return syncDir(filepath.Dir(target))
+	}
+	if err := r.prepareDir(target); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(target, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", rel, err)
+	}
+	return nil
+}
+
+// journalPath returns how the journal refers to a file in the data
+// directory.
+func (r *FileRepository) journalPath(path string) string {
+	rel, _ := filepath.Rel(r.dataDir, path)
+	return filepath.ToSlash(rel)
+}
+
+func (r *FileRepository) journalTarget(rel string) string {
+	return filepath.Join(r.dataDir, filepath.FromSlash(rel))
+}
+
+func (r *FileRepository) writeJournal(j *journal) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to encode transaction journal: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(r.dataDir, journalFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write transaction journal: %w", err)
+	}
+	return nil
+}
+
+func (r *FileRepository) removeJournal() error {
+	if err := os.Remove(filepath.Join(r.dataDir, journalFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove transaction journal: %w", err)
+	}
+	return syncDir(r.dataDir)
+}
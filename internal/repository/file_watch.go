@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// DefaultWatchInterval is how often a polling watcher rescans the data
+// directory.
+const DefaultWatchInterval = 2 * time.Second
+
+type ChangeKind string
+
+const (
+	ChangeCreated  ChangeKind = "created"
+	ChangeModified ChangeKind = "modified"
+	ChangeRemoved  ChangeKind = "removed"
+	// ChangeInvalid is a note file that was changed but cannot be read or
+	// fails validation. Readers skip it until it is fixed.
+	ChangeInvalid ChangeKind = "invalid"
+)
+
+// ExternalChange is a change to a note file made by something other than
+// this repository: an editor, a sync tool or another process.
+type ExternalChange struct {
+	Kind   ChangeKind
+	NoteID string
+	// Path is relative to the data directory.
+	Path string
+	// Before is the last valid version the watcher knew, if any. After is
+	// the new version, nil when the file was removed or is invalid.
+	Before *model.Note
+	After  *model.Note
+	// Err says why an invalid file was rejected.
+	Err error
+}
+
+type WatchOptions struct {
+	// Poll rescans the directory every Interval instead of relying on
+	// change notifications from the operating system.
+	Poll     bool
+	Interval time.Duration
+}
+
+// WatchRepository is implemented by backends whose data can be changed by
+// other programs.
+type WatchRepository interface {
+	Watch(opts WatchOptions) (*Watcher, error)
+}
+
+// Watcher delivers external changes to a FileRepository's notes.
+type Watcher struct {
+	repo    *FileRepository
+	source  dirWatcher
+	polling bool
+	ch      chan ExternalChange
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// knownFile is a note file as the watcher last saw it.
+type knownFile struct {
+	modTime time.Time
+	size    int64
+	// note is the last valid version of the note, or nil.
+	note *model.Note
+}
+
+func (k knownFile) matches(info os.FileInfo) bool {
+	return k.size == info.Size() && k.modTime.Equal(info.ModTime())
+}
+
+// Watch starts watching the data directory for note files that are
+// created, modified or removed by other programs. Changed files are read
+// and validated, the cache is updated, and the change is delivered on
+// Changes. Writes made through this repository are not reported. Only one
+// watcher can run at a time.
+func (r *FileRepository) Watch(opts WatchOptions) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	r.watchMutex.Lock()
+	defer r.watchMutex.Unlock()
+	if r.known != nil {
+		return nil, fmt.Errorf("data directory is already being watched")
+	}
+
+	var source dirWatcher
+	polling := opts.Poll
+	if !polling {
+		native, err := newNativeWatcher(r.dataDir)
+		if err != nil {
+			polling = true
+		} else {
+			source = native
+		}
+	}
+	if polling {
+		source = newPollWatcher(opts.Interval)
+	}
+
+	// Everything already in the directory is the starting point; only
+	// later changes are reported.
+	files, err := r.listNotes("")
+	if err != nil {
+		source.close()
+		return nil, err
+	}
+	r.known = make(map[string]knownFile)
+	for _, file := range files {
+		r.trackLocked(file.id)
+	}
+
+	w := &Watcher{
+		repo:    r,
+		source:  source,
+		polling: polling,
+		ch:      make(chan ExternalChange),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Changes returns the channel changes are delivered on. It is closed when
+// the watcher stops.
+func (w *Watcher) Changes() <-chan ExternalChange {
+	return w.ch
+}
+
+// Polling reports whether the watcher rescans the directory periodically
+// because change notifications are unavailable.
+func (w *Watcher) Polling() bool {
+	return w.polling
+}
+
+// Close stops the watcher.
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+	close(w.done)
+	err := w.source.close()
+	<-w.stopped
+
+	w.repo.watchMutex.Lock()
+	w.repo.known = nil
+	w.repo.watchMutex.Unlock()
+	return err
+}
+
+func (w *Watcher) run() {
+	defer close(w.stopped)
+	defer close(w.ch)
+
+	for {
+		var batch watchBatch
+		select {
+		case b, ok := <-w.source.changes():
+			if !ok {
+				return
+			}
+			batch = b
+		case <-w.done:
+			return
+		}
+
+		changes, err := w.repo.inspect(batch)
+		if err != nil {
+			// The lock could not be taken; the next batch or poll will
+			// pick up what was missed here.
+			continue
+		}
+		for _, change := range changes {
+			select {
+			case w.ch <- change:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// inspect compares the files in a batch, or every note file if it asks
+// for a rescan, with what the watcher last saw and returns the changes.
+// Names are paths relative to the data directory; only the note ID they
+// contain matters, so a file moved by a layout change is not reported. It
+// holds the read lock, so a write by this process is either finished and
+// tracked or not started yet.
+func (r *FileRepository) inspect(batch watchBatch) ([]ExternalChange, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	r.watchMutex.Lock()
+	defer r.watchMutex.Unlock()
+	if r.known == nil {
+		return nil, nil
+	}
+
+	var ids []string
+	if batch.rescan {
+		files, err := r.listNotes("")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			ids = append(ids, file.id)
+		}
+		for id := range r.known {
+			ids = append(ids, id)
+		}
+	}
+	ids = append(ids, watchedIDs(batch.names)...)
+	// Files that were only found are looked at last, so one that is also
+	// named as complete is held to that.
+	complete := len(ids)
+	ids = append(ids, watchedIDs(batch.found)...)
+
+	var changes []ExternalChange
+	seen := make(map[string]bool)
+	for i, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if change := r.inspectFile(id, i >= complete); change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	return changes, nil
+}
+
+// watchedIDs returns the IDs of the note files among names.
+func watchedIDs(names []string) []string {
+	var ids []string
+	for _, name := range names {
+		if base := filepath.Base(name); isNoteName(base) {
+			ids = append(ids, strings.TrimSuffix(base, noteExt))
+		}
+	}
+	return ids
+}
+
+// inspectFile compares a note file with what the watcher last saw. A file
+// that was only found, and may still be being written, is not reported
+// when it cannot be read.
+func (r *FileRepository) inspectFile(id string, found bool) *ExternalChange {
+	path := r.notePath(id)
+	name, _ := filepath.Rel(r.dataDir, path)
+	prev, tracked := r.known[id]
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if !tracked {
+			return nil
+		}
+		delete(r.known, id)
+		r.cacheEvict(id)
+		if prev.note == nil {
+			return nil
+		}
+		return &ExternalChange{Kind: ChangeRemoved, NoteID: id, Path: name, Before: cloneNote(prev.note)}
+	}
+	if tracked && prev.matches(info) {
+		return nil
+	}
+
+	note, err := r.readNote(path)
+	if err != nil && found {
+		return nil
+	}
+	if errors.Is(err, ErrLocked) {
+		// Nothing can be said about the contents until the store is
+		// unlocked.
+		r.known[id] = knownFile{modTime: info.ModTime(), size: info.Size(), note: prev.note}
+		return nil
+	}
+	if err == nil {
+		if kinds := noteProblems(note, id); len(kinds) > 0 {
+			err = errors.New(problemMessage(kinds[0], note, name))
+		}
+	}
+	if err != nil {
+		r.known[id] = knownFile{modTime: info.ModTime(), size: info.Size(), note: prev.note}
+		r.cacheEvict(id)
+		return &ExternalChange{
+			Kind:   ChangeInvalid,
+			NoteID: id,
+			Path:   name,
+			Before: cloneNote(prev.note),
+			Err:    fmt.Errorf("invalid note file %s: %w", name, err),
+		}
+	}
+
+	r.known[id] = knownFile{modTime: info.ModTime(), size: info.Size(), note: note}
+	r.cacheStore(id, cloneNote(note), info)
+	kind := ChangeModified
+	if prev.note == nil {
+		kind = ChangeCreated
+	}
+	return &ExternalChange{Kind: kind, NoteID: id, Path: name, Before: cloneNote(prev.note), After: cloneNote(note)}
+}
+
+// track records the state this repository left a file in, so the watcher
+// does not report the repository's own writes. It must be called with the
+// write lock held, after the file was written or removed.
+func (r *FileRepository) track(path string) {
+	base := filepath.Base(path)
+	if !isNoteName(base) {
+		return
+	}
+	id := strings.TrimSuffix(base, noteExt)
+	if r.notePath(id) != path {
+		// Trashed notes and revisions are not watched.
+		return
+	}
+	r.watchMutex.Lock()
+	defer r.watchMutex.Unlock()
+	if r.known != nil {
+		r.trackLocked(id)
+	}
+}
+
+func (r *FileRepository) trackLocked(id string) {
+	path := r.notePath(id)
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(r.known, id)
+		return
+	}
+	known := knownFile{modTime: info.ModTime(), size: info.Size()}
+	if note, err := r.readNote(path); err == nil {
+		known.note = note
+	}
+	r.known[id] = known
+}
+
+// isNoteName reports whether a file name is that of a note file.
+func isNoteName(name string) bool {
+	return strings.HasSuffix(name, noteExt) && !strings.HasPrefix(name, ".")
+}
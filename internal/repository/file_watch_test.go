@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func nextChange(t *testing.T, w *Watcher) ExternalChange {
+	t.Helper()
+	select {
+	case change := <-w.Changes():
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a change")
+	}
+	return ExternalChange{}
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name string
+		opts WatchOptions
+	}{
+		{name: "native", opts: WatchOptions{}},
+		{name: "polling", opts: WatchOptions{Poll: true, Interval: 20 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, tempDir := setupTestRepo(t)
+			defer cleanupTestRepo(tempDir)
+
+			existing := &model.Note{ID: "existing", Content: "existing", Color: model.Yellow}
+			if err := repo.Save(existing); err != nil {
+				t.Fatalf("Failed to save note: %v", err)
+			}
+			w, err := repo.Watch(tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to watch: %v", err)
+			}
+			defer w.Close()
+			if _, err := repo.Watch(tt.opts); err == nil {
+				t.Error("Expected a second watcher to be refused")
+			}
+
+			// Writes through the repository are not reported, so the first
+			// change seen must be the external one.
+			repo.Save(&model.Note{ID: "own", Content: "own", Color: model.Blue})
+			repo.Delete("own")
+
+			external := &model.Note{ID: "external", Content: "by hand", Color: model.Green,
+				CreatedAt: time.Now(), UpdatedAt: time.Now()}
+			data, _ := encodeNote(external)
+			if err := os.WriteFile(filepath.Join(tempDir, "external.json"), data, 0644); err != nil {
+				t.Fatalf("Failed to write note: %v", err)
+			}
+			change := nextChange(t, w)
+			if change.Kind != ChangeCreated || change.NoteID != "external" || change.After.Content != "by hand" {
+				t.Fatalf("Unexpected change: %+v", change)
+			}
+			if note, err := repo.GetById("external"); err != nil || note.Content != "by hand" {
+				t.Errorf("Expected the new note to be readable: %+v (%v)", note, err)
+			}
+
+			existing.Content = "edited"
+			existing.Color = "light blue"
+			data, _ = encodeNote(existing)
+			os.WriteFile(filepath.Join(tempDir, "existing.json"), data, 0644)
+			change = nextChange(t, w)
+			if change.Kind != ChangeInvalid || change.Err == nil || change.Before.Content != "existing" {
+				t.Fatalf("Expected an invalid change keeping the old note, got: %+v", change)
+			}
+
+			existing.Color = model.Pink
+			data, _ = encodeNote(existing)
+			os.WriteFile(filepath.Join(tempDir, "existing.json"), data, 0644)
+			change = nextChange(t, w)
+			if change.Kind != ChangeModified || change.Before.Content != "existing" || change.After.Content != "edited" {
+				t.Fatalf("Unexpected change: %+v", change)
+			}
+
+			os.Remove(filepath.Join(tempDir, "external.json"))
+			change = nextChange(t, w)
+			if change.Kind != ChangeRemoved || change.NoteID != "external" || change.Before == nil {
+				t.Fatalf("Unexpected change: %+v", change)
+			}
+
+			if err := w.Close(); err != nil {
+				t.Errorf("Failed to close watcher: %v", err)
+			}
+			if _, ok := <-w.Changes(); ok {
+				t.Error("Expected the channel to be closed")
+			}
+		})
+	}
+}
+
+func TestWatchRescan(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	// A rescan, asked for when notifications were lost, looks at every
+	// file.
+	repo.watchMutex.Lock()
+	repo.known = make(map[string]knownFile)
+	repo.watchMutex.Unlock()
+	data, _ := encodeNote(&model.Note{ID: "quiet", Content: "quiet", Color: model.Yellow})
+	os.WriteFile(filepath.Join(tempDir, "quiet.json"), data, 0644)
+
+	changes, err := repo.inspect(watchBatch{rescan: true})
+	if err != nil {
+		t.Fatalf("Failed to rescan: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != ChangeCreated {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"iter"
+	"strings"
+	"sync"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// Collect gathers the notes of a sequence into a slice, stopping at the
+// first error.
+func Collect(seq iter.Seq2[*model.Note, error]) ([]*model.Note, error) {
+	var notes []*model.Note
+	for note, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+// containing keeps the notes of seq whose content contains query, ignoring
+// case. Errors are passed through.
+func containing(seq iter.Seq2[*model.Note, error], query string) iter.Seq2[*model.Note, error] {
+	query = strings.ToLower(query)
+	return func(yield func(*model.Note, error) bool) {
+		for note, err := range seq {
+			if err == nil && !strings.Contains(strings.ToLower(note.Text()), query) {
+				continue
+			}
+			if !yield(note, err) {
+				return
+			}
+		}
+	}
+}
+
+// streamMap yields clones of the notes in an in-memory map, oldest first.
+// The lock is only held while taking the snapshot and while copying each
+// note, so the caller may write to the repository during iteration.
+func streamMap(mutex *sync.RWMutex, notes map[string]*model.Note) iter.Seq2[*model.Note, error] {
+	return func(yield func(*model.Note, error) bool) {
+		mutex.RLock()
+		snapshot := make([]*model.Note, 0, len(notes))
+		for _, note := range notes {
+			snapshot = append(snapshot, note)
+		}
+		mutex.RUnlock()
+		sortNotes(snapshot)
+
+		for _, note := range snapshot {
+			mutex.RLock()
+			clone := cloneNote(note)
+			mutex.RUnlock()
+			if !yield(clone, nil) {
+				return
+			}
+		}
+	}
+}
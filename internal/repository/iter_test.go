@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestAllStreamsNotes(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+	memory := NewMemoryRepository()
+
+	for i := 0; i < 5; i++ {
+		note := &model.Note{
+			ID:        fmt.Sprintf("note%d", i),
+			Content:   fmt.Sprintf("content %d", i),
+			Color:     model.Yellow,
+			CreatedAt: time.Now().Add(time.Duration(i) * time.Second),
+			UpdatedAt: time.Now(),
+		}
+		for _, r := range []NoteRepository{repo, memory} {
+			if err := r.Save(note); err != nil {
+				t.Fatalf("Failed to save note: %v", err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatalf("Failed to write broken note: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		repo NoteRepository
+	}{
+		{name: "file", repo: repo},
+		{name: "memory", repo: memory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all, err := Collect(tt.repo.All())
+			if err != nil {
+				t.Fatalf("Failed to collect notes: %v", err)
+			}
+			if len(all) != 5 {
+				t.Errorf("Streamed notes count mismatch, got: %d, want: 5", len(all))
+			}
+
+			// Stopping early must not leave anything locked, and writing
+			// during iteration must not deadlock.
+			seen := 0
+			for note, err := range tt.repo.All() {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				note.Content = "changed"
+				if err := tt.repo.Update(note); err != nil {
+					t.Fatalf("Failed to update note during iteration: %v", err)
+				}
+				seen++
+				if seen == 2 {
+					break
+				}
+			}
+			if seen != 2 {
+				t.Errorf("Expected to stop after two notes, got: %d", seen)
+			}
+
+			matches, err := Collect(tt.repo.SearchSeq("CONTENT 4"))
+			if err != nil {
+				t.Fatalf("Failed to search notes: %v", err)
+			}
+			if len(matches) != 1 || matches[0].ID != "note4" {
+				t.Errorf("Unexpected search results: %+v", matches)
+			}
+		})
+	}
+
+	if warnings := repo.Warnings(); len(warnings) != 1 {
+		t.Errorf("Expected the broken note to be reported, got: %v", warnings)
+	}
+}
+
+func TestAllFillsCache(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	repo, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	if results, err := repo.Search("test"); err != nil || len(results) != 1 {
+		t.Fatalf("Expected one result, got: %d (%v)", len(results), err)
+	}
+
+	// Rewrite the file behind the repository's back without changing its
+	// size or time: a search served from the cache does not notice.
+	path := repo.notePath(note.ID)
+	info, _ := os.Stat(path)
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, bytes.Replace(data, []byte("test content"), []byte("best content"), 1), 0644); err != nil {
+		t.Fatalf("Failed to rewrite note: %v", err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("Failed to reset file time: %v", err)
+	}
+	if results, err := repo.Search("test content"); err != nil || len(results) != 1 {
+		t.Errorf("Expected the search to use the cached note, got: %d (%v)", len(results), err)
+	}
+}
+
+func TestCollectStopsAtError(t *testing.T) {
+	seq := iter.Seq2[*model.Note, error](func(yield func(*model.Note, error) bool) {
+		if !yield(createTestNote(), nil) {
+			return
+		}
+		if !yield(nil, ErrLocked) {
+			return
+		}
+		t.Error("Collect should stop at the first error")
+	})
+
+	if _, err := Collect(seq); err != ErrLocked {
+		t.Errorf("Expected ErrLocked, got: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultLockTimeout is how long an operation waits for another process to
+// release the data directory before giving up.
+const DefaultLockTimeout = 10 * time.Second
+
+// lockFile is the file other processes lock to coordinate access to the
+// data directory. The last exclusive holder records itself in it.
+const lockFile = ".lock"
+
+// LockHolder identifies the process that last took the exclusive lock.
+type LockHolder struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+// LockError is returned when the data directory stays locked by another
+// process for longer than the lock timeout.
+type LockError struct {
+	Exclusive bool
+	Timeout   time.Duration
+	// Holder is the last recorded exclusive holder, if any.
+	Holder *LockHolder
+	// Stale is set when the recorded holder is no longer running, meaning
+	// the lock is held by a process that did not record itself, such as a
+	// reader.
+	Stale bool
+}
+
+func (e *LockError) Error() string {
+	mode := "shared"
+	if e.Exclusive {
+		mode = "exclusive"
+	}
+	msg := fmt.Sprintf("timed out after %s waiting for %s lock on data directory", e.Timeout, mode)
+	switch {
+	case e.Holder == nil:
+		return msg + ": held by another process"
+	case e.Stale:
+		return fmt.Sprintf("%s: held by another process (stale record of pid %d, which is no longer running)", msg, e.Holder.PID)
+	default:
+		return fmt.Sprintf("%s: held by pid %d (%s on %s, since %s)", msg, e.Holder.PID,
+			e.Holder.Command, e.Holder.Host, e.Holder.Since.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// dirLock is an advisory lock on the data directory shared between
+// processes. Within a process, callers serialize writers themselves; shared
+// holders are counted so the OS lock is only released by the last one.
+type dirLock struct {
+	path    string
+	file    *os.File
+	timeout time.Duration
+
+	mutex   sync.Mutex
+	readers int
+}
+
+func openDirLock(dataDir string) (*dirLock, error) {
+	path := filepath.Join(dataDir, lockFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return &dirLock{path: path, file: file, timeout: DefaultLockTimeout}, nil
+}
+
+func (l *dirLock) lockShared() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.readers == 0 {
+		if err := l.acquire(false); err != nil {
+			return err
+		}
+	}
+	l.readers++
+	return nil
+}
+
+func (l *dirLock) unlockShared() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.readers--
+	if l.readers == 0 {
+		unlockFile(l.file)
+	}
+}
+
+func (l *dirLock) lock() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.acquire(true); err != nil {
+		return err
+	}
+	l.recordHolder()
+	return nil
+}
+
+func (l *dirLock) unlock() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	unlockFile(l.file)
+}
+
+func (l *dirLock) close() error {
+	return l.file.Close()
+}
+
+// acquire polls for the OS lock with backoff until the timeout expires.
+func (l *dirLock) acquire(exclusive bool) error {
+	deadline := time.Now().Add(l.timeout)
+	wait := 5 * time.Millisecond
+	for {
+		ok, err := tryLockFile(l.file, exclusive)
+		if err != nil {
+			return fmt.Errorf("failed to lock data directory: %w", err)
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return l.timeoutError(exclusive)
+		}
+		time.Sleep(wait)
+		wait = min(wait*2, 200*time.Millisecond)
+	}
+}
+
+func (l *dirLock) recordHolder() {
+	host, _ := os.Hostname()
+	holder := LockHolder{
+		PID:     os.Getpid(),
+		Host:    host,
+		Command: filepath.Base(os.Args[0]),
+		Since:   time.Now(),
+	}
+	data, err := json.Marshal(holder)
+	if err != nil {
+		return
+	}
+	// Best effort: the record only serves error messages.
+	if l.file.Truncate(0) == nil {
+		l.file.WriteAt(data, 0)
+	}
+}
+
+func (l *dirLock) timeoutError(exclusive bool) error {
+	lockErr := &LockError{Exclusive: exclusive, Timeout: l.timeout}
+	data, err := os.ReadFile(l.path)
+	if err != nil || len(data) == 0 {
+		return lockErr
+	}
+	var holder LockHolder
+	if json.Unmarshal(data, &holder) != nil || holder.PID == 0 {
+		return lockErr
+	}
+	lockErr.Holder = &holder
+	host, _ := os.Hostname()
+	lockErr.Stale = holder.Host == host && !processAlive(holder.PID)
+	return lockErr
+}
@@ -0,0 +1,48 @@
+//go:build !unix
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Without flock(2) the lock is a pid file created next to the lock file.
+// Readers and writers both take it exclusively, and a pid file left behind
+// by a process that is no longer running is treated as stale and removed.
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	path := file.Name() + ".pid"
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		data, readErr := os.ReadFile(path)
+		pid, parseErr := strconv.Atoi(strings.TrimSpace(string(data)))
+		if readErr == nil && parseErr == nil && !processAlive(pid) {
+			os.Remove(path)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%d", os.Getpid())
+	return err == nil, err
+}
+
+func unlockFile(file *os.File) {
+	os.Remove(file.Name() + ".pid")
+}
+
+func processAlive(pid int) bool {
+	// On Windows FindProcess fails for processes that no longer exist.
+	// Elsewhere it always succeeds and the holder is assumed to be running.
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrossProcessLocking(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+	defer repo.Close()
+
+	// A second repository on the same directory has its own lock file
+	// descriptor and so contends like another process would.
+	other, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to open second repository: %v", err)
+	}
+	defer other.Close()
+	other.SetLockTimeout(50 * time.Millisecond)
+
+	if err := repo.Save(createTestNote()); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+
+	// Readers share the lock.
+	if err := repo.rlock(); err != nil {
+		t.Fatalf("Failed to take shared lock: %v", err)
+	}
+	if _, err := other.GetAll(); err != nil {
+		t.Errorf("Expected concurrent reads to succeed, got: %v", err)
+	}
+	// Writers wait for readers.
+	err = other.Save(createTestNote())
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || !lockErr.Exclusive {
+		t.Errorf("Expected exclusive LockError while a reader holds the lock, got: %v", err)
+	}
+	repo.runlock()
+
+	// Readers wait for writers, and are told who holds the lock.
+	if err := repo.lock(); err != nil {
+		t.Fatalf("Failed to take exclusive lock: %v", err)
+	}
+	_, err = other.GetAll()
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("Expected LockError while a writer holds the lock, got: %v", err)
+	}
+	if lockErr.Holder == nil || lockErr.Holder.PID != os.Getpid() || lockErr.Stale {
+		t.Errorf("Expected lock holder to be this process, got: %+v", lockErr.Holder)
+	}
+	repo.unlock()
+
+	if _, err := other.GetAll(); err != nil {
+		t.Errorf("Expected read to succeed once the lock is released, got: %v", err)
+	}
+}
+
+func TestLockErrorStaleHolder(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+	defer repo.Close()
+
+	other, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to open second repository: %v", err)
+	}
+	defer other.Close()
+	other.SetLockTimeout(20 * time.Millisecond)
+
+	// The last writer crashed and a reader now holds the lock.
+	host, _ := os.Hostname()
+	record := fmt.Sprintf(`{"pid":%d,"host":%q,"command":"sticky-notes"}`, math.MaxInt32, host)
+	if err := os.WriteFile(filepath.Join(tempDir, lockFile), []byte(record), 0644); err != nil {
+		t.Fatalf("Failed to write lock record: %v", err)
+	}
+	if err := repo.rlock(); err != nil {
+		t.Fatalf("Failed to take shared lock: %v", err)
+	}
+	defer repo.runlock()
+
+	err = other.Save(createTestNote())
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || !lockErr.Stale {
+		t.Fatalf("Expected stale LockError, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "no longer running") {
+		t.Errorf("Expected message to mention the stale holder, got: %s", err)
+	}
+}
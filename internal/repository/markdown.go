@@ -0,0 +1,420 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+const (
+	markdownExt = ".md"
+	// frontMatterDelim opens and closes the front matter block.
+	frontMatterDelim = "---"
+	// maxSlugLength caps the part of a file name taken from the title.
+	maxSlugLength = 48
+)
+
+// markdownDateLayouts are the timestamp formats accepted in hand-written
+// front matter. Notes are always written with the first.
+var markdownDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// encodeMarkdown writes a note as front matter followed by its content,
+// which for a checklist is its title and "- [ ]" items. A newline is added
+// after the content, so files end the way editors expect;
+// decodeMarkdown removes it again.
+func encodeMarkdown(note *model.Note) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(frontMatterDelim + "\n")
+	writeField(&buf, "id", note.ID)
+	if note.Kind != model.KindText {
+		writeField(&buf, "kind", string(note.Kind))
+	}
+	writeField(&buf, "color", string(note.Color))
+	writeField(&buf, "version", strconv.FormatInt(note.Version, 10))
+	if len(note.Tags) > 0 {
+		// Normalized tags never need quoting.
+		fmt.Fprintf(&buf, "tags: [%s]\n", strings.Join(note.Tags, ", "))
+	}
+	if g := note.Geometry; g != nil {
+		writeField(&buf, "board", g.Board)
+		fmt.Fprintf(&buf, "position: %d, %d\n", g.X, g.Y)
+		fmt.Fprintf(&buf, "size: %dx%d\n", g.Width, g.Height)
+		fmt.Fprintf(&buf, "z: %d\n", g.Z)
+	}
+	writeTimeField(&buf, "due_at", note.DueAt)
+	writeTimeField(&buf, "remind_at", note.RemindAt)
+	writeTimeField(&buf, "reminded_at", note.RemindedAt)
+	writeField(&buf, "created_at", note.CreatedAt.Format(time.RFC3339Nano))
+	writeField(&buf, "updated_at", note.UpdatedAt.Format(time.RFC3339Nano))
+	if note.DeletedAt != nil {
+		writeField(&buf, "deleted_at", note.DeletedAt.Format(time.RFC3339Nano))
+	}
+	buf.WriteString(frontMatterDelim + "\n")
+	buf.WriteString(note.Text())
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func writeTimeField(buf *bytes.Buffer, key string, t *time.Time) {
+	if t != nil {
+		writeField(buf, key, t.Format(time.RFC3339Nano))
+	}
+}
+
+func writeField(buf *bytes.Buffer, key, value string) {
+	if needsQuoting(value) {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(buf, "%s: %s\n", key, value)
+}
+
+// needsQuoting reports whether a front matter value would not read back as
+// the same plain string.
+func needsQuoting(value string) bool {
+	if value == "" || strings.TrimSpace(value) != value {
+		return true
+	}
+	if strings.ContainsAny(value[:1], "\"'#[]{}&*!|>%@`") {
+		return true
+	}
+	for _, r := range value {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return strings.Contains(value, " #")
+}
+
+// markdownDefaults fills in what a hand-written file leaves out.
+type markdownDefaults struct {
+	// id is used when the front matter has none, normally the file name.
+	id string
+	// modTime stands in for missing timestamps.
+	modTime time.Time
+	// color is used when the front matter has none, or yellow if empty.
+	color model.Color
+}
+
+// decodeMarkdown reads a note written by encodeMarkdown or by hand. The
+// front matter is optional and so is each field in it: a missing ID is
+// taken from the file name, a missing color is the palette's default and
+// missing timestamps come from the file's modification time. Tags may be
+// a flow list, comma-separated or a block of "- tag" lines. A note with
+// any of board, position, size or z is placed on a board, with the default
+// size if none is given. Due and reminder times take the same formats as
+// the timestamps. The body of a checklist is read with
+// model.ParseChecklist. Unknown fields are ignored.
+func decodeMarkdown(data []byte, defaults markdownDefaults) (*model.Note, error) {
+	note := &model.Note{ID: defaults.id, Color: defaults.color}
+	if note.Color == "" {
+		note.Color = model.Yellow
+	}
+	var created, updated *time.Time
+
+	var tags []string
+	body := string(data)
+	if fields, rest, ok := splitFrontMatter(body); ok {
+		body = rest
+		// listKey is the key of the last field without a value, which the
+		// "- item" lines after it belong to.
+		listKey := ""
+		for i, line := range fields {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if item, isItem := strings.CutPrefix(line, "- "); isItem && listKey != "" {
+				value, err := parseValue(item)
+				if err != nil {
+					return nil, fmt.Errorf("front matter line %d: %w", i+2, err)
+				}
+				if listKey == "tags" {
+					tags = append(tags, value)
+				}
+				continue
+			}
+			key, raw, found := strings.Cut(line, ":")
+			if !found {
+				return nil, fmt.Errorf("front matter line %d: expected key: value", i+2)
+			}
+			value, err := parseValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("front matter line %d: %w", i+2, err)
+			}
+			key = strings.TrimSpace(key)
+			listKey = ""
+			if value == "" {
+				listKey = key
+			}
+			switch key {
+			case "tags":
+				list, err := parseList(value)
+				if err != nil {
+					return nil, fmt.Errorf("front matter line %d: %w", i+2, err)
+				}
+				tags = append(tags, list...)
+			case "board", "position", "size", "z":
+				if value == "" {
+					continue
+				}
+				if note.Geometry == nil {
+					note.Geometry = model.NewGeometry(model.DefaultBoard)
+				}
+				if err := parseGeometryField(note.Geometry, key, value); err != nil {
+					return nil, fmt.Errorf("front matter %s: %w", key, err)
+				}
+			case "id":
+				if value != "" {
+					note.ID = value
+				}
+			case "kind":
+				switch strings.ToLower(value) {
+				case "text":
+					note.Kind = model.KindText
+				case string(model.KindChecklist):
+					note.Kind = model.KindChecklist
+				default:
+					return nil, fmt.Errorf("front matter kind: unknown kind %q", value)
+				}
+			case "color":
+				if value != "" {
+					note.Color = model.Color(strings.ToLower(value))
+				}
+			case "version":
+				if value == "" {
+					continue
+				}
+				version, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || version < 0 {
+					return nil, fmt.Errorf("front matter version: invalid version %q", value)
+				}
+				note.Version = version
+			case "created_at", "updated_at", "deleted_at", "due_at", "remind_at", "reminded_at":
+				if value == "" {
+					continue
+				}
+				t, err := parseMarkdownTime(value)
+				if err != nil {
+					return nil, fmt.Errorf("front matter %s: %w", key, err)
+				}
+				switch key {
+				case "created_at":
+					created = &t
+				case "updated_at":
+					updated = &t
+				case "due_at":
+					note.DueAt = &t
+				case "remind_at":
+					note.RemindAt = &t
+				case "reminded_at":
+					note.RemindedAt = &t
+				default:
+					note.DeletedAt = &t
+				}
+			}
+		}
+	}
+	note.SetText(strings.TrimSuffix(body, "\n"))
+	normalized, err := model.NormalizeTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("front matter tags: %w", err)
+	}
+	note.Tags = normalized
+
+	switch {
+	case created != nil && updated != nil:
+		note.CreatedAt, note.UpdatedAt = *created, *updated
+	case created != nil:
+		note.CreatedAt, note.UpdatedAt = *created, *created
+		if defaults.modTime.After(*created) {
+			note.UpdatedAt = defaults.modTime
+		}
+	case updated != nil:
+		note.CreatedAt, note.UpdatedAt = *updated, *updated
+	default:
+		note.CreatedAt, note.UpdatedAt = defaults.modTime, defaults.modTime
+	}
+
+	if note.ID == "" {
+		return nil, fmt.Errorf("note has no id")
+	}
+	if !note.Color.Valid() {
+		return nil, fmt.Errorf("invalid color %q", note.Color)
+	}
+	if note.Geometry != nil {
+		if err := note.Geometry.Validate(); err != nil {
+			return nil, fmt.Errorf("front matter: %w", err)
+		}
+	}
+	return note, nil
+}
+
+// parseGeometryField reads "board: work", "position: 40, 60", "size:
+// 200x150" or "z: 3" into g.
+func parseGeometryField(g *model.Geometry, key, value string) error {
+	var err error
+	switch key {
+	case "board":
+		g.Board, err = model.NormalizeBoard(value)
+		return err
+	case "position":
+		x, y, found := strings.Cut(value, ",")
+		if !found {
+			return fmt.Errorf("invalid position %q (use x, y)", value)
+		}
+		if g.X, err = strconv.Atoi(strings.TrimSpace(x)); err == nil {
+			g.Y, err = strconv.Atoi(strings.TrimSpace(y))
+		}
+		if err != nil {
+			return fmt.Errorf("invalid position %q (use x, y)", value)
+		}
+	case "size":
+		w, h, found := strings.Cut(strings.ToLower(value), "x")
+		if !found {
+			return fmt.Errorf("invalid size %q (use WIDTHxHEIGHT)", value)
+		}
+		if g.Width, err = strconv.Atoi(strings.TrimSpace(w)); err == nil {
+			g.Height, err = strconv.Atoi(strings.TrimSpace(h))
+		}
+		if err != nil {
+			return fmt.Errorf("invalid size %q (use WIDTHxHEIGHT)", value)
+		}
+	case "z":
+		if g.Z, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid z %q", value)
+		}
+	}
+	return nil
+}
+
+// splitFrontMatter returns the lines between the opening and closing
+// delimiters and the text after the closing one. A file that does not
+// start with a delimiter line has no front matter.
+func splitFrontMatter(text string) ([]string, string, bool) {
+	first, rest, found := strings.Cut(text, "\n")
+	if !found || strings.TrimRight(first, "\r") != frontMatterDelim {
+		return nil, text, false
+	}
+	var fields []string
+	for rest != "" {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		if strings.TrimRight(line, "\r") == frontMatterDelim {
+			return fields, rest, true
+		}
+		fields = append(fields, line)
+	}
+	// No closing delimiter: the whole file is content.
+	return nil, text, false
+}
+
+func parseValue(raw string) (string, error) {
+	value := strings.TrimSpace(raw)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// parseList reads a flow list such as [a, "b c"], or plain comma-separated
+// values as hand-written files often have them.
+func parseList(value string) ([]string, error) {
+	if inner, found := strings.CutPrefix(value, "["); found {
+		var closed bool
+		if value, closed = strings.CutSuffix(inner, "]"); !closed {
+			return nil, fmt.Errorf("missing ] in list")
+		}
+	}
+	var items []string
+	for _, raw := range strings.Split(value, ",") {
+		item, err := parseValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func parseMarkdownTime(value string) (time.Time, error) {
+	for _, layout := range markdownDateLayouts {
+		var t time.Time
+		var err error
+		if layout == time.RFC3339Nano {
+			t, err = time.Parse(layout, value)
+		} else {
+			t, err = time.ParseInLocation(layout, value, time.Local)
+		}
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339 or YYYY-MM-DD)", value)
+}
+
+// slugify turns the first line of a note into a file name: lower case
+// words of letters and digits joined by dashes, without the leading # of a
+// Markdown heading, cut at a word boundary. Notes without a usable title
+// are called "note".
+func slugify(content string) string {
+	title := ""
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#")); line != "" {
+			title = line
+			break
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slug := ""
+	for _, word := range words {
+		next := word
+		if slug != "" {
+			next = slug + "-" + word
+		}
+		if len(next) > maxSlugLength {
+			if slug == "" {
+				// A single long word is cut on a rune boundary.
+				for i := range word {
+					if i > maxSlugLength {
+						break
+					}
+					slug = word[:i]
+				}
+			}
+			break
+		}
+		slug = next
+	}
+	if slug == "" {
+		return "note"
+	}
+	return slug
+}
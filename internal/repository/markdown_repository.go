@@ -0,0 +1,402 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// MarkdownRepository stores each note as a Markdown file with its metadata
+// in front matter, so notes can be read, grepped and edited in any editor
+// and diffed cleanly under version control. Files are named after the
+// note's first line; the ID in the front matter is what identifies a note,
+// so files can be renamed freely. Files written by hand may leave out any
+// field (see decodeMarkdown).
+type MarkdownRepository struct {
+	dir     string
+	mutex   sync.RWMutex
+	dirLock *dirLock
+
+	indexMutex sync.Mutex
+	// files maps note IDs to file names as of the last scan.
+	files map[string]string
+	// warnings lists the files the last scan could not read.
+	warnings []string
+	// tags indexes the notes as of the last scan and the writes since.
+	tags *tagIndex
+}
+
+// markdownFile is a note file found by a scan.
+type markdownFile struct {
+	name string
+	note *model.Note
+}
+
+func NewMarkdownRepository(dir string) (*MarkdownRepository, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create notes directory: %w", err)
+	}
+	lock, err := openDirLock(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &MarkdownRepository{dir: dir, dirLock: lock, files: make(map[string]string), tags: newTagIndex()}, nil
+}
+
+// Close releases the lock file.
+func (r *MarkdownRepository) Close() error {
+	return r.dirLock.close()
+}
+
+func (r *MarkdownRepository) rlock() error {
+	r.mutex.RLock()
+	if err := r.dirLock.lockShared(); err != nil {
+		r.mutex.RUnlock()
+		return err
+	}
+	return nil
+}
+
+func (r *MarkdownRepository) runlock() {
+	r.dirLock.unlockShared()
+	r.mutex.RUnlock()
+}
+
+func (r *MarkdownRepository) lock() error {
+	r.mutex.Lock()
+	if err := r.dirLock.lock(); err != nil {
+		r.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r *MarkdownRepository) unlock() {
+	r.dirLock.unlock()
+	r.mutex.Unlock()
+}
+
+// Save writes a new note to a file named after its first line. Saving a
+// note that already exists overwrites it.
+func (r *MarkdownRepository) Save(note *model.Note) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	files, err := r.scan()
+	if err != nil {
+		return err
+	}
+	return r.write(note, files[note.ID].name)
+}
+
+// Update rewrites a note. The file is renamed when the note's first line
+// no longer matches its name.
+func (r *MarkdownRepository) Update(note *model.Note) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	files, err := r.scan()
+	if err != nil {
+		return err
+	}
+	file, exists := files[note.ID]
+	if !exists {
+		return fmt.Errorf("failed to update note: note %s not found", note.ID)
+	}
+	version, err := nextVersion(file.note, note)
+	if err != nil {
+		return err
+	}
+	stored := cloneNote(note)
+	stored.Version = version
+	if err := r.write(stored, file.name); err != nil {
+		return err
+	}
+	note.Version = version
+	return nil
+}
+
+func (r *MarkdownRepository) Delete(id string) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	files, err := r.scan()
+	if err != nil {
+		return err
+	}
+	file, exists := files[id]
+	if !exists {
+		return fmt.Errorf("failed to delete note: note %s not found", id)
+	}
+	if err := os.Remove(filepath.Join(r.dir, file.name)); err != nil {
+		return fmt.Errorf("failed to delete note file: %w", err)
+	}
+	r.forget(id)
+	return syncDir(r.dir)
+}
+
+// GetById reads the file the note was last seen in, and scans the
+// directory if the note is no longer there.
+func (r *MarkdownRepository) GetById(id string) (*model.Note, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	r.indexMutex.Lock()
+	name, known := r.files[id]
+	r.indexMutex.Unlock()
+	if known {
+		if note, err := r.readFile(name, r.defaultColor()); err == nil && note.ID == id {
+			return note, nil
+		}
+	}
+
+	files, err := r.scan()
+	if err != nil {
+		return nil, err
+	}
+	file, exists := files[id]
+	if !exists {
+		return nil, fmt.Errorf("note %s not found", id)
+	}
+	return cloneNote(file.note), nil
+}
+
+func (r *MarkdownRepository) GetAll() ([]*model.Note, error) {
+	return Collect(r.All())
+}
+
+func (r *MarkdownRepository) Find(q Query) (*Page, error) {
+	notes, err := r.loadAll()
+	if err != nil {
+		return nil, err
+	}
+	return q.Apply(notes)
+}
+
+func (r *MarkdownRepository) Search(query string) ([]*model.Note, error) {
+	return Collect(r.SearchSeq(query))
+}
+
+// All streams the notes oldest first. The directory is read once, when
+// iteration starts.
+func (r *MarkdownRepository) All() iter.Seq2[*model.Note, error] {
+	return func(yield func(*model.Note, error) bool) {
+		notes, err := r.loadAll()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, note := range notes {
+			if !yield(note, nil) {
+				return
+			}
+		}
+	}
+}
+
+// SearchSeq streams the notes containing query, ignoring case.
+func (r *MarkdownRepository) SearchSeq(query string) iter.Seq2[*model.Note, error] {
+	return containing(r.All(), query)
+}
+
+// Tags implements TagRepository. The directory is scanned first, so tags
+// added or removed by hand are counted.
+func (r *MarkdownRepository) Tags() ([]TagCount, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	if _, err := r.scan(); err != nil {
+		return nil, err
+	}
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+	return r.tags.list(), nil
+}
+
+// Warnings implements HealthReporter.
+func (r *MarkdownRepository) Warnings() []string {
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+
+	return append([]string(nil), r.warnings...)
+}
+
+func (r *MarkdownRepository) loadAll() ([]*model.Note, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	files, err := r.scan()
+	if err != nil {
+		return nil, err
+	}
+	notes := make([]*model.Note, 0, len(files))
+	for _, file := range files {
+		notes = append(notes, file.note)
+	}
+	sortNotes(notes)
+	return notes, nil
+}
+
+// scan reads every note file and refreshes the index. Files that cannot be
+// read are skipped and recorded as warnings. When two files hold the same
+// note, as after a copy or an interrupted rename, the one updated last
+// wins.
+func (r *MarkdownRepository) scan() (map[string]markdownFile, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes directory: %w", err)
+	}
+
+	files := make(map[string]markdownFile)
+	var warnings []string
+	color := r.defaultColor()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, markdownExt) || strings.HasPrefix(name, ".") {
+			continue
+		}
+		note, err := r.readFile(name, color)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if other, exists := files[note.ID]; exists {
+			if !note.UpdatedAt.After(other.note.UpdatedAt) {
+				warnings = append(warnings, fmt.Sprintf("%s: duplicate of note %s in %s, ignored", name, note.ID, other.name))
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: duplicate of note %s in %s, ignored", other.name, note.ID, name))
+		}
+		files[note.ID] = markdownFile{name: name, note: note}
+	}
+
+	r.indexMutex.Lock()
+	r.files = make(map[string]string, len(files))
+	r.tags = newTagIndex()
+	for id, file := range files {
+		r.files[id] = file.name
+		r.tags.set(id, file.note.Tags)
+	}
+	r.warnings = warnings
+	r.indexMutex.Unlock()
+	return files, nil
+}
+
+// defaultColor is given to notes whose front matter names no color.
+func (r *MarkdownRepository) defaultColor() model.Color {
+	return defaultColor(filepath.Join(r.dir, paletteFile))
+}
+
+func (r *MarkdownRepository) readFile(name string, color model.Color) (*model.Note, error) {
+	path := filepath.Join(r.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open note file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read note file: %w", err)
+	}
+	note, err := decodeMarkdown(data, markdownDefaults{
+		id:      strings.TrimSuffix(name, markdownExt),
+		modTime: info.ModTime(),
+		color:   color,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode note: %w", err)
+	}
+	return note, nil
+}
+
+// write stores a note in current, its existing file, or in a new file
+// named after its first line. The new file is written before the old one
+// is removed, so a crash in between leaves a duplicate that scan resolves
+// rather than losing the note.
+func (r *MarkdownRepository) write(note *model.Note, current string) error {
+	slug := slugify(note.Content)
+	name := current
+	if name == "" || !hasSlug(name, slug) {
+		free, err := r.freeName(slug)
+		if err != nil {
+			return err
+		}
+		name = free
+	}
+
+	if err := writeFileAtomic(filepath.Join(r.dir, name), encodeMarkdown(note), 0644); err != nil {
+		return fmt.Errorf("failed to write note file: %w", err)
+	}
+	if current != "" && current != name {
+		if err := os.Remove(filepath.Join(r.dir, current)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove old note file: %w", err)
+		}
+		if err := syncDir(r.dir); err != nil {
+			return err
+		}
+	}
+
+	r.indexMutex.Lock()
+	r.files[note.ID] = name
+	r.tags.set(note.ID, note.Tags)
+	r.indexMutex.Unlock()
+	return nil
+}
+
+// freeName returns the first of slug.md, slug-2.md, slug-3.md and so on
+// that is not taken by any file.
+func (r *MarkdownRepository) freeName(slug string) (string, error) {
+	for n := 1; ; n++ {
+		name := slug + markdownExt
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d%s", slug, n, markdownExt)
+		}
+		_, err := os.Lstat(filepath.Join(r.dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return name, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to check note file name: %w", err)
+		}
+	}
+}
+
+// hasSlug reports whether a file name is slug.md or a numbered variant
+// freeName would have picked for it.
+func hasSlug(name, slug string) bool {
+	base := strings.TrimSuffix(name, markdownExt)
+	if base == slug {
+		return true
+	}
+	suffix, found := strings.CutPrefix(base, slug+"-")
+	if !found {
+		return false
+	}
+	n, err := strconv.Atoi(suffix)
+	return err == nil && n > 1 && strconv.Itoa(n) == suffix
+}
+
+func (r *MarkdownRepository) forget(id string) {
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+	delete(r.files, id)
+	r.tags.remove(id)
+}
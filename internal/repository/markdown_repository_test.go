@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func setupMarkdownRepo(t *testing.T) (*MarkdownRepository, string) {
+	t.Helper()
+	tempDir, err := os.MkdirTemp("", "sticky-notes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	repo, err := NewMarkdownRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	return repo, tempDir
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	deletedAt := time.Date(2024, 3, 5, 6, 7, 8, 9, time.FixedZone("", -5*3600))
+	dueAt := time.Date(2024, 4, 30, 17, 0, 0, 0, time.UTC)
+	remindAt, remindedAt := dueAt.Add(-time.Hour), dueAt.Add(-time.Hour+time.Second)
+	tests := []struct {
+		name string
+		note *model.Note
+	}{
+		{name: "plain", note: &model.Note{ID: "a1", Content: "Buy milk", Color: model.Blue}},
+		{name: "tagged", note: &model.Note{ID: "a0", Content: "Fix it", Color: model.Blue, Tags: []string{"bug", "release/1.2"}}},
+		{name: "multi-line", note: &model.Note{ID: "a2", Content: "# Title\n\n- one\n- two", Color: model.Green}},
+		{name: "trailing newlines", note: &model.Note{ID: "a3", Content: "text\n\n", Color: model.Pink}},
+		{name: "leading blank lines", note: &model.Note{ID: "a4", Content: "\n\nbody", Color: model.Orange}},
+		{name: "front matter lookalike", note: &model.Note{ID: "a5", Content: "---\nid: other\n---\n", Color: model.Yellow}},
+		{name: "carriage returns", note: &model.Note{ID: "a6", Content: "line\r\nline\r", Color: model.Yellow}},
+		{name: "empty", note: &model.Note{ID: "a7", Content: "", Color: model.Yellow}},
+		{name: "odd id", note: &model.Note{ID: " #odd: id\"", Content: "x", Color: model.Yellow}},
+		{name: "trashed", note: &model.Note{ID: "a9", Content: "gone", Color: model.Blue, DeletedAt: &deletedAt}},
+		{name: "checklist", note: &model.Note{ID: "b2", Kind: model.KindChecklist, Content: "# Trip\n- not an item", Color: model.Green,
+			Items: []model.ChecklistItem{{Text: "passport", Done: true}, {Text: "tickets"}}}},
+		{name: "untitled checklist", note: &model.Note{ID: "b3", Kind: model.KindChecklist, Color: model.Green, Items: []model.ChecklistItem{{Text: "one"}}}},
+		{name: "placed", note: &model.Note{ID: "b1", Content: "here", Color: model.Blue,
+			Geometry: &model.Geometry{Board: "work", X: -40, Y: 60, Width: 220, Height: 180, Z: 3}}},
+		{name: "scheduled", note: &model.Note{ID: "c1", Content: "report", Color: model.Blue,
+			DueAt: &dueAt, RemindAt: &remindAt, RemindedAt: &remindedAt}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.note.CreatedAt = time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+			tt.note.UpdatedAt = time.Date(2024, 2, 3, 4, 5, 6, 0, time.FixedZone("", 2*3600))
+
+			got, err := decodeMarkdown(encodeMarkdown(tt.note), markdownDefaults{id: "file-name"})
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if got.ID != tt.note.ID || got.Content != tt.note.Content || got.Color != tt.note.Color ||
+				strings.Join(got.Tags, ",") != strings.Join(tt.note.Tags, ",") ||
+				got.Kind != tt.note.Kind || fmt.Sprint(got.Items) != fmt.Sprint(tt.note.Items) {
+				t.Errorf("Note mismatch, got: %+v, want: %+v", got, tt.note)
+			}
+			if (got.Geometry == nil) != (tt.note.Geometry == nil) || (got.Geometry != nil && *got.Geometry != *tt.note.Geometry) {
+				t.Errorf("Geometry mismatch, got: %+v, want: %+v", got.Geometry, tt.note.Geometry)
+			}
+			if !got.CreatedAt.Equal(tt.note.CreatedAt) || !got.UpdatedAt.Equal(tt.note.UpdatedAt) {
+				t.Errorf("Timestamp mismatch, got: %v/%v, want: %v/%v", got.CreatedAt, got.UpdatedAt, tt.note.CreatedAt, tt.note.UpdatedAt)
+			}
+			if (got.DeletedAt == nil) != (tt.note.DeletedAt == nil) || (got.DeletedAt != nil && !got.DeletedAt.Equal(*tt.note.DeletedAt)) {
+				t.Errorf("Deletion time mismatch, got: %v, want: %v", got.DeletedAt, tt.note.DeletedAt)
+			}
+			if !sameTime(got.DueAt, tt.note.DueAt) || !sameTime(got.RemindAt, tt.note.RemindAt) || !sameTime(got.RemindedAt, tt.note.RemindedAt) {
+				t.Errorf("Schedule mismatch, got: %v/%v/%v, want: %v/%v/%v",
+					got.DueAt, got.RemindAt, got.RemindedAt, tt.note.DueAt, tt.note.RemindAt, tt.note.RemindedAt)
+			}
+		})
+	}
+}
+
+func TestDecodeHandWrittenMarkdown(t *testing.T) {
+	modTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		input   string
+		want    model.Note
+		wantErr string
+	}{
+		{
+			name:  "no front matter",
+			input: "Just some text\n",
+			want:  model.Note{ID: "file-name", Content: "Just some text", Color: model.Yellow, CreatedAt: modTime, UpdatedAt: modTime},
+		},
+		{
+			name:  "partial front matter",
+			input: "---\ncolor: Blue # work\ncreated_at: 2024-05-01\n---\nMeeting notes\n",
+			want: model.Note{ID: "file-name", Content: "Meeting notes", Color: model.Blue,
+				CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), UpdatedAt: modTime},
+		},
+		{
+			name:  "quoted values and unknown keys",
+			input: "---\nid: 'it''s'\ntags: [a, b]\nupdated_at: \"2024-05-02T10:00:00Z\"\n---\nbody",
+			want: model.Note{ID: "it's", Content: "body", Color: model.Yellow, Tags: []string{"a", "b"},
+				CreatedAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC), UpdatedAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "unclosed front matter",
+			input: "---\nnot really front matter",
+			want:  model.Note{ID: "file-name", Content: "---\nnot really front matter", Color: model.Yellow, CreatedAt: modTime, UpdatedAt: modTime},
+		},
+		{
+			name:  "tag lists",
+			input: "---\ntags:\n  - Work\n  - \"#urgent\"\naliases:\n  - ignored\n---\nbody",
+			want:  model.Note{ID: "file-name", Content: "body", Color: model.Yellow, Tags: []string{"urgent", "work"}, CreatedAt: modTime, UpdatedAt: modTime},
+		},
+		{
+			name:  "comma-separated tags",
+			input: "---\ntags: home, 'diy' # weekend\n---\nbody",
+			want:  model.Note{ID: "file-name", Content: "body", Color: model.Yellow, Tags: []string{"diy", "home"}, CreatedAt: modTime, UpdatedAt: modTime},
+		},
+		{
+			name:  "partial geometry",
+			input: "---\nposition: 10,20\nz: 2\n---\nbody",
+			want: model.Note{ID: "file-name", Content: "body", Color: model.Yellow, CreatedAt: modTime, UpdatedAt: modTime,
+				Geometry: &model.Geometry{Board: model.DefaultBoard, X: 10, Y: 20, Width: model.DefaultNoteWidth, Height: model.DefaultNoteHeight, Z: 2}},
+		},
+		{
+			name:  "hand-written checklist",
+			input: "---\nkind: Checklist\n---\nPacking\n\n- [x] socks\n- shoes\n",
+			want: model.Note{ID: "file-name", Kind: model.KindChecklist, Content: "Packing", Color: model.Yellow, CreatedAt: modTime, UpdatedAt: modTime,
+				Items: []model.ChecklistItem{{Text: "socks", Done: true}, {Text: "shoes"}}},
+		},
+		{
+			name:  "due date",
+			input: "---\ndue_at: 2024-05-01 17:30\n---\nReport",
+			want: model.Note{ID: "file-name", Content: "Report", Color: model.Yellow, CreatedAt: modTime, UpdatedAt: modTime,
+				DueAt: ptrTime(time.Date(2024, 5, 1, 17, 30, 0, 0, time.Local))},
+		},
+		{name: "invalid due date", input: "---\ndue_at: soon\n---\n", wantErr: "invalid time"},
+		{name: "unknown kind", input: "---\nkind: drawing\n---\n", wantErr: "unknown kind"},
+		{name: "invalid tag", input: "---\ntags: [two words]\n---\n", wantErr: "invalid tag"},
+		{name: "invalid size", input: "---\nsize: 10x10\n---\n", wantErr: "invalid note size"},
+		{name: "invalid position", input: "---\nposition: left\n---\n", wantErr: "invalid position"},
+		{name: "invalid color", input: "---\ncolor: light blue\n---\n", wantErr: "invalid color"},
+		{name: "invalid time", input: "---\ncreated_at: yesterday\n---\n", wantErr: "invalid time"},
+		{name: "malformed line", input: "---\njust words\n---\n", wantErr: "expected key: value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMarkdown([]byte(tt.input), markdownDefaults{id: "file-name", modTime: modTime})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if got.ID != tt.want.ID || got.Content != tt.want.Content || got.Color != tt.want.Color ||
+				strings.Join(got.Tags, ",") != strings.Join(tt.want.Tags, ",") ||
+				got.Kind != tt.want.Kind || fmt.Sprint(got.Items) != fmt.Sprint(tt.want.Items) {
+				t.Errorf("Note mismatch, got: %+v, want: %+v", got, tt.want)
+			}
+			if (got.Geometry == nil) != (tt.want.Geometry == nil) || (got.Geometry != nil && *got.Geometry != *tt.want.Geometry) {
+				t.Errorf("Geometry mismatch, got: %+v, want: %+v", got.Geometry, tt.want.Geometry)
+			}
+			if !got.CreatedAt.Equal(tt.want.CreatedAt) || !got.UpdatedAt.Equal(tt.want.UpdatedAt) {
+				t.Errorf("Timestamp mismatch, got: %v/%v, want: %v/%v", got.CreatedAt, got.UpdatedAt, tt.want.CreatedAt, tt.want.UpdatedAt)
+			}
+			if !sameTime(got.DueAt, tt.want.DueAt) {
+				t.Errorf("Due date mismatch, got: %v, want: %v", got.DueAt, tt.want.DueAt)
+			}
+		})
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{content: "Buy milk", want: "buy-milk"},
+		{content: "\n## Weekly Plan: Q3!\nbody", want: "weekly-plan-q3"},
+		{content: "Café déjà vu", want: "café-déjà-vu"},
+		{content: "!!!", want: "note"},
+		{content: "", want: "note"},
+		{content: strings.Repeat("word ", 20), want: strings.TrimSuffix(strings.Repeat("word-", 9), "-")},
+	}
+
+	for _, tt := range tests {
+		if got := slugify(tt.content); got != tt.want {
+			t.Errorf("Slug mismatch for %q, got: %s, want: %s", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownRepository(t *testing.T) {
+	repo, tempDir := setupMarkdownRepo(t)
+	defer cleanupTestRepo(tempDir)
+	defer repo.Close()
+
+	now := time.Now()
+	first := &model.Note{ID: "id-1", Content: "Groceries\n- milk", Color: model.Yellow, CreatedAt: now, UpdatedAt: now}
+	second := &model.Note{ID: "id-2", Content: "Groceries\n- bread", Color: model.Blue, CreatedAt: now.Add(time.Second), UpdatedAt: now}
+	for _, note := range []*model.Note{first, second} {
+		if err := repo.Save(note); err != nil {
+			t.Fatalf("Failed to save note: %v", err)
+		}
+	}
+	for _, name := range []string{"groceries.md", "groceries-2.md"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("Expected %s to exist: %v", name, err)
+		}
+	}
+
+	// A changed title renames the file; the note keeps its ID.
+	second.Content = "Bakery\n- bread"
+	if err := repo.Update(second); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "groceries-2.md")); !os.IsNotExist(err) {
+		t.Errorf("Expected the old file to be removed: %v", err)
+	}
+	if note, err := repo.GetById("id-2"); err != nil || note.Content != second.Content {
+		t.Errorf("Expected the renamed note to be readable: %+v (%v)", note, err)
+	}
+
+	// Files renamed and written by hand are found by scanning.
+	if err := os.Rename(filepath.Join(tempDir, "groceries.md"), filepath.Join(tempDir, "renamed.md")); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	if note, err := repo.GetById("id-1"); err != nil || note.Content != first.Content {
+		t.Errorf("Expected the moved note to be readable: %+v (%v)", note, err)
+	}
+	os.WriteFile(filepath.Join(tempDir, "by-hand.md"), []byte("Written by hand\n"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "broken.md"), []byte("---\ncolor: light blue\n---\n"), 0644)
+
+	notes, err := repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get notes: %v", err)
+	}
+	if len(notes) != 3 {
+		t.Errorf("Expected three notes, got: %d", len(notes))
+	}
+	if warnings := repo.Warnings(); len(warnings) != 1 || !strings.HasPrefix(warnings[0], "broken.md") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+	if found, _ := repo.Search("by hand"); len(found) != 1 || found[0].ID != "by-hand" {
+		t.Errorf("Expected to find the hand-written note, got: %+v", found)
+	}
+
+	// Saving the hand-written note adds the missing front matter.
+	handWritten, _ := repo.GetById("by-hand")
+	handWritten.Color = model.Green
+	if err := repo.Update(handWritten); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(tempDir, "written-by-hand.md"))
+	if !strings.HasPrefix(string(data), "---\nid: by-hand\ncolor: green\n") {
+		t.Errorf("Unexpected file contents: %s", data)
+	}
+
+	if err := repo.Delete("id-1"); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	if _, err := repo.GetById("id-1"); err == nil {
+		t.Error("Expected deleted note to be gone")
+	}
+	if err := repo.Update(first); err == nil {
+		t.Error("Expected updating a deleted note to fail")
+	}
+}
+
+func TestMarkdownDuplicateFiles(t *testing.T) {
+	repo, tempDir := setupMarkdownRepo(t)
+	defer cleanupTestRepo(tempDir)
+	defer repo.Close()
+
+	now := time.Now()
+	note := &model.Note{ID: "dup", Content: "Original", Color: model.Yellow, CreatedAt: now, UpdatedAt: now}
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	// A copy left behind by an interrupted rename, updated later.
+	newer := *note
+	newer.Content = "Newer"
+	newer.UpdatedAt = now.Add(time.Minute)
+	os.WriteFile(filepath.Join(tempDir, "copy.md"), encodeMarkdown(&newer), 0644)
+
+	notes, err := repo.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get notes: %v", err)
+	}
+	if len(notes) != 1 || notes[0].Content != "Newer" {
+		t.Errorf("Expected the newer copy to win, got: %+v", notes)
+	}
+	if len(repo.Warnings()) != 1 {
+		t.Errorf("Expected a duplicate warning, got: %v", repo.Warnings())
+	}
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// MemoryRepository keeps notes in memory only. It is meant for tests, demos
+// and CI; everything is lost when the process exits.
+type MemoryRepository struct {
+	mutex     sync.RWMutex
+	notes     map[string]*model.Note
+	trash     map[string]*model.Note
+	revisions map[string][]*model.Revision
+	tags      *tagIndex
+	palette   *model.Palette
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		notes:     make(map[string]*model.Note),
+		trash:     make(map[string]*model.Note),
+		revisions: make(map[string][]*model.Revision),
+		tags:      newTagIndex(),
+	}
+}
+
+func (r *MemoryRepository) Save(note *model.Note) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.notes[note.ID] = cloneNote(note)
+	r.tags.set(note.ID, note.Tags)
+	return nil
+}
+
+func (r *MemoryRepository) Update(note *model.Note) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	current, exists := r.notes[note.ID]
+	if !exists {
+		return fmt.Errorf("failed to update note: note %s not found", note.ID)
+	}
+	version, err := nextVersion(current, note)
+	if err != nil {
+		return err
+	}
+	stored := cloneNote(note)
+	stored.Version = version
+	r.notes[note.ID] = stored
+	r.tags.set(note.ID, stored.Tags)
+	note.Version = version
+	return nil
+}
+
+// Delete moves a note to the trash.
+func (r *MemoryRepository) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	note, exists := r.notes[id]
+	if !exists {
+		return fmt.Errorf("failed to delete note: note %s not found", id)
+	}
+	now := time.Now()
+	note.DeletedAt = &now
+	r.trash[id] = note
+	delete(r.notes, id)
+	r.tags.remove(id)
+	return nil
+}
+
+func (r *MemoryRepository) GetById(id string) (*model.Note, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	note, exists := r.notes[id]
+	if !exists {
+		return nil, fmt.Errorf("note %s not found", id)
+	}
+	return cloneNote(note), nil
+}
+
+func (r *MemoryRepository) GetAll() ([]*model.Note, error) {
+	return Collect(r.All())
+}
+
+func (r *MemoryRepository) Find(q Query) (*Page, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return findIn(r.notes, q)
+}
+
+func (r *MemoryRepository) Search(query string) ([]*model.Note, error) {
+	return Collect(r.SearchSeq(query))
+}
+
+// All streams the notes oldest first.
+func (r *MemoryRepository) All() iter.Seq2[*model.Note, error] {
+	return streamMap(&r.mutex, r.notes)
+}
+
+// SearchSeq streams the notes containing query, ignoring case.
+func (r *MemoryRepository) SearchSeq(query string) iter.Seq2[*model.Note, error] {
+	return containing(r.All(), query)
+}
+
+// Tags implements TagRepository.
+func (r *MemoryRepository) Tags() ([]TagCount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.tags.list(), nil
+}
+
+func (r *MemoryRepository) SaveRevision(rev *model.Revision) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	saved := *rev
+	saved.Number = len(r.revisions[rev.NoteID]) + 1
+	r.revisions[rev.NoteID] = append(r.revisions[rev.NoteID], &saved)
+	rev.Number = saved.Number
+	return nil
+}
+
+func (r *MemoryRepository) GetRevisions(noteID string) ([]*model.Revision, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	revisions := make([]*model.Revision, len(r.revisions[noteID]))
+	for i, rev := range r.revisions[noteID] {
+		clone := *rev
+		revisions[i] = &clone
+	}
+	return revisions, nil
+}
+
+func (r *MemoryRepository) ListTrash() ([]*model.Note, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return cloneAll(r.trash), nil
+}
+
+func (r *MemoryRepository) Restore(id string) (*model.Note, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	note, exists := r.trash[id]
+	if !exists {
+		return nil, fmt.Errorf("failed to find note in trash: note %s not found", id)
+	}
+	if _, exists := r.notes[id]; exists {
+		return nil, fmt.Errorf("failed to restore note: note %s already exists", id)
+	}
+	note.DeletedAt = nil
+	r.notes[id] = note
+	delete(r.trash, id)
+	r.tags.set(id, note.Tags)
+	return cloneNote(note), nil
+}
+
+func (r *MemoryRepository) Purge(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.trash[id]; !exists {
+		return fmt.Errorf("failed to find note in trash: note %s not found", id)
+	}
+	delete(r.trash, id)
+	delete(r.revisions, id)
+	return nil
+}
+
+func (r *MemoryRepository) PurgeBefore(cutoff time.Time) (int, error) {
+	return r.purgeWhere(func(note *model.Note) bool {
+		return note.DeletedAt == nil || note.DeletedAt.Before(cutoff)
+	})
+}
+
+func (r *MemoryRepository) EmptyTrash() (int, error) {
+	return r.purgeWhere(func(*model.Note) bool { return true })
+}
+
+func (r *MemoryRepository) purgeWhere(match func(*model.Note) bool) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	purged := 0
+	for id, note := range r.trash {
+		if !match(note) {
+			continue
+		}
+		delete(r.trash, id)
+		delete(r.revisions, id)
+		purged++
+	}
+	return purged, nil
+}
+
+func cloneAll(notes map[string]*model.Note) []*model.Note {
+	all := make([]*model.Note, 0, len(notes))
+	for _, note := range notes {
+		all = append(all, cloneNote(note))
+	}
+	sortNotes(all)
+	return all
+}
+
+// findIn runs a query over an in-memory map and clones the page.
+func findIn(notes map[string]*model.Note, q Query) (*Page, error) {
+	all := make([]*model.Note, 0, len(notes))
+	for _, note := range notes {
+		all = append(all, note)
+	}
+	page, err := q.Apply(all)
+	if err != nil {
+		return nil, err
+	}
+	for i, note := range page.Notes {
+		page.Notes[i] = cloneNote(note)
+	}
+	return page, nil
+}
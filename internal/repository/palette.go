@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// paletteFile holds the palette of a directory-based store. It is not
+// encrypted, so color names and meanings are readable without the
+// passphrase.
+const paletteFile = ".palette.json"
+
+// PaletteRepository is implemented by backends that keep a color palette
+// with their notes.
+type PaletteRepository interface {
+	// Palette returns the stored palette, or nil if none has been saved.
+	Palette() (*model.Palette, error)
+	SavePalette(p *model.Palette) error
+}
+
+func readPalette(path string) (*model.Palette, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read palette: %w", err)
+	}
+	var p model.Palette
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode palette: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid palette in %s: %w", filepath.Base(path), err)
+	}
+	return &p, nil
+}
+
+func writePalette(path string, p *model.Palette) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode palette: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write palette: %w", err)
+	}
+	return nil
+}
+
+// defaultColor is the default of the palette at path, for filling in notes
+// that have no usable color.
+func defaultColor(path string) model.Color {
+	if p, err := readPalette(path); err == nil && p != nil {
+		return p.Default
+	}
+	return model.DefaultPalette().Default
+}
+
+func (r *FileRepository) Palette() (*model.Palette, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	return readPalette(filepath.Join(r.dataDir, paletteFile))
+}
+
+func (r *FileRepository) SavePalette(p *model.Palette) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	return writePalette(filepath.Join(r.dataDir, paletteFile), p)
+}
+
+func (r *MarkdownRepository) Palette() (*model.Palette, error) {
+	if err := r.rlock(); err != nil {
+		return nil, err
+	}
+	defer r.runlock()
+
+	return readPalette(filepath.Join(r.dir, paletteFile))
+}
+
+func (r *MarkdownRepository) SavePalette(p *model.Palette) error {
+	if err := r.lock(); err != nil {
+		return err
+	}
+	defer r.unlock()
+
+	return writePalette(filepath.Join(r.dir, paletteFile), p)
+}
+
+// The event log keeps its palette in a file next to the log rather than as
+// events, since palette changes are not note history.
+
+func (r *EventLogRepository) Palette() (*model.Palette, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return readPalette(r.palettePath())
+}
+
+func (r *EventLogRepository) SavePalette(p *model.Palette) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return writePalette(r.palettePath(), p)
+}
+
+func (r *EventLogRepository) palettePath() string {
+	return r.path + ".palette.json"
+}
+
+func (r *MemoryRepository) Palette() (*model.Palette, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.palette == nil {
+		return nil, nil
+	}
+	return r.palette.Clone(), nil
+}
+
+func (r *MemoryRepository) SavePalette(p *model.Palette) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.palette = p.Clone()
+	return nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestPaletteStorage(t *testing.T) {
+	fileRepo, fileDir := setupTestRepo(t)
+	defer cleanupTestRepo(fileDir)
+	logRepo, logDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(logDir)
+	mdRepo, mdDir := setupMarkdownRepo(t)
+	defer cleanupTestRepo(mdDir)
+	defer mdRepo.Close()
+
+	tests := []struct {
+		name string
+		repo PaletteRepository
+	}{
+		{name: "file", repo: fileRepo},
+		{name: "jsonl", repo: logRepo},
+		{name: "markdown", repo: mdRepo},
+		{name: "memory", repo: NewMemoryRepository()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if palette, err := tt.repo.Palette(); err != nil || palette != nil {
+				t.Fatalf("Expected no palette, got: %+v (%v)", palette, err)
+			}
+
+			palette := model.DefaultPalette()
+			palette.Set(model.PaletteColor{Name: "red", Hex: "#e53935", Meaning: "blocker"})
+			palette.Default = "red"
+			if err := tt.repo.SavePalette(palette); err != nil {
+				t.Fatalf("Failed to save palette: %v", err)
+			}
+			palette.Default = "missing"
+			if err := tt.repo.SavePalette(palette); err == nil {
+				t.Error("Expected an invalid palette to be refused")
+			}
+
+			saved, err := tt.repo.Palette()
+			if err != nil {
+				t.Fatalf("Failed to read palette: %v", err)
+			}
+			if saved.Default != "red" || len(saved.Colors) != 6 || saved.Colors[5].Meaning != "blocker" {
+				t.Errorf("Unexpected palette: %+v", saved)
+			}
+		})
+	}
+
+	// Hand-written Markdown notes without a color get the new default.
+	os.WriteFile(filepath.Join(mdDir, "plain.md"), []byte("No color\n"), 0644)
+	if note, err := mdRepo.GetById("plain"); err != nil || note.Color != "red" {
+		t.Errorf("Expected the palette's default color, got: %+v (%v)", note, err)
+	}
+
+	// The palette is part of backups.
+	archive, _, err := fileRepo.BackupTo(filepath.Join(fileDir, "..", filepath.Base(fileDir)+"-backups"))
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	defer os.RemoveAll(filepath.Dir(archive))
+	restored, restoredDir := setupTestRepo(t)
+	defer cleanupTestRepo(restoredDir)
+	if _, err := restored.RestoreBackup(archive, RestoreOptions{}); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if palette, err := restored.Palette(); err != nil || palette == nil || palette.Default != "red" {
+		t.Errorf("Expected the palette to be restored, got: %+v (%v)", palette, err)
+	}
+	if check, err := restored.Check(); err != nil || len(check.Issues) != 0 {
+		t.Errorf("Expected a clean check, got: %+v (%v)", check, err)
+	}
+}
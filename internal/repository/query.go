@@ -0,0 +1,443 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+type SortField string
+
+const (
+	SortCreated SortField = "created"
+	SortUpdated SortField = "updated"
+	SortContent SortField = "content"
+	SortColor   SortField = "color"
+)
+
+// ItemFilter selects checklists by the state of their items.
+type ItemFilter string
+
+const (
+	// ItemsAny keeps every checklist.
+	ItemsAny ItemFilter = "any"
+	// ItemsOpen keeps checklists with at least one item not done.
+	ItemsOpen ItemFilter = "open"
+	// ItemsDone keeps checklists whose items are all done.
+	ItemsDone ItemFilter = "done"
+)
+
+// ErrInvalidCursor is returned for cursors that were not produced by a
+// query with the same filters and order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query selects, orders and pages notes. The zero Query returns every note
+// oldest first.
+type Query struct {
+	// Colors keeps notes of any of these colors.
+	Colors []model.Color
+	// CreatedFrom and UpdatedFrom are inclusive, CreatedUntil and
+	// UpdatedUntil exclusive. Zero times leave that side open.
+	CreatedFrom  time.Time
+	CreatedUntil time.Time
+	UpdatedFrom  time.Time
+	UpdatedUntil time.Time
+	// DueFrom and DueUntil keep notes due in that range, inclusive and
+	// exclusive like the other ranges. Setting either drops notes without a
+	// due date.
+	DueFrom  time.Time
+	DueUntil time.Time
+	// Tags keeps notes whose tags satisfy the expression.
+	Tags *TagExpr
+	// Board keeps the notes on one board; see model.Note.Board.
+	Board string
+	// Items keeps checklists whose items match; empty keeps every note.
+	Items ItemFilter
+	// Text keeps notes containing every word of it, ignoring case. Text in
+	// double quotes must occur as written.
+	Text string
+
+	Sort       SortField
+	Descending bool
+	// Limit caps the number of notes per page; 0 means no limit.
+	Limit int
+	// Cursor continues from the page that returned it as Next.
+	Cursor string
+}
+
+// Page is one page of query results.
+type Page struct {
+	Notes []*model.Note
+	// Next is the cursor of the following page, or empty on the last one.
+	Next string
+}
+
+// cursor marks the last note of a page by its sort key. Filter is the
+// filterHash of the query that returned it.
+type cursor struct {
+	Sort   SortField `json:"s"`
+	Desc   bool      `json:"d,omitempty"`
+	Filter string    `json:"f,omitempty"`
+	Key    string    `json:"k"`
+	ID     string    `json:"i"`
+}
+
+func (q Query) Validate() error {
+	switch q.Sort {
+	case "", SortCreated, SortUpdated, SortContent, SortColor:
+	default:
+		return fmt.Errorf("unknown sort field %q", q.Sort)
+	}
+	for _, color := range q.Colors {
+		if !color.Valid() {
+			return fmt.Errorf("invalid color %q", color)
+		}
+	}
+	if q.Board != "" {
+		if board, err := model.NormalizeBoard(q.Board); err != nil || board != q.Board {
+			return fmt.Errorf("invalid board %q", q.Board)
+		}
+	}
+	switch q.Items {
+	case "", ItemsAny, ItemsOpen, ItemsDone:
+	default:
+		return fmt.Errorf("unknown item filter %q (use any, open or done)", q.Items)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("invalid limit %d", q.Limit)
+	}
+	return nil
+}
+
+// Match reports whether a note passes the query's filters.
+func (q Query) Match(note *model.Note) bool {
+	if !q.MatchFilters(note) {
+		return false
+	}
+	content := strings.ToLower(note.Text())
+	for _, term := range textTerms(q.Text) {
+		if !strings.Contains(content, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchFilters is Match without the text condition, for callers that match
+// text themselves.
+func (q Query) MatchFilters(note *model.Note) bool {
+	if len(q.Colors) > 0 {
+		found := false
+		for _, color := range q.Colors {
+			if note.Color == color {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Board != "" && note.Board() != q.Board {
+		return false
+	}
+	if q.Items != "" && !q.Items.match(note) {
+		return false
+	}
+	if !q.DueFrom.IsZero() || !q.DueUntil.IsZero() {
+		if note.DueAt == nil || !inRange(*note.DueAt, q.DueFrom, q.DueUntil) {
+			return false
+		}
+	}
+	return q.Tags.Match(note.Tags) &&
+		inRange(note.CreatedAt, q.CreatedFrom, q.CreatedUntil) &&
+		inRange(note.UpdatedAt, q.UpdatedFrom, q.UpdatedUntil)
+}
+
+func (f ItemFilter) match(note *model.Note) bool {
+	if !note.IsChecklist() {
+		return false
+	}
+	done, total := note.Progress()
+	switch f {
+	case ItemsOpen:
+		return done < total
+	case ItemsDone:
+		return done == total
+	}
+	return true
+}
+
+// Apply runs the query over notes and returns the requested page. Backends
+// that cannot filter more cleverly use it on what they have loaded; notes
+// are returned as they are, not cloned.
+func (q Query) Apply(notes []*model.Note) (*Page, error) {
+	keep, err := q.selector()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*model.Note
+	for _, note := range notes {
+		if keep(note) {
+			matches = append(matches, note)
+		}
+	}
+	return q.page(matches), nil
+}
+
+// selector validates the query and returns a function reporting whether a
+// note matches it and comes after the cursor, for backends that filter
+// while reading notes and pass only the matches to page.
+func (q Query) selector() (func(*model.Note) bool, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if q.Cursor == "" {
+		return q.Match, nil
+	}
+	field := q.sortField()
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if after.Sort != field || after.Desc != q.Descending {
+		return nil, fmt.Errorf("%w: it belongs to a query sorted differently", ErrInvalidCursor)
+	}
+	if after.Filter != q.filterHash() {
+		return nil, fmt.Errorf("%w: it belongs to a query with other filters", ErrInvalidCursor)
+	}
+	return func(note *model.Note) bool {
+		return q.Match(note) && q.before(after.Key, after.ID, sortKey(note, field), note.ID)
+	}, nil
+}
+
+// page sorts the notes that matched and cuts out the requested page.
+func (q Query) page(matches []*model.Note) *Page {
+	field := q.sortField()
+	type keyed struct {
+		key  string
+		note *model.Note
+	}
+	sorted := make([]keyed, len(matches))
+	for i, note := range matches {
+		sorted[i] = keyed{key: sortKey(note, field), note: note}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return q.before(sorted[i].key, sorted[i].note.ID, sorted[j].key, sorted[j].note.ID)
+	})
+
+	page := &Page{}
+	if q.Limit > 0 && len(sorted) > q.Limit {
+		last := sorted[q.Limit-1]
+		page.Next = encodeCursor(cursor{Sort: field, Desc: q.Descending, Filter: q.filterHash(), Key: last.key, ID: last.note.ID})
+		sorted = sorted[:q.Limit]
+	}
+	page.Notes = make([]*model.Note, len(sorted))
+	for i, k := range sorted {
+		page.Notes[i] = k.note
+	}
+	return page
+}
+
+// filterHash identifies the filters of the query, so a cursor is only
+// accepted by queries selecting the same notes.
+func (q Query) filterHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", q.Colors)
+	for _, t := range []time.Time{q.CreatedFrom, q.CreatedUntil, q.UpdatedFrom, q.UpdatedUntil, q.DueFrom, q.DueUntil} {
+		fmt.Fprintf(h, "%s\n", timeKey(t))
+	}
+	fmt.Fprintf(h, "%q\n%q\n%q\n%q\n", q.Tags.String(), q.Board, q.Items, q.Text)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:8])
+}
+
+func (q Query) sortField() SortField {
+	if q.Sort == "" {
+		return SortCreated
+	}
+	return q.Sort
+}
+
+// before reports whether the note with key a and ID idA comes before the
+// one with key b and ID idB in the query's order.
+func (q Query) before(a, idA, b, idB string) bool {
+	if a == b {
+		a, b = idA, idB
+	}
+	if q.Descending {
+		return a > b
+	}
+	return a < b
+}
+
+// sortKey renders the field a note is sorted by so that keys compare as
+// strings.
+func sortKey(note *model.Note, field SortField) string {
+	switch field {
+	case SortUpdated:
+		return timeKey(note.UpdatedAt)
+	case SortContent:
+		return strings.ToLower(note.Content)
+	case SortColor:
+		return string(note.Color)
+	default:
+		return timeKey(note.CreatedAt)
+	}
+}
+
+func timeKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000")
+}
+
+func inRange(t, from, until time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !until.IsZero() && !t.Before(until) {
+		return false
+	}
+	return true
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// textTerms splits query text into lower-case words, keeping text in
+// double quotes together.
+func textTerms(text string) []string {
+	var terms []string
+	for _, word := range splitQuoted(text) {
+		if word = strings.ToLower(strings.Trim(word, `"`)); word != "" {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// splitQuoted splits s on white space outside double quotes. The quotes are
+// kept.
+func splitQuoted(s string) []string {
+	var words []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				words = append(words, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		words = append(words, current.String())
+	}
+	return words
+}
+
+// ParseQuery reads the filter syntax used by the command line:
+//
+//	color:blue,pink  created:2024-01-01..2024-01-31  updated:2024-03-01..
+//	due:..2024-04-30  tag:bug  tags:"(bug OR feature) AND NOT done"
+//	board:work  items:open
+//	sort:updated  sort:-created  limit:20
+//
+// Date ranges include both ends; either end may be left out. A tag filter
+// takes a tag expression (see TagExpr), quoted if it has spaces; several
+// tag filters must all match. Everything else is the text to match.
+func ParseQuery(input string) (Query, error) {
+	var q Query
+	var text []string
+	for _, word := range splitQuoted(input) {
+		key, value, found := strings.Cut(word, ":")
+		if !found || strings.HasPrefix(word, `"`) {
+			text = append(text, word)
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "color":
+			for _, name := range strings.Split(value, ",") {
+				q.Colors = append(q.Colors, model.Color(strings.ToLower(strings.TrimSpace(name))))
+			}
+		case "created":
+			q.CreatedFrom, q.CreatedUntil, err = parseDateRange(value)
+		case "updated":
+			q.UpdatedFrom, q.UpdatedUntil, err = parseDateRange(value)
+		case "due":
+			q.DueFrom, q.DueUntil, err = parseDateRange(value)
+		case "tag", "tags":
+			var expr *TagExpr
+			expr, err = ParseTagExpr(strings.Trim(value, `"`))
+			q.Tags = AndTags(q.Tags, expr)
+		case "board":
+			q.Board, err = model.NormalizeBoard(value)
+		case "items":
+			q.Items = ItemFilter(strings.ToLower(value))
+		case "sort":
+			q.Descending = strings.HasPrefix(value, "-")
+			q.Sort = SortField(strings.ToLower(strings.TrimPrefix(value, "-")))
+		case "limit":
+			q.Limit, err = strconv.Atoi(value)
+		default:
+			text = append(text, word)
+		}
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid %s filter: %w", key, err)
+		}
+	}
+	q.Text = strings.Join(text, " ")
+	return q, q.Validate()
+}
+
+// parseDateRange reads from..until in local dates; until covers its whole
+// day.
+func parseDateRange(value string) (time.Time, time.Time, error) {
+	fromText, untilText, isRange := strings.Cut(value, "..")
+	if !isRange {
+		untilText = fromText
+	}
+
+	var from, until time.Time
+	var err error
+	if fromText != "" {
+		if from, err = time.ParseInLocation("2006-01-02", fromText, time.Local); err != nil {
+			return from, until, err
+		}
+	}
+	if untilText != "" {
+		if until, err = time.ParseInLocation("2006-01-02", untilText, time.Local); err != nil {
+			return from, until, err
+		}
+		until = until.AddDate(0, 0, 1)
+	}
+	return from, until, nil
+}
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func queryTestNotes() []*model.Note {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	colors := []model.Color{model.Yellow, model.Blue, model.Green, model.Pink}
+	var notes []*model.Note
+	for i := 0; i < 8; i++ {
+		notes = append(notes, &model.Note{
+			ID:        fmt.Sprintf("note%d", i),
+			Content:   fmt.Sprintf("Note number %d about %s", i, []string{"work", "home"}[i%2]),
+			Color:     colors[i%len(colors)],
+			CreatedAt: base.AddDate(0, 0, i),
+			UpdatedAt: base.AddDate(0, 0, 2*i),
+		})
+		if i%2 == 1 {
+			due := base.AddDate(0, 1, i)
+			notes[i].DueAt = &due
+		}
+		if i%3 == 0 {
+			notes[i].Geometry = &model.Geometry{Board: "work", X: 10 * i, Width: 100, Height: 100}
+		}
+	}
+	notes[1].Kind, notes[1].Items = model.KindChecklist, []model.ChecklistItem{{Text: "buy paint", Done: true}, {Text: "paint fence"}}
+	notes[2].Kind, notes[2].Items = model.KindChecklist, []model.ChecklistItem{{Text: "file report", Done: true}}
+	return notes
+}
+
+func TestQueryApply(t *testing.T) {
+	notes := queryTestNotes()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "everything oldest first", query: Query{}, want: []string{"note0", "note1", "note2", "note3", "note4", "note5", "note6", "note7"}},
+		{name: "colors", query: Query{Colors: []model.Color{model.Blue, model.Pink}}, want: []string{"note1", "note3", "note5", "note7"}},
+		{name: "text ignores case", query: Query{Text: "WORK"}, want: []string{"note0", "note2", "note4", "note6"}},
+		{name: "phrase", query: Query{Text: `"number 3"`}, want: []string{"note3"}},
+		{
+			name:  "created range",
+			query: Query{CreatedFrom: time.Date(2024, 3, 3, 0, 0, 0, 0, time.Local), CreatedUntil: time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)},
+			want:  []string{"note2", "note3"},
+		},
+		{name: "updated descending", query: Query{Sort: SortUpdated, Descending: true, Limit: 3}, want: []string{"note7", "note6", "note5"}},
+		{name: "color then id", query: Query{Sort: SortColor, Text: "home"}, want: []string{"note1", "note5", "note3", "note7"}},
+		{name: "board", query: Query{Board: "work"}, want: []string{"note0", "note3", "note6"}},
+		{name: "checklists", query: Query{Items: ItemsAny}, want: []string{"note1", "note2"}},
+		{name: "open items", query: Query{Items: ItemsOpen}, want: []string{"note1"}},
+		{name: "all items done", query: Query{Items: ItemsDone}, want: []string{"note2"}},
+		{name: "text in items", query: Query{Text: "fence"}, want: []string{"note1"}},
+		{
+			name:  "due range",
+			query: Query{DueFrom: time.Date(2024, 4, 3, 0, 0, 0, 0, time.Local), DueUntil: time.Date(2024, 4, 7, 0, 0, 0, 0, time.Local)},
+			want:  []string{"note3", "note5"},
+		},
+		{name: "due before", query: Query{DueUntil: time.Date(2024, 4, 5, 0, 0, 0, 0, time.Local)}, want: []string{"note1", "note3"}},
+		{name: "default board", query: Query{Board: model.DefaultBoard, Text: "home"}, want: []string{"note1", "note5", "note7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := tt.query.Apply(notes)
+			if err != nil {
+				t.Fatalf("Failed to apply query: %v", err)
+			}
+			if got := noteIDs(page.Notes); got != strings.Join(tt.want, ",") {
+				t.Errorf("Result mismatch, got: %s, want: %s", got, strings.Join(tt.want, ","))
+			}
+		})
+	}
+}
+
+func TestQueryPagination(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	for _, note := range queryTestNotes() {
+		if err := repo.Save(note); err != nil {
+			t.Fatalf("Failed to save note: %v", err)
+		}
+	}
+
+	query := Query{Sort: SortCreated, Descending: true, Limit: 3}
+	var pages []string
+	for {
+		page, err := repo.Find(query)
+		if err != nil {
+			t.Fatalf("Failed to find notes: %v", err)
+		}
+		pages = append(pages, noteIDs(page.Notes))
+		if page.Next == "" {
+			break
+		}
+		query.Cursor = page.Next
+
+		// Notes added behind the cursor must not shift later pages.
+		if len(pages) == 1 {
+			late := &model.Note{ID: "late", Content: "late", Color: model.Yellow, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+			if err := repo.Save(late); err != nil {
+				t.Fatalf("Failed to save note: %v", err)
+			}
+		}
+	}
+
+	want := []string{"note7,note6,note5", "note4,note3,note2", "note1,note0"}
+	if strings.Join(pages, " | ") != strings.Join(want, " | ") {
+		t.Errorf("Pages mismatch, got: %v, want: %v", pages, want)
+	}
+
+	if _, err := repo.Find(Query{Sort: SortUpdated, Cursor: query.Cursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a cursor from another sort order, got: %v", err)
+	}
+	other := query
+	other.Colors = []model.Color{model.Blue}
+	if _, err := repo.Find(other); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a cursor from a query with other filters, got: %v", err)
+	}
+	if _, err := repo.Find(Query{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got: %v", err)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		input   string
+		check   func(Query) bool
+		wantErr bool
+	}{
+		{input: "", check: func(q Query) bool { return q.Text == "" && len(q.Colors) == 0 }},
+		{input: "color:Blue,pink shopping", check: func(q Query) bool {
+			return len(q.Colors) == 2 && q.Colors[0] == model.Blue && q.Text == "shopping"
+		}},
+		{input: "created:2024-01-01..2024-01-31", check: func(q Query) bool {
+			return q.CreatedFrom.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)) &&
+				q.CreatedUntil.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local))
+		}},
+		{input: "updated:2024-03-05", check: func(q Query) bool {
+			return q.UpdatedUntil.Sub(q.UpdatedFrom) == 24*time.Hour
+		}},
+		{input: "updated:..2024-03-05 sort:-updated limit:5", check: func(q Query) bool {
+			return q.UpdatedFrom.IsZero() && q.Sort == SortUpdated && q.Descending && q.Limit == 5
+		}},
+		{input: `"color:red" at http://example.com`, check: func(q Query) bool {
+			return len(q.Colors) == 0 && q.Text == `"color:red" at http://example.com`
+		}},
+		{input: `tag:Work tags:"bug AND NOT done" report`, check: func(q Query) bool {
+			return q.Tags.String() == "work AND bug AND NOT done" && q.Text == "report"
+		}},
+		{input: "board:Work", check: func(q Query) bool {
+			return q.Board == "work"
+		}},
+		{input: "due:..2024-04-30", check: func(q Query) bool {
+			return q.DueFrom.IsZero() && q.DueUntil.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local))
+		}},
+		{input: `tags:"bug AND"`, wantErr: true},
+		{input: "due:tomorrow", wantErr: true},
+		{input: "board:a+b", wantErr: true},
+		{input: "items:Open", check: func(q Query) bool {
+			return q.Items == ItemsOpen
+		}},
+		{input: "items:some", wantErr: true},
+		{input: "color:light-blue!", wantErr: true},
+		{input: "sort:size", wantErr: true},
+		{input: "created:yesterday", wantErr: true},
+		{input: "limit:-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for %q", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.input, err)
+			continue
+		}
+		if !tt.check(q) {
+			t.Errorf("Unexpected query for %q: %+v", tt.input, q)
+		}
+	}
+}
+
+func noteIDs(notes []*model.Note) string {
+	ids := make([]string, len(notes))
+	for i, note := range notes {
+		ids[i] = note.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestChecklistStorage(t *testing.T) {
+	fileRepo, fileDir := setupTestRepo(t)
+	defer cleanupTestRepo(fileDir)
+	logRepo, logDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(logDir)
+	mdRepo, mdDir := setupMarkdownRepo(t)
+	defer cleanupTestRepo(mdDir)
+	defer mdRepo.Close()
+
+	tests := []struct {
+		name string
+		repo NoteRepository
+	}{
+		{name: "file", repo: fileRepo},
+		{name: "jsonl", repo: logRepo},
+		{name: "markdown", repo: mdRepo},
+		{name: "memory", repo: NewMemoryRepository()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			checklist := &model.Note{ID: "c1", Kind: model.KindChecklist, Content: "Groceries", Color: model.Yellow,
+				Items: []model.ChecklistItem{{Text: "milk", Done: true}, {Text: "eggs"}}, CreatedAt: now, UpdatedAt: now}
+			text := &model.Note{ID: "t1", Content: "- [ ] not a checklist", Color: model.Yellow, CreatedAt: now, UpdatedAt: now}
+			for _, note := range []*model.Note{checklist, text} {
+				if err := tt.repo.Save(note); err != nil {
+					t.Fatalf("Failed to save note: %v", err)
+				}
+			}
+
+			got, err := tt.repo.GetById("c1")
+			if err != nil {
+				t.Fatalf("Failed to get note: %v", err)
+			}
+			if got.Kind != model.KindChecklist || got.Content != "Groceries" || fmt.Sprint(got.Items) != fmt.Sprint(checklist.Items) {
+				t.Errorf("Checklist mismatch, got: %+v", got)
+			}
+			if got, _ := tt.repo.GetById("t1"); got.IsChecklist() || got.Content != text.Content {
+				t.Errorf("Text note mismatch, got: %+v", got)
+			}
+
+			page, err := tt.repo.Find(Query{Items: ItemsOpen})
+			if err != nil {
+				t.Fatalf("Failed to find notes: %v", err)
+			}
+			if len(page.Notes) != 1 || page.Notes[0].ID != "c1" {
+				t.Errorf("Expected the open checklist, got: %+v", page.Notes)
+			}
+		})
+	}
+}
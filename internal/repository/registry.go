@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Opener opens a backend for a parsed DSN.
+type Opener func(dsn *url.URL) (NoteRepository, error)
+
+var (
+	backendsMutex sync.RWMutex
+	backends      = make(map[string]Opener)
+)
+
+// Register makes a backend available to Open under a DSN scheme. It panics
+// if the scheme is already registered.
+func Register(scheme string, open Opener) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+
+	if _, exists := backends[scheme]; exists {
+		panic(fmt.Sprintf("repository: backend %q registered twice", scheme))
+	}
+	backends[scheme] = open
+}
+
+// Schemes returns the registered DSN schemes in order.
+func Schemes() []string {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
+
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open opens the backend named by a DSN such as file:///var/notes,
+// jsonl:///var/notes.log, md:///var/notes or mem://. A DSN without a scheme is a file
+// store directory, taken as it is rather than parsed as a URL, so it may
+// contain characters such as # or %. Callers should close the result if it
+// implements io.Closer.
+func Open(dsn string) (NoteRepository, error) {
+	u, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	backendsMutex.RLock()
+	open, ok := backends[u.Scheme]
+	backendsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store scheme %q (available: %s)", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+	return open(u)
+}
+
+// parseDSN parses a DSN that is a URL or starts with a registered scheme,
+// and turns anything else into a file store DSN for that path.
+func parseDSN(dsn string) (*url.URL, error) {
+	scheme, _, found := strings.Cut(dsn, ":")
+	backendsMutex.RLock()
+	_, known := backends[scheme]
+	backendsMutex.RUnlock()
+	if !found || (!known && !strings.Contains(dsn, "://")) {
+		return &url.URL{Scheme: "file", Path: filepath.ToSlash(dsn)}, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store %q: %w", dsn, err)
+	}
+	return u, nil
+}
+
+// DSNPath returns the file system path of a DSN. file:///abs and
+// file://./rel are both accepted, as is the opaque form file:rel.
+func DSNPath(dsn *url.URL) string {
+	if dsn.Opaque != "" {
+		return filepath.FromSlash(dsn.Opaque)
+	}
+	return filepath.FromSlash(dsn.Host + dsn.Path)
+}
+
+func init() {
+	Register("file", func(dsn *url.URL) (NoteRepository, error) {
+		path := DSNPath(dsn)
+		if path == "" {
+			return nil, fmt.Errorf("file store needs a directory, as in file:///path/to/data")
+		}
+		return NewFileRepository(path)
+	})
+	Register("jsonl", func(dsn *url.URL) (NoteRepository, error) {
+		path := DSNPath(dsn)
+		if path == "" {
+			return nil, fmt.Errorf("jsonl store needs a log file, as in jsonl:///path/to/notes.log")
+		}
+		return NewEventLogRepository(path)
+	})
+	Register("md", func(dsn *url.URL) (NoteRepository, error) {
+		path := DSNPath(dsn)
+		if path == "" {
+			return nil, fmt.Errorf("md store needs a directory, as in md:///path/to/notes")
+		}
+		return NewMarkdownRepository(path)
+	})
+	Register("mem", func(*url.URL) (NoteRepository, error) {
+		return NewMemoryRepository(), nil
+	})
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sticky-notes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer cleanupTestRepo(tempDir)
+
+	tests := []struct {
+		name    string
+		dsn     string
+		want    string
+		wantErr string
+	}{
+		{name: "file URL", dsn: "file://" + filepath.ToSlash(filepath.Join(tempDir, "a")), want: "*repository.FileRepository"},
+		{name: "bare path", dsn: filepath.Join(tempDir, "b"), want: "*repository.FileRepository"},
+		{name: "bare path with URL characters", dsn: filepath.Join(tempDir, "dir#1", "100%"), want: "*repository.FileRepository"},
+		{name: "event log", dsn: "jsonl://" + filepath.ToSlash(filepath.Join(tempDir, "notes.log")), want: "*repository.EventLogRepository"},
+		{name: "markdown", dsn: "md://" + filepath.ToSlash(filepath.Join(tempDir, "md")), want: "*repository.MarkdownRepository"},
+		{name: "memory", dsn: "mem://", want: "*repository.MemoryRepository"},
+		{name: "unknown scheme", dsn: "redis://localhost", wantErr: "unknown store scheme"},
+		{name: "file without path", dsn: "file://", wantErr: "needs a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := Open(tt.dsn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", tt.dsn, err)
+			}
+			if closer, ok := repo.(io.Closer); ok {
+				defer closer.Close()
+			}
+			if got := fmt.Sprintf("%T", repo); got != tt.want {
+				t.Errorf("Backend mismatch, got: %s, want: %s", got, tt.want)
+			}
+
+			note := createTestNote()
+			if err := repo.Save(note); err != nil {
+				t.Fatalf("Failed to save note: %v", err)
+			}
+			if _, err := repo.GetById(note.ID); err != nil {
+				t.Errorf("Failed to get note: %v", err)
+			}
+		})
+	}
+
+	// Bare paths are used as they are, not read as URLs.
+	if _, err := os.Stat(filepath.Join(tempDir, "dir#1", "100%", createTestNote().ID+noteExt)); err != nil {
+		t.Errorf("Expected the store in the directory named, got: %v", err)
+	}
+}
+
+func TestDSNPath(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"file:///var/notes", "/var/notes"},
+		{"file://./data", "./data"},
+		{"file:data", "data"},
+		{"jsonl:///tmp/notes.log", "/tmp/notes.log"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.dsn)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tt.dsn, err)
+		}
+		if got := DSNPath(u); got != filepath.FromSlash(tt.want) {
+			t.Errorf("Path mismatch for %s, got: %s, want: %s", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryRepositoryTrash(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+	if err := repo.Delete(note.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	if all, _ := repo.GetAll(); len(all) != 0 {
+		t.Errorf("Expected no live notes, got: %d", len(all))
+	}
+	if trash, _ := repo.ListTrash(); len(trash) != 1 || trash[0].DeletedAt == nil {
+		t.Fatalf("Expected one trashed note, got: %+v", trash)
+	}
+
+	restored, err := repo.Restore(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to restore note: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Error("Expected restored note to have no deletion time")
+	}
+	if _, err := repo.GetById(note.ID); err != nil {
+		t.Errorf("Failed to get restored note: %v", err)
+	}
+}
@@ -1,14 +1,91 @@
 package repository
 
 import (
+	"iter"
+	"sort"
+	"time"
+
 	"github.com/bllexe/sticky-notes/internal/model"
 )
 
 type NoteRepository interface {
 	Save(note *model.Note) error
+	// Update stores a changed note. It fails with a *ConflictError if the
+	// stored note is no longer at note.Version, and on success sets
+	// note.Version to the version stored.
 	Update(note *model.Note) error
 	Delete(id string) error
 	GetById(id string) (*model.Note, error)
 	GetAll() ([]*model.Note, error)
 	Search(query string) ([]*model.Note, error)
+	// Find returns the page of live notes selected by a query.
+	Find(q Query) (*Page, error)
+	// All and SearchSeq stream what GetAll and Search return, so callers
+	// can stop early without loading every note.
+	All() iter.Seq2[*model.Note, error]
+	SearchSeq(query string) iter.Seq2[*model.Note, error]
+}
+
+// RevisionRepository is implemented by backends that keep the previous
+// versions of a note.
+type RevisionRepository interface {
+	// SaveRevision appends a revision to a note's history, assigning its
+	// number.
+	SaveRevision(rev *model.Revision) error
+	// GetRevisions returns a note's revisions, oldest first.
+	GetRevisions(noteID string) ([]*model.Revision, error)
+}
+
+// TrashRepository is implemented by backends whose Delete moves notes to a
+// trash area instead of removing them. Trashed notes are left out of GetAll
+// and Search.
+type TrashRepository interface {
+	ListTrash() ([]*model.Note, error)
+	// Restore moves a note out of the trash and returns it.
+	Restore(id string) (*model.Note, error)
+	// Purge permanently removes a trashed note.
+	Purge(id string) error
+	// PurgeBefore permanently removes notes trashed before cutoff.
+	PurgeBefore(cutoff time.Time) (int, error)
+	// EmptyTrash permanently removes every trashed note.
+	EmptyTrash() (int, error)
+}
+
+var (
+	_ NoteRepository     = (*FileRepository)(nil)
+	_ NoteRepository     = (*EventLogRepository)(nil)
+	_ NoteRepository     = (*MemoryRepository)(nil)
+	_ NoteRepository     = (*MarkdownRepository)(nil)
+	_ RevisionRepository = (*FileRepository)(nil)
+	_ RevisionRepository = (*EventLogRepository)(nil)
+	_ RevisionRepository = (*MemoryRepository)(nil)
+	_ TrashRepository    = (*FileRepository)(nil)
+	_ TrashRepository    = (*MemoryRepository)(nil)
+	_ TxRepository       = (*FileRepository)(nil)
+	_ TxRepository       = (*EventLogRepository)(nil)
+	_ TxRepository       = (*MemoryRepository)(nil)
+	_ WatchRepository    = (*FileRepository)(nil)
+	_ HealthReporter     = (*FileRepository)(nil)
+	_ HealthReporter     = (*MarkdownRepository)(nil)
+	_ TagRepository      = (*FileRepository)(nil)
+	_ TagRepository      = (*EventLogRepository)(nil)
+	_ TagRepository      = (*MemoryRepository)(nil)
+	_ TagRepository      = (*MarkdownRepository)(nil)
+	_ PaletteRepository  = (*FileRepository)(nil)
+	_ PaletteRepository  = (*EventLogRepository)(nil)
+	_ PaletteRepository  = (*MemoryRepository)(nil)
+	_ PaletteRepository  = (*MarkdownRepository)(nil)
+)
+
+func cloneNote(note *model.Note) *model.Note {
+	return note.Clone()
+}
+
+func sortNotes(notes []*model.Note) {
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].CreatedAt.Equal(notes[j].CreatedAt) {
+			return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+		}
+		return notes[i].ID < notes[j].ID
+	})
 }
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// CurrentSchemaVersion is stamped on every note document written. Bump it
+// together with a migration from the previous version whenever the stored
+// shape of model.Note changes. New optional fields are not such a change:
+// documents without them decode to the zero value, and a bump would only
+// make older versions refuse the store.
+const CurrentSchemaVersion = 2
+
+// schemaField is the document key holding the schema version. Documents
+// without it predate versioning and are treated as version 0.
+const schemaField = "schema_version"
+
+// ErrUnsupportedSchema is returned for documents that cannot be upgraded,
+// such as ones written by a newer version of the application.
+var ErrUnsupportedSchema = errors.New("unsupported note schema version")
+
+// Migration upgrades a raw note document from schema version From to
+// From+1 in place.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]any) error
+}
+
+var (
+	migrationsMutex sync.RWMutex
+	migrations      = make(map[int]Migration)
+)
+
+// RegisterMigration adds a migration step. It panics if a step from the
+// same version is already registered.
+func RegisterMigration(m Migration) {
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+
+	if _, exists := migrations[m.From]; exists {
+		panic(fmt.Sprintf("repository: duplicate migration from schema version %d", m.From))
+	}
+	migrations[m.From] = m
+}
+
+// Migrations returns the registered migration steps in order.
+func Migrations() []Migration {
+	migrationsMutex.RLock()
+	defer migrationsMutex.RUnlock()
+
+	steps := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		steps = append(steps, m)
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i].From < steps[j].From })
+	return steps
+}
+
+func init() {
+	RegisterMigration(Migration{
+		From:        0,
+		Description: "normalize color names and fill in missing update times",
+		Apply: func(doc map[string]any) error {
+			if color, ok := doc["color"].(string); ok {
+				doc["color"] = strings.ToLower(strings.TrimSpace(color))
+			}
+			if updated, _ := doc["updated_at"].(string); updated == "" || updated == "0001-01-01T00:00:00Z" {
+				if created, ok := doc["created_at"]; ok {
+					doc["updated_at"] = created
+				}
+			}
+			return nil
+		},
+	})
+	RegisterMigration(Migration{
+		From:        1,
+		Description: "start counting note versions",
+		Apply: func(doc map[string]any) error {
+			if _, ok := doc["version"]; !ok {
+				doc["version"] = 1
+			}
+			return nil
+		},
+	})
+}
+
+// storedNote is the on-disk form of a note.
+type storedNote struct {
+	SchemaVersion int `json:"schema_version"`
+	*model.Note
+}
+
+func encodeNote(note *model.Note) ([]byte, error) {
+	return json.Marshal(storedNote{SchemaVersion: CurrentSchemaVersion, Note: note})
+}
+
+// decodeNote decodes a stored note, upgrading it to the current schema if
+// needed. It also returns the version the document was stored with.
+func decodeNote(data []byte) (*model.Note, int, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, 0, err
+	}
+
+	version := header.SchemaVersion
+	if version > CurrentSchemaVersion {
+		return nil, version, fmt.Errorf("%w: %d is newer than %d", ErrUnsupportedSchema, version, CurrentSchemaVersion)
+	}
+	if version < CurrentSchemaVersion {
+		upgraded, err := migrateDocument(data, version)
+		if err != nil {
+			return nil, version, err
+		}
+		data = upgraded
+	}
+
+	var note model.Note
+	if err := json.Unmarshal(data, &note); err != nil {
+		return nil, version, err
+	}
+	return &note, version, nil
+}
+
+func migrateDocument(data []byte, from int) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	migrationsMutex.RLock()
+	defer migrationsMutex.RUnlock()
+	for version := from; version < CurrentSchemaVersion; version++ {
+		m, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from version %d", ErrUnsupportedSchema, version)
+		}
+		if err := m.Apply(doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate from schema version %d: %w", version, err)
+		}
+	}
+	doc[schemaField] = CurrentSchemaVersion
+	return json.Marshal(doc)
+}
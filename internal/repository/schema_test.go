@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+const legacyNote = `{"id":"legacy","content":"old note","color":" Blue ","created_at":"2024-01-02T03:04:05Z"}`
+
+func TestDecodeLegacyNote(t *testing.T) {
+	note, version, err := decodeNote([]byte(legacyNote))
+	if err != nil {
+		t.Fatalf("Failed to decode legacy note: %v", err)
+	}
+	if version != 0 {
+		t.Errorf("Schema version mismatch, got: %d, want: 0", version)
+	}
+	if note.Color != model.Blue {
+		t.Errorf("Expected color to be normalized, got: %q", note.Color)
+	}
+	if !note.UpdatedAt.Equal(note.CreatedAt) {
+		t.Errorf("Expected missing update time to default to creation time, got: %s", note.UpdatedAt)
+	}
+	if note.Version != 1 {
+		t.Errorf("Note version mismatch, got: %d, want: 1", note.Version)
+	}
+}
+
+func TestEncodeNoteStampsVersion(t *testing.T) {
+	data, err := encodeNote(createTestNote())
+	if err != nil {
+		t.Fatalf("Failed to encode note: %v", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	if doc[schemaField] != float64(CurrentSchemaVersion) {
+		t.Errorf("Schema version mismatch, got: %v, want: %d", doc[schemaField], CurrentSchemaVersion)
+	}
+	if doc["id"] != "test-note-id" {
+		t.Errorf("Expected note fields at the top level, got: %v", doc)
+	}
+}
+
+func TestNewerSchemaIsNotQuarantined(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sticky-notes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer cleanupTestRepo(tempDir)
+
+	path := filepath.Join(tempDir, "future.json")
+	os.WriteFile(path, []byte(`{"schema_version":99,"id":"future"}`), 0644)
+
+	repo, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if len(repo.Recovery().Quarantined) != 0 {
+		t.Error("Expected note from a newer version to be left in place")
+	}
+	if _, err := repo.GetByID("future"); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("Expected ErrUnsupportedSchema, got: %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	os.WriteFile(filepath.Join(tempDir, "legacy.json"), []byte(legacyNote), 0644)
+	if err := repo.Save(createTestNote()); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+
+	report, err := repo.Migrate(MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to run dry migration: %v", err)
+	}
+	if report.Scanned != 2 || len(report.Migrated) != 1 || report.BackupDir != "" {
+		t.Errorf("Unexpected dry run report: %+v", report)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tempDir, "legacy.json")); string(data) != legacyNote {
+		t.Error("Expected dry run to leave files untouched")
+	}
+
+	backupDir := tempDir + "-backup"
+	defer cleanupTestRepo(backupDir)
+	report, err = repo.Migrate(MigrateOptions{BackupDir: backupDir})
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if len(report.Migrated) != 1 || report.BackupDir != backupDir {
+		t.Errorf("Unexpected migration report: %+v", report)
+	}
+	if data, _ := os.ReadFile(filepath.Join(backupDir, "legacy.json")); string(data) != legacyNote {
+		t.Error("Expected backup to hold the original document")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(tempDir, "legacy.json"))
+	if _, version, err := decodeNote(data); err != nil || version != CurrentSchemaVersion {
+		t.Errorf("Expected rewritten note at version %d, got: %d (%v)", CurrentSchemaVersion, version, err)
+	}
+
+	report, _ = repo.Migrate(MigrateOptions{})
+	if len(report.Migrated) != 0 {
+		t.Errorf("Expected nothing left to migrate, got: %d", len(report.Migrated))
+	}
+}
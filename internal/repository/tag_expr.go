@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+type tagOp int
+
+const (
+	tagHas tagOp = iota
+	tagNot
+	tagAnd
+	tagOr
+)
+
+// TagExpr is a boolean condition on a note's tags, such as
+//
+//	bug AND NOT done
+//	(bug OR feature) release/1.2
+//
+// NOT binds tighter than AND, and AND tighter than OR. Tags next to each
+// other without an operator must all be present. A nil TagExpr matches
+// every note.
+type TagExpr struct {
+	op tagOp
+	// tag is set for tagHas, operands for the others.
+	tag      string
+	operands []*TagExpr
+}
+
+// ParseTagExpr reads a tag expression. Operators may be written in any
+// case; tags are normalized like model.NormalizeTag does.
+func ParseTagExpr(input string) (*TagExpr, error) {
+	p := &tagParser{tokens: tagTokens(input)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty tag expression")
+	}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %q in tag expression", token)
+	}
+	return expr, nil
+}
+
+// HasTag returns the expression matching notes that carry tag.
+func HasTag(tag string) (*TagExpr, error) {
+	normalized, err := model.NormalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	return &TagExpr{op: tagHas, tag: normalized}, nil
+}
+
+// AndTags combines expressions so that all of them must match. Nil
+// expressions are left out.
+func AndTags(exprs ...*TagExpr) *TagExpr {
+	var operands []*TagExpr
+	for _, e := range exprs {
+		if e != nil {
+			operands = append(operands, e)
+		}
+	}
+	switch len(operands) {
+	case 0:
+		return nil
+	case 1:
+		return operands[0]
+	}
+	return &TagExpr{op: tagAnd, operands: operands}
+}
+
+// Match reports whether notes with these tags satisfy the expression.
+func (e *TagExpr) Match(tags []string) bool {
+	if e == nil {
+		return true
+	}
+	switch e.op {
+	case tagNot:
+		return !e.operands[0].Match(tags)
+	case tagAnd:
+		for _, operand := range e.operands {
+			if !operand.Match(tags) {
+				return false
+			}
+		}
+		return true
+	case tagOr:
+		for _, operand := range e.operands {
+			if operand.Match(tags) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tag := range tags {
+		if tag == e.tag {
+			return true
+		}
+	}
+	return false
+}
+
+// String writes the expression back in the syntax ParseTagExpr reads, with
+// parentheses only where they are needed.
+func (e *TagExpr) String() string {
+	if e == nil {
+		return ""
+	}
+	switch e.op {
+	case tagNot:
+		operand := e.operands[0]
+		if operand.op == tagAnd || operand.op == tagOr {
+			return "NOT (" + operand.String() + ")"
+		}
+		return "NOT " + operand.String()
+	case tagAnd, tagOr:
+		sep := " AND "
+		if e.op == tagOr {
+			sep = " OR "
+		}
+		parts := make([]string, len(e.operands))
+		for i, operand := range e.operands {
+			parts[i] = operand.String()
+			if e.op == tagAnd && operand.op == tagOr {
+				parts[i] = "(" + parts[i] + ")"
+			}
+		}
+		return strings.Join(parts, sep)
+	}
+	return e.tag
+}
+
+// tagTokens splits an expression into words and parentheses.
+func tagTokens(input string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range input {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// tagParser is a recursive descent parser over the grammar
+//
+//	or   = and { OR and }
+//	and  = not { [AND] not }
+//	not  = NOT not | "(" or ")" | tag
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *tagParser) peek() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword reports whether the next token is the operator word and consumes
+// it if so.
+func (p *tagParser) keyword(word string) bool {
+	token, ok := p.peek()
+	if ok && strings.EqualFold(token, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tagParser) or() (*TagExpr, error) {
+	first, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	operands := []*TagExpr{first}
+	for p.keyword("or") {
+		next, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, next)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &TagExpr{op: tagOr, operands: operands}, nil
+}
+
+func (p *tagParser) and() (*TagExpr, error) {
+	first, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	operands := []*TagExpr{first}
+	for {
+		explicit := p.keyword("and")
+		token, ok := p.peek()
+		if !explicit && (!ok || token == ")" || strings.EqualFold(token, "or")) {
+			break
+		}
+		next, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, next)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &TagExpr{op: tagAnd, operands: operands}, nil
+}
+
+func (p *tagParser) not() (*TagExpr, error) {
+	if p.keyword("not") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &TagExpr{op: tagNot, operands: []*TagExpr{operand}}, nil
+	}
+
+	token, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("tag expression ends too early")
+	}
+	p.pos++
+	switch token {
+	case "(":
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next != ")" {
+			return nil, fmt.Errorf("missing ) in tag expression")
+		}
+		p.pos++
+		return expr, nil
+	case ")":
+		return nil, fmt.Errorf("unexpected ) in tag expression")
+	}
+	if strings.EqualFold(token, "and") || strings.EqualFold(token, "or") {
+		return nil, fmt.Errorf("unexpected %s in tag expression", strings.ToUpper(token))
+	}
+	return HasTag(token)
+}
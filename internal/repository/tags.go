@@ -0,0 +1,58 @@
+package repository
+
+import "sort"
+
+// TagCount is a tag in use and the number of live notes carrying it.
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// TagRepository is implemented by backends that keep an index of the tags
+// on their live notes.
+type TagRepository interface {
+	// Tags returns every tag on a live note with its count, ordered by tag.
+	Tags() ([]TagCount, error)
+}
+
+// tagIndex counts the notes carrying each tag. Backends update it wherever
+// they store or drop a live note and guard it with their own locks.
+type tagIndex struct {
+	notes  map[string][]string
+	counts map[string]int
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{notes: make(map[string][]string), counts: make(map[string]int)}
+}
+
+// set records the tags of a stored note, replacing what was recorded for
+// it before.
+func (x *tagIndex) set(id string, tags []string) {
+	x.remove(id)
+	if len(tags) == 0 {
+		return
+	}
+	x.notes[id] = append([]string(nil), tags...)
+	for _, tag := range tags {
+		x.counts[tag]++
+	}
+}
+
+func (x *tagIndex) remove(id string) {
+	for _, tag := range x.notes[id] {
+		if x.counts[tag]--; x.counts[tag] <= 0 {
+			delete(x.counts, tag)
+		}
+	}
+	delete(x.notes, id)
+}
+
+func (x *tagIndex) list() []TagCount {
+	tags := make([]TagCount, 0, len(x.counts))
+	for tag, count := range x.counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags
+}
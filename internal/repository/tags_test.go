@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		match   []string
+		noMatch []string
+		wantErr bool
+	}{
+		{input: "bug", want: "bug", match: []string{"bug"}, noMatch: []string{"ui"}},
+		{input: "#Bug", want: "bug", match: []string{"bug"}},
+		{input: "bug AND NOT done", want: "bug AND NOT done", match: []string{"bug", "ui"}, noMatch: []string{"bug", "done"}},
+		{input: "bug not done", want: "bug AND NOT done", match: []string{"bug"}},
+		{input: "bug OR feature AND ui", want: "bug OR feature AND ui", match: []string{"bug"}, noMatch: []string{"feature"}},
+		{input: "(bug OR feature) AND ui", want: "(bug OR feature) AND ui", match: []string{"feature", "ui"}, noMatch: []string{"bug"}},
+		{input: "NOT (bug OR feature)", want: "NOT (bug OR feature)", match: []string{"ui"}, noMatch: []string{"feature"}},
+		{input: "release/1.2", want: "release/1.2", match: []string{"release/1.2"}},
+		{input: "", wantErr: true},
+		{input: "bug AND", wantErr: true},
+		{input: "OR bug", wantErr: true},
+		{input: "(bug", wantErr: true},
+		{input: "bug)", wantErr: true},
+		{input: "bug!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseTagExpr(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for %q, got: %s", tt.input, expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.input, err)
+			continue
+		}
+		if got := expr.String(); got != tt.want {
+			t.Errorf("Expression mismatch for %q, got: %s, want: %s", tt.input, got, tt.want)
+		}
+		if tt.match != nil && !expr.Match(tt.match) {
+			t.Errorf("Expected %q to match %v", tt.input, tt.match)
+		}
+		if tt.noMatch != nil && expr.Match(tt.noMatch) {
+			t.Errorf("Expected %q not to match %v", tt.input, tt.noMatch)
+		}
+	}
+}
+
+func TestTagIndex(t *testing.T) {
+	fileRepo, fileDir := setupTestRepo(t)
+	defer cleanupTestRepo(fileDir)
+	logRepo, logDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(logDir)
+	mdRepo, mdDir := setupMarkdownRepo(t)
+	defer cleanupTestRepo(mdDir)
+	defer mdRepo.Close()
+
+	tests := []struct {
+		name string
+		repo NoteRepository
+	}{
+		{name: "file", repo: fileRepo},
+		{name: "jsonl", repo: logRepo},
+		{name: "markdown", repo: mdRepo},
+		{name: "memory", repo: NewMemoryRepository()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			notes := []*model.Note{
+				{ID: "n1", Content: "one", Color: model.Yellow, Tags: []string{"bug", "ui"}, CreatedAt: now, UpdatedAt: now},
+				{ID: "n2", Content: "two", Color: model.Yellow, Tags: []string{"bug"}, CreatedAt: now, UpdatedAt: now},
+				{ID: "n3", Content: "three", Color: model.Yellow, CreatedAt: now, UpdatedAt: now},
+			}
+			for _, note := range notes {
+				if err := tt.repo.Save(note); err != nil {
+					t.Fatalf("Failed to save note: %v", err)
+				}
+			}
+			checkTags(t, tt.repo, map[string]int{"bug": 2, "ui": 1})
+
+			notes[1].Tags = []string{"done"}
+			if err := tt.repo.Update(notes[1]); err != nil {
+				t.Fatalf("Failed to update note: %v", err)
+			}
+			if err := tt.repo.Delete("n1"); err != nil {
+				t.Fatalf("Failed to delete note: %v", err)
+			}
+			checkTags(t, tt.repo, map[string]int{"done": 1})
+
+			expr, _ := ParseTagExpr("done OR ui")
+			page, err := tt.repo.Find(Query{Tags: expr})
+			if err != nil {
+				t.Fatalf("Failed to find notes: %v", err)
+			}
+			if len(page.Notes) != 1 || page.Notes[0].ID != "n2" || len(page.Notes[0].Tags) != 1 {
+				t.Errorf("Expected the tagged note, got: %+v", page.Notes)
+			}
+		})
+	}
+}
+
+func checkTags(t *testing.T, repo NoteRepository, want map[string]int) {
+	t.Helper()
+	tags, err := repo.(TagRepository).Tags()
+	if err != nil {
+		t.Fatalf("Failed to list tags: %v", err)
+	}
+	if len(tags) != len(want) {
+		t.Errorf("Tags mismatch, got: %v, want: %v", tags, want)
+		return
+	}
+	for _, tag := range tags {
+		if want[tag.Tag] != tag.Count {
+			t.Errorf("Count mismatch for %s, got: %d, want: %d", tag.Tag, tag.Count, want[tag.Tag])
+		}
+	}
+}
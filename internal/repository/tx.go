@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// ErrTxDone is returned when a transaction is used after Commit or
+// Rollback.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx stages changes to several notes and applies them all or none. Nothing
+// is visible to readers until Commit.
+type Tx interface {
+	Save(note *model.Note) error
+	// Update stages a changed note. Its version is checked on Commit, which
+	// fails with a *ConflictError if the note was changed in the meantime,
+	// and set to the version stored once the commit succeeds.
+	Update(note *model.Note) error
+	Delete(id string) error
+	// Commit applies the staged changes. On error none of them are applied.
+	Commit() error
+	// Rollback discards the staged changes.
+	Rollback() error
+}
+
+// TxRepository is implemented by backends that support transactions.
+type TxRepository interface {
+	Begin() (Tx, error)
+}
+
+type txKind int
+
+const (
+	txSave txKind = iota
+	txUpdate
+	txDelete
+)
+
+type txOp struct {
+	kind txKind
+	id   string
+	note *model.Note
+	// source is the caller's note, which receives the new version of an
+	// update once it is committed.
+	source *model.Note
+}
+
+// txChange is the outcome of a transaction for one note.
+type txChange struct {
+	id string
+	// note is the note's final version, or nil if it was deleted.
+	note *model.Note
+	// deleted is the note as it was deleted, with DeletedAt set, for
+	// backends that keep a trash.
+	deleted *model.Note
+}
+
+// stagedTx records operations until a backend commits them.
+type stagedTx struct {
+	mutex sync.Mutex
+	ops   []txOp
+	done  bool
+	// commit applies the staged operations for a backend.
+	commit func(ops []txOp) error
+}
+
+func (t *stagedTx) Save(note *model.Note) error {
+	return t.stage(txOp{kind: txSave, id: note.ID, note: cloneNote(note)})
+}
+
+func (t *stagedTx) Update(note *model.Note) error {
+	return t.stage(txOp{kind: txUpdate, id: note.ID, note: cloneNote(note), source: note})
+}
+
+func (t *stagedTx) Delete(id string) error {
+	return t.stage(txOp{kind: txDelete, id: id})
+}
+
+func (t *stagedTx) stage(op txOp) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.done {
+		return ErrTxDone
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+func (t *stagedTx) Commit() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	if len(t.ops) == 0 {
+		return nil
+	}
+	if err := t.commit(t.ops); err != nil {
+		return err
+	}
+	for _, op := range t.ops {
+		if op.source != nil {
+			op.source.Version = op.note.Version
+		}
+	}
+	return nil
+}
+
+func (t *stagedTx) Rollback() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	t.ops = nil
+	return nil
+}
+
+// resolveTx replays staged operations over the current state, which lookup
+// returns (nil for a note that does not exist), and returns the final state
+// of every note touched, in the order they were first touched. It fails
+// like the single-note methods would, for example when updating a note
+// that does not exist or whose version is stale. Updates are given their
+// new version. A note created and deleted again within the transaction is
+// left out, so it never reaches the trash.
+func resolveTx(ops []txOp, lookup func(id string) (*model.Note, error)) ([]txChange, error) {
+	state := make(map[string]*model.Note)
+	deleted := make(map[string]*model.Note)
+	existed := make(map[string]bool)
+	var order []string
+
+	for _, op := range ops {
+		current, touched := state[op.id]
+		if !touched {
+			var err error
+			if current, err = lookup(op.id); err != nil {
+				return nil, err
+			}
+			existed[op.id] = current != nil
+			order = append(order, op.id)
+		}
+
+		switch op.kind {
+		case txSave:
+			state[op.id] = op.note
+			delete(deleted, op.id)
+		case txUpdate:
+			if current == nil {
+				return nil, fmt.Errorf("failed to update note: note %s not found", op.id)
+			}
+			version, err := nextVersion(current, op.note)
+			if err != nil {
+				return nil, err
+			}
+			op.note.Version = version
+			state[op.id] = op.note
+		case txDelete:
+			if current == nil {
+				return nil, fmt.Errorf("failed to delete note: note %s not found", op.id)
+			}
+			trashed := cloneNote(current)
+			now := time.Now()
+			trashed.DeletedAt = &now
+			deleted[op.id] = trashed
+			state[op.id] = nil
+		}
+	}
+
+	changes := make([]txChange, 0, len(order))
+	for _, id := range order {
+		if state[id] == nil && !existed[id] {
+			continue
+		}
+		change := txChange{id: id, note: state[id]}
+		if state[id] == nil {
+			change.deleted = deleted[id]
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// Memory and event log transactions are applied under the repository's
+// write lock, which makes them atomic without a journal.
+
+func (r *MemoryRepository) Begin() (Tx, error) {
+	return &stagedTx{commit: r.commitTx}, nil
+}
+
+func (r *MemoryRepository) commitTx(ops []txOp) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	changes, err := resolveTx(ops, func(id string) (*model.Note, error) {
+		return r.notes[id], nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if change.note != nil {
+			r.notes[change.id] = change.note
+			r.tags.set(change.id, change.note.Tags)
+			continue
+		}
+		delete(r.notes, change.id)
+		r.tags.remove(change.id)
+		if change.deleted != nil {
+			r.trash[change.id] = change.deleted
+		}
+	}
+	return nil
+}
+
+func (r *EventLogRepository) Begin() (Tx, error) {
+	return &stagedTx{commit: r.commitTx}, nil
+}
+
+// commitTx appends the whole transaction as a single batch event, so a
+// crash while appending leaves a torn record that replay discards.
+func (r *EventLogRepository) commitTx(ops []txOp) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	changes, err := resolveTx(ops, func(id string) (*model.Note, error) {
+		return r.notes[id], nil
+	})
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+
+	batch := Event{Type: EventBatch}
+	for _, change := range changes {
+		event := Event{Type: EventDelete, NoteID: change.id}
+		if change.note != nil {
+			event.Type = EventSave
+			if _, exists := r.notes[change.id]; exists {
+				event.Type = EventUpdate
+			}
+			event.Note = change.note
+		}
+		batch.Batch = append(batch.Batch, event)
+	}
+	return r.appendEvent(batch)
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func TestTransactions(t *testing.T) {
+	fileRepo, fileDir := setupTestRepo(t)
+	defer cleanupTestRepo(fileDir)
+	logRepo, logDir := setupEventLogRepo(t)
+	defer cleanupTestRepo(logDir)
+
+	tests := []struct {
+		name string
+		repo NoteRepository
+	}{
+		{name: "file", repo: fileRepo},
+		{name: "jsonl", repo: logRepo},
+		{name: "memory", repo: NewMemoryRepository()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, id := range []string{"note1", "note2"} {
+				if err := tt.repo.Save(&model.Note{ID: id, Content: id, Color: model.Yellow}); err != nil {
+					t.Fatalf("Failed to save note: %v", err)
+				}
+			}
+			txRepo := tt.repo.(TxRepository)
+
+			// A failing operation leaves every note as it was.
+			tx, err := txRepo.Begin()
+			if err != nil {
+				t.Fatalf("Failed to begin transaction: %v", err)
+			}
+			tx.Update(&model.Note{ID: "note1", Content: "changed", Color: model.Blue})
+			tx.Update(&model.Note{ID: "missing", Content: "changed", Color: model.Blue})
+			if err := tx.Commit(); err == nil {
+				t.Fatal("Expected commit to fail for a missing note")
+			}
+			if note, _ := tt.repo.GetById("note1"); note.Content != "note1" {
+				t.Errorf("Content mismatch after failed commit, got: %s, want: note1", note.Content)
+			}
+
+			tx, err = txRepo.Begin()
+			if err != nil {
+				t.Fatalf("Failed to begin transaction: %v", err)
+			}
+			tx.Update(&model.Note{ID: "note1", Content: "changed", Color: model.Blue})
+			tx.Delete("note2")
+			tx.Save(&model.Note{ID: "note3", Content: "note3", Color: model.Green})
+			// A note created and deleted in the same transaction leaves
+			// nothing behind, not even in the trash.
+			tx.Save(&model.Note{ID: "note4", Content: "note4", Color: model.Pink})
+			tx.Delete("note4")
+			if note, _ := tt.repo.GetById("note1"); note.Content != "note1" {
+				t.Error("Staged changes should not be visible before commit")
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Failed to commit transaction: %v", err)
+			}
+			if err := tx.Commit(); err != ErrTxDone {
+				t.Errorf("Expected ErrTxDone, got: %v", err)
+			}
+
+			all, err := tt.repo.GetAll()
+			if err != nil {
+				t.Fatalf("Failed to get notes: %v", err)
+			}
+			if got := noteIDs(all); got != "note1,note3" && got != "note3,note1" {
+				t.Errorf("Notes mismatch, got: %s, want: note1,note3", got)
+			}
+			if note, _ := tt.repo.GetById("note1"); note.Content != "changed" {
+				t.Errorf("Content mismatch, got: %s, want: changed", note.Content)
+			}
+			if trash, ok := tt.repo.(TrashRepository); ok {
+				trashed, err := trash.ListTrash()
+				if err != nil || len(trashed) != 1 || trashed[0].ID != "note2" {
+					t.Errorf("Expected note2 in the trash, got: %+v (%v)", trashed, err)
+				}
+			}
+
+			tx, _ = txRepo.Begin()
+			tx.Delete("note3")
+			if err := tx.Rollback(); err != nil {
+				t.Fatalf("Failed to roll back: %v", err)
+			}
+			if _, err := tt.repo.GetById("note3"); err != nil {
+				t.Errorf("Rolled back delete was applied: %v", err)
+			}
+		})
+	}
+
+	reopened := reopenEventLogRepo(t, logRepo)
+	if note, err := reopened.GetById("note1"); err != nil || note.Content != "changed" {
+		t.Errorf("Batch was not replayed: %+v (%v)", note, err)
+	}
+	if history := reopened.History("note2"); len(history) != 2 || history[1].Type != EventDelete {
+		t.Errorf("Expected the batched delete in the history, got: %+v", history)
+	}
+	if history := reopened.History("note4"); len(history) != 0 {
+		t.Errorf("Expected no history for a note that never existed, got: %+v", history)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	repo, tempDir := setupTestRepo(t)
+	defer cleanupTestRepo(tempDir)
+
+	note := createTestNote()
+	if err := repo.Save(note); err != nil {
+		t.Fatalf("Failed to save note: %v", err)
+	}
+
+	// Simulate a crash after the journal was written but before the notes
+	// were: the next open rolls the transaction forward.
+	changed := *note
+	changed.Content = "changed"
+	after, err := repo.marshalNote(&changed, repo.notePath(note.ID))
+	if err != nil {
+		t.Fatalf("Failed to encode note: %v", err)
+	}
+	added, err := repo.marshalNote(&model.Note{ID: "added", Content: "added", Color: model.Pink}, repo.notePath("added"))
+	if err != nil {
+		t.Fatalf("Failed to encode note: %v", err)
+	}
+	j := &journal{Version: 1, Time: time.Now(), Entries: []journalEntry{
+		{Path: note.ID + noteExt, Existed: true, After: after},
+		{Path: "added" + noteExt, After: added},
+	}}
+	if err := repo.writeJournal(j); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+
+	reopened, err := NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	if got := reopened.Recovery().Replayed; len(got) != 2 {
+		t.Errorf("Expected two replayed files, got: %v", got)
+	}
+	if got, _ := reopened.GetById(note.ID); got.Content != "changed" {
+		t.Errorf("Content mismatch, got: %s, want: changed", got.Content)
+	}
+	if _, err := reopened.GetById("added"); err != nil {
+		t.Errorf("Failed to get added note: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, journalFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed, got: %v", err)
+	}
+}
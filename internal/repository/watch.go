@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoNativeWatcher is returned by newNativeWatcher on platforms without
+// file change notifications.
+var errNoNativeWatcher = errors.New("file change notifications are not supported on this platform")
+
+// dirWatcher reports the names of files in a directory that may have
+// changed.
+type dirWatcher interface {
+	changes() <-chan watchBatch
+	close() error
+}
+
+// watchBatch is a set of files that may have changed.
+type watchBatch struct {
+	// names are files whose writes were completed.
+	names []string
+	// found are files that were already in a directory when it started to
+	// be watched. They may still be being written, so one that cannot be
+	// read is left to the event reporting its completion.
+	found []string
+	// rescan means anything may have changed and the whole directory
+	// should be rescanned.
+	rescan bool
+}
+
+// pollWatcher asks for a rescan at a fixed interval.
+type pollWatcher struct {
+	ch   chan watchBatch
+	done chan struct{}
+}
+
+func newPollWatcher(interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		ch:   make(chan watchBatch),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(w.ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-w.done:
+				return
+			}
+			select {
+			case w.ch <- watchBatch{rescan: true}:
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+func (w *pollWatcher) changes() <-chan watchBatch {
+	return w.ch
+}
+
+func (w *pollWatcher) close() error {
+	close(w.done)
+	return nil
+}
@@ -0,0 +1,163 @@
+//go:build linux
+
+package repository
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// inotifyMask selects the events that mean a file's contents are complete
+// or gone. Creating and writing a file are reported once it is closed.
+// IN_CREATE is only acted on for directories, so shards made after the
+// watch started are watched too.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+	syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_CREATE
+
+// inotifyWatcher reports changes with inotify(7). It watches the directory
+// and its shard subdirectories.
+type inotifyWatcher struct {
+	fd   int
+	root int
+	dir  string
+	file *os.File
+	ch   chan watchBatch
+	done chan struct{}
+}
+
+func newNativeWatcher(dir string) (dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start inotify: %w", err)
+	}
+	root, err := syscall.InotifyAddWatch(fd, dir, inotifyMask)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if isShardDir(entry) {
+			if _, err := syscall.InotifyAddWatch(fd, filepath.Join(dir, entry.Name()), inotifyMask); err != nil {
+				syscall.Close(fd)
+				return nil, fmt.Errorf("failed to watch %s: %w", entry.Name(), err)
+			}
+		}
+	}
+
+	// The descriptor is non-blocking, so reads go through the runtime
+	// poller and Close interrupts a pending read.
+	w := &inotifyWatcher{
+		fd:   fd,
+		root: root,
+		dir:  dir,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		ch:   make(chan watchBatch),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *inotifyWatcher) run() {
+	defer close(w.ch)
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		names, dirs, rescan := parseInotify(buf[:n], w.root)
+		batch := watchBatch{names: names, rescan: rescan}
+		for _, name := range dirs {
+			batch.found = append(batch.found, w.watchShard(name)...)
+		}
+		if !rescan && len(batch.names) == 0 && len(batch.found) == 0 {
+			continue
+		}
+		select {
+		case w.ch <- batch:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// parseInotify returns the file names in a buffer of inotify events, the
+// shard directories created in the watched directory, and whether events
+// were lost or a watched directory went away.
+func parseInotify(buf []byte, root int) ([]string, []string, bool) {
+	var names, dirs []string
+	rescan := false
+	for off := 0; off+syscall.SizeofInotifyEvent <= len(buf); {
+		wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+		mask := binary.NativeEndian.Uint32(buf[off+4:])
+		length := int(binary.NativeEndian.Uint32(buf[off+12:]))
+		start := off + syscall.SizeofInotifyEvent
+		if start+length > len(buf) {
+			break
+		}
+		off = start + length
+		if mask&(syscall.IN_Q_OVERFLOW|syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0 {
+			rescan = true
+		}
+		name := string(bytes.TrimRight(buf[start:start+length], "\x00"))
+		if name == "" {
+			continue
+		}
+		if mask&syscall.IN_ISDIR != 0 {
+			if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && int(wd) == root &&
+				len(name) == shardWidth && !strings.HasPrefix(name, ".") {
+				dirs = append(dirs, name)
+			}
+			continue
+		}
+		if mask&syscall.IN_CREATE != 0 {
+			// Wait for the file to be closed.
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, dirs, rescan
+}
+
+// watchShard watches a shard created after the watch started and returns
+// the note files already in it, which may have been renamed into place
+// before the watch was added. Temp files are left out: now that the shard
+// is watched, their rename is reported.
+func (w *inotifyWatcher) watchShard(name string) []string {
+	dir := filepath.Join(w.dir, name)
+	if _, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask); err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isNoteName(entry.Name()) {
+			names = append(names, filepath.Join(name, entry.Name()))
+		}
+	}
+	return names
+}
+
+func (w *inotifyWatcher) changes() <-chan watchBatch {
+	return w.ch
+}
+
+func (w *inotifyWatcher) close() error {
+	close(w.done)
+	return w.file.Close()
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package repository
+
+// Other platforms always fall back to polling.
+func newNativeWatcher(dir string) (dirWatcher, error) {
+	return nil, errNoNativeWatcher
+}
@@ -0,0 +1,216 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// BM25 tuning parameters.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Result is a note matching a query together with its relevance score.
+type Result struct {
+	Note  *model.Note
+	Score float64
+}
+
+type document struct {
+	note      *model.Note
+	length    int
+	positions map[string][]int
+}
+
+// Index is an inverted index over note content. It is safe for concurrent
+// use.
+type Index struct {
+	mutex    sync.RWMutex
+	docs     map[string]*document
+	postings map[string]map[string]struct{}
+	totalLen int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+// Add indexes a note, replacing any previous version with the same ID.
+func (idx *Index) Add(note *model.Note) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.remove(note.ID)
+
+	doc := &document{
+		note:      note.Clone(),
+		positions: make(map[string][]int),
+	}
+	for _, token := range Tokenize(note.Text()) {
+		doc.positions[token.Term] = append(doc.positions[token.Term], token.Pos)
+		doc.length++
+	}
+	for term := range doc.positions {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]struct{})
+		}
+		idx.postings[term][note.ID] = struct{}{}
+	}
+	idx.docs[note.ID] = doc
+	idx.totalLen += doc.length
+}
+
+// Remove drops a note from the index.
+func (idx *Index) Remove(id string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.remove(id)
+}
+
+// Len returns the number of indexed notes.
+func (idx *Index) Len() int {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	return len(idx.docs)
+}
+
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.positions {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLen -= doc.length
+	delete(idx.docs, id)
+}
+
+// Search returns the notes matching every clause of the query, best match
+// first. See parseQuery for the query syntax.
+func (idx *Index) Search(query string) ([]Result, error) {
+	clauses, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(clauses) == 0 {
+		return nil, nil
+	}
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	scores := make(map[string]float64)
+	for i, c := range clauses {
+		matches := idx.match(c)
+		if i == 0 {
+			for id := range matches {
+				scores[id] = 0
+			}
+		} else {
+			for id := range scores {
+				if _, ok := matches[id]; !ok {
+					delete(scores, id)
+				}
+			}
+		}
+		idf := idx.idf(len(matches))
+		for id := range scores {
+			scores[id] += idx.bm25(idf, matches[id], idx.docs[id].length)
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{Note: idx.docs[id].note.Clone(), Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Note.UpdatedAt.After(results[j].Note.UpdatedAt)
+	})
+	return results, nil
+}
+
+// match returns the term frequency of a clause in every document it
+// matches.
+func (idx *Index) match(c clause) map[string]int {
+	freqs := make(map[string]int)
+	switch c.kind {
+	case termClause:
+		for id := range idx.postings[c.terms[0]] {
+			freqs[id] = len(idx.docs[id].positions[c.terms[0]])
+		}
+	case prefixClause:
+		for term, ids := range idx.postings {
+			if !strings.HasPrefix(term, c.terms[0]) {
+				continue
+			}
+			for id := range ids {
+				freqs[id] += len(idx.docs[id].positions[term])
+			}
+		}
+	case phraseClause:
+		for id := range idx.postings[c.terms[0]] {
+			if n := phraseCount(idx.docs[id], c.terms); n > 0 {
+				freqs[id] = n
+			}
+		}
+	}
+	return freqs
+}
+
+// phraseCount counts the positions where terms occur consecutively.
+func phraseCount(doc *document, terms []string) int {
+	count := 0
+	for _, start := range doc.positions[terms[0]] {
+		found := true
+		for offset, term := range terms[1:] {
+			if !containsInt(doc.positions[term], start+offset+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+	return count
+}
+
+func containsInt(sorted []int, v int) bool {
+	i := sort.SearchInts(sorted, v)
+	return i < len(sorted) && sorted[i] == v
+}
+
+func (idx *Index) idf(docFreq int) float64 {
+	n := float64(len(idx.docs))
+	df := float64(docFreq)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+func (idx *Index) bm25(idf float64, freq, length int) float64 {
+	if freq == 0 {
+		return 0
+	}
+	avg := float64(idx.totalLen) / float64(len(idx.docs))
+	if avg == 0 {
+		avg = 1
+	}
+	tf := float64(freq)
+	return idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(length)/avg))
+}
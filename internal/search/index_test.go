@@ -0,0 +1,160 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+func setupTestIndex() *Index {
+	idx := NewIndex()
+	notes := []*model.Note{
+		{ID: "pie", Content: "Apple pie recipe: apples, butter, apple juice"},
+		{ID: "shopping", Content: "Shopping list - milk, bread, apple"},
+		{ID: "pineapple", Content: "Pineapple smoothie"},
+		{ID: "meeting", Content: "Meeting notes: review the release plan"},
+		{ID: "plan", Content: "Plan the release review"},
+	}
+	for _, note := range notes {
+		idx.Add(note)
+	}
+	return idx
+}
+
+func resultIDs(results []Result) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Note.ID
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Hello, World! it's 2024")
+	want := []string{"hello", "world", "it", "s", "2024"}
+
+	if len(tokens) != len(want) {
+		t.Fatalf("Token count mismatch, got: %d, want: %d", len(tokens), len(want))
+	}
+	for i, token := range tokens {
+		if token.Term != want[i] || token.Pos != i {
+			t.Errorf("Token %d mismatch, got: %+v, want: %s at %d", i, token, want[i], i)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := setupTestIndex()
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "Whole Word Ranked By Frequency",
+			query: "apple",
+			want:  []string{"pie", "shopping"},
+		},
+		{
+			name:  "Case Insensitive",
+			query: "APPLE",
+			want:  []string{"pie", "shopping"},
+		},
+		{
+			name:  "All Terms Required",
+			query: "apple milk",
+			want:  []string{"shopping"},
+		},
+		{
+			name:  "Prefix",
+			query: "pine*",
+			want:  []string{"pineapple"},
+		},
+		{
+			name:  "Phrase",
+			query: `"release plan"`,
+			want:  []string{"meeting"},
+		},
+		{
+			name:  "No Match",
+			query: "banana",
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := idx.Search(tt.query)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := resultIDs(results)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Results mismatch, got: %v, want: %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Results mismatch, got: %v, want: %v", got, tt.want)
+				}
+			}
+			for _, result := range results {
+				if result.Score <= 0 {
+					t.Errorf("Expected positive score for %s, got: %f", result.Note.ID, result.Score)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchUnterminatedPhrase(t *testing.T) {
+	idx := setupTestIndex()
+
+	if _, err := idx.Search(`"release plan`); err == nil {
+		t.Error("Expected error for unterminated phrase, got nil")
+	}
+}
+
+func TestIndexUpdateAndRemove(t *testing.T) {
+	idx := setupTestIndex()
+
+	idx.Add(&model.Note{ID: "shopping", Content: "Buy bananas"})
+	results, _ := idx.Search("milk")
+	if len(results) != 0 {
+		t.Errorf("Expected replaced content to be unindexed, got: %v", resultIDs(results))
+	}
+	results, _ = idx.Search("bananas")
+	if len(results) != 1 {
+		t.Errorf("Expected new content to be indexed, got: %v", resultIDs(results))
+	}
+
+	idx.Remove("shopping")
+	results, _ = idx.Search("bananas")
+	if len(results) != 0 {
+		t.Errorf("Expected removed note to be unindexed, got: %v", resultIDs(results))
+	}
+	if idx.Len() != 4 {
+		t.Errorf("Index size mismatch, got: %d, want: 4", idx.Len())
+	}
+}
+
+func TestIndexKeepsCopies(t *testing.T) {
+	idx := NewIndex()
+	note := &model.Note{ID: "trip", Content: "Pack for the trip", Tags: []string{"travel"}, Kind: model.KindChecklist,
+		Items: []model.ChecklistItem{{Text: "passport"}}}
+	idx.Add(note)
+	note.Tags[0] = "changed"
+
+	results, _ := idx.Search("passport")
+	if len(results) != 1 || results[0].Note.Tags[0] != "travel" {
+		t.Fatalf("Expected the indexed note to keep its tags, got: %+v", results)
+	}
+	results[0].Note.Tags[0] = "changed"
+	results[0].Note.Items[0].Done = true
+
+	results, _ = idx.Search("passport")
+	if results[0].Note.Tags[0] != "travel" || results[0].Note.Items[0].Done {
+		t.Errorf("Expected changes to a result to leave the index alone, got: %+v", results[0].Note)
+	}
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+type clauseKind int
+
+const (
+	termClause clauseKind = iota
+	prefixClause
+	phraseClause
+)
+
+// clause is one part of a query. Every clause must match for a note to be
+// part of the results.
+type clause struct {
+	kind  clauseKind
+	terms []string
+}
+
+// parseQuery splits a query into clauses. Words match whole terms, a word
+// ending in '*' matches every term with that prefix and text in double
+// quotes matches the exact phrase.
+func parseQuery(query string) ([]clause, error) {
+	var clauses []clause
+	rest := query
+	for {
+		start := strings.IndexByte(rest, '"')
+		if start < 0 {
+			clauses = append(clauses, parseWords(rest)...)
+			break
+		}
+		end := strings.IndexByte(rest[start+1:], '"')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated phrase in query: %q", query)
+		}
+		clauses = append(clauses, parseWords(rest[:start])...)
+
+		phrase := terms(rest[start+1 : start+1+end])
+		switch len(phrase) {
+		case 0:
+		case 1:
+			clauses = append(clauses, clause{kind: termClause, terms: phrase})
+		default:
+			clauses = append(clauses, clause{kind: phraseClause, terms: phrase})
+		}
+		rest = rest[start+end+2:]
+	}
+	return clauses, nil
+}
+
+func parseWords(text string) []clause {
+	var clauses []clause
+	for _, word := range strings.Fields(text) {
+		prefix := strings.HasSuffix(word, "*")
+		wordTerms := terms(word)
+		for i, term := range wordTerms {
+			kind := termClause
+			// Only the last term of a word like "re-use*" is a prefix.
+			if prefix && i == len(wordTerms)-1 {
+				kind = prefixClause
+			}
+			clauses = append(clauses, clause{kind: kind, terms: []string{term}})
+		}
+	}
+	return clauses
+}
@@ -0,0 +1,34 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a normalized word and its position within the text.
+type Token struct {
+	Term string
+	Pos  int
+}
+
+// Tokenize splits text into lowercase terms on anything that is not a letter
+// or a digit, so word boundaries are respected and punctuation is ignored.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, field := range fields {
+		tokens = append(tokens, Token{Term: strings.ToLower(field), Pos: i})
+	}
+	return tokens
+}
+
+func terms(text string) []string {
+	tokens := Tokenize(text)
+	out := make([]string, len(tokens))
+	for i, token := range tokens {
+		out[i] = token.Term
+	}
+	return out
+}
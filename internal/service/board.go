@@ -0,0 +1,355 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// Arrangement is a way of laying out the notes of a board.
+type Arrangement string
+
+const (
+	// ArrangeGrid puts the notes in rows and columns of equal cells,
+	// oldest first.
+	ArrangeGrid Arrangement = "grid"
+	// ArrangeCascade stacks the notes diagonally, the most recently
+	// updated on top.
+	ArrangeCascade Arrangement = "cascade"
+	// ArrangeByColor packs the notes of each color into rows of their own,
+	// in palette order.
+	ArrangeByColor Arrangement = "color"
+)
+
+const (
+	// boardMargin is the space around and between arranged notes.
+	boardMargin = 20
+	// cascadeStep is how far each note of a cascade is moved from the one
+	// below it, in both directions.
+	cascadeStep = 30
+	// packWidth is how wide a row of notes of one color may grow before
+	// the next note starts a new row.
+	packWidth = 1200
+)
+
+// BoardSummary is a board and the number of live notes on it.
+type BoardSummary struct {
+	Name  string
+	Notes int
+}
+
+// Overlap is two notes of a board covering the same area.
+type Overlap struct {
+	// Below is drawn under Above.
+	Below, Above *model.Note
+	Area         model.Rect
+}
+
+// Boards lists the boards that have live notes, ordered by name.
+func (s *NoteService) Boards() ([]BoardSummary, error) {
+	counts := make(map[string]int)
+	for note, err := range s.repo.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to list boards: %w", err)
+		}
+		counts[note.Board()]++
+	}
+	boards := make([]BoardSummary, 0, len(counts))
+	for name, count := range counts {
+		boards = append(boards, BoardSummary{Name: name, Notes: count})
+	}
+	sort.Slice(boards, func(i, j int) bool { return boards[i].Name < boards[j].Name })
+	return boards, nil
+}
+
+// BoardNotes returns the live notes on a board from back to front. Notes
+// that have not been placed yet come last, oldest first.
+func (s *NoteService) BoardNotes(board string) ([]*model.Note, error) {
+	board, err := model.NormalizeBoard(board)
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.repo.Find(repository.Query{Board: board})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the notes of board %s: %w", board, err)
+	}
+	notes := page.Notes
+	sort.SliceStable(notes, func(i, j int) bool {
+		a, b := notes[i].Geometry, notes[j].Geometry
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+		return a != nil && a.Z < b.Z
+	})
+	return notes, nil
+}
+
+// MoveNote puts the top left corner of a note at x, y on its board.
+func (s *NoteService) MoveNote(id string, x, y int) (*model.Note, error) {
+	return s.place(id, func(g *model.Geometry) error {
+		g.X, g.Y = x, y
+		return nil
+	})
+}
+
+// ResizeNote changes the width and height of a note.
+func (s *NoteService) ResizeNote(id string, width, height int) (*model.Note, error) {
+	return s.place(id, func(g *model.Geometry) error {
+		g.Width, g.Height = width, height
+		return nil
+	})
+}
+
+// BringToFront puts a note above every other note on its board.
+func (s *NoteService) BringToFront(id string) (*model.Note, error) {
+	return s.place(id, func(g *model.Geometry) error {
+		top, err := s.topZ(g.Board, id)
+		if err != nil {
+			return err
+		}
+		if g.Z <= top {
+			g.Z = top + 1
+		}
+		return nil
+	})
+}
+
+// MoveNoteToBoard puts a note on another board, in front of the notes
+// there. It keeps its position and size.
+func (s *NoteService) MoveNoteToBoard(id, board string) (*model.Note, error) {
+	board, err := model.NormalizeBoard(board)
+	if err != nil {
+		return nil, err
+	}
+	return s.place(id, func(g *model.Geometry) error {
+		if g.Board == board {
+			return nil
+		}
+		top, err := s.topZ(board, id)
+		if err != nil {
+			return err
+		}
+		g.Board, g.Z = board, top+1
+		return nil
+	})
+}
+
+// ArrangeBoard lays out every note on a board, all or none, and returns
+// the notes that moved. Notes keep their size; their stacking order
+// follows the arrangement.
+func (s *NoteService) ArrangeBoard(board string, how Arrangement) ([]*model.Note, error) {
+	notes, err := s.BoardNotes(board)
+	if err != nil {
+		return nil, err
+	}
+	board, _ = model.NormalizeBoard(board)
+	geometries := make([]*model.Geometry, len(notes))
+	for i, note := range notes {
+		geometries[i] = geometryOf(note, board)
+	}
+
+	switch how {
+	case ArrangeGrid:
+		sortNotes(notes, geometries, func(a, b *model.Note) bool { return a.CreatedAt.Before(b.CreatedAt) })
+		arrangeGrid(geometries)
+	case ArrangeCascade:
+		sortNotes(notes, geometries, func(a, b *model.Note) bool { return a.UpdatedAt.Before(b.UpdatedAt) })
+		for i, g := range geometries {
+			g.X, g.Y = boardMargin+i*cascadeStep, boardMargin+i*cascadeStep
+		}
+	case ArrangeByColor:
+		palette, err := s.Palette()
+		if err != nil {
+			return nil, err
+		}
+		rank := make(map[model.Color]int, len(palette.Colors))
+		for i, c := range palette.Colors {
+			rank[c.Name] = i
+		}
+		colorRank := func(c model.Color) int {
+			if r, ok := rank[c]; ok {
+				return r
+			}
+			return len(rank)
+		}
+		sortNotes(notes, geometries, func(a, b *model.Note) bool {
+			if ra, rb := colorRank(a.Color), colorRank(b.Color); ra != rb {
+				return ra < rb
+			}
+			if a.Color != b.Color {
+				return a.Color < b.Color
+			}
+			return a.CreatedAt.Before(b.CreatedAt)
+		})
+		packByColor(notes, geometries)
+	default:
+		return nil, fmt.Errorf("unknown arrangement %q", how)
+	}
+	for i, g := range geometries {
+		g.Z = i + 1
+	}
+
+	var moved []*model.Note
+	err = s.Transaction(func(tx repository.Tx) error {
+		for i, note := range notes {
+			if note.Geometry != nil && *note.Geometry == *geometries[i] {
+				continue
+			}
+			if err := geometries[i].Validate(); err != nil {
+				return fmt.Errorf("cannot place note %s: %w", note.ID, err)
+			}
+			note.Geometry = geometries[i]
+			if err := tx.Update(note); err != nil {
+				return err
+			}
+			moved = append(moved, note)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// Overlaps finds the placed notes of a board that cover part of another,
+// each pair once with the lower note first.
+func (s *NoteService) Overlaps(board string) ([]Overlap, error) {
+	notes, err := s.BoardNotes(board)
+	if err != nil {
+		return nil, err
+	}
+	var overlaps []Overlap
+	for i, below := range notes {
+		if below.Geometry == nil {
+			break
+		}
+		for _, above := range notes[i+1:] {
+			if above.Geometry == nil {
+				break
+			}
+			if area, ok := below.Geometry.Rect().Intersect(above.Geometry.Rect()); ok {
+				overlaps = append(overlaps, Overlap{Below: below, Above: above, Area: area})
+			}
+		}
+	}
+	return overlaps, nil
+}
+
+// place applies change to a note's geometry and saves the note if the
+// geometry changed. A note that has not been placed yet starts at the top
+// left corner of the default board. Placing a note is not an edit: its
+// update time and history are left alone.
+func (s *NoteService) place(id string, change func(g *model.Geometry) error) (*model.Note, error) {
+	note, err := s.repo.GetById(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+	geometry := geometryOf(note, model.DefaultBoard)
+	if err := change(geometry); err != nil {
+		return nil, err
+	}
+	if err := geometry.Validate(); err != nil {
+		return nil, err
+	}
+	if note.Geometry != nil && *note.Geometry == *geometry {
+		return note, nil
+	}
+
+	previous := note.Clone()
+	note.Geometry = geometry
+	if err := s.repo.Update(note); err != nil {
+		return nil, fmt.Errorf("failed to update note: %w", err)
+	}
+	s.indexNote(note)
+	s.publish(events.Updated, previous, note)
+	return note, nil
+}
+
+// topZ returns the highest z of the placed notes on a board other than
+// the note with id exclude, or 0 if there are none.
+func (s *NoteService) topZ(board, exclude string) (int, error) {
+	page, err := s.repo.Find(repository.Query{Board: board})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the notes of board %s: %w", board, err)
+	}
+	top, found := 0, false
+	for _, note := range page.Notes {
+		if note.ID == exclude || note.Geometry == nil {
+			continue
+		}
+		if !found || note.Geometry.Z > top {
+			top, found = note.Geometry.Z, true
+		}
+	}
+	return top, nil
+}
+
+// geometryOf returns a copy of a note's geometry, or a new one on board
+// for notes not placed yet.
+func geometryOf(note *model.Note, board string) *model.Geometry {
+	if note.Geometry == nil {
+		return model.NewGeometry(board)
+	}
+	geometry := *note.Geometry
+	return &geometry
+}
+
+// sortNotes orders notes by less, keeping geometries in step.
+func sortNotes(notes []*model.Note, geometries []*model.Geometry, less func(a, b *model.Note) bool) {
+	order := make([]int, len(notes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := notes[order[i]], notes[order[j]]
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.ID < b.ID
+	})
+	sortedNotes := make([]*model.Note, len(notes))
+	sortedGeometries := make([]*model.Geometry, len(notes))
+	for i, j := range order {
+		sortedNotes[i], sortedGeometries[i] = notes[j], geometries[j]
+	}
+	copy(notes, sortedNotes)
+	copy(geometries, sortedGeometries)
+}
+
+// arrangeGrid places notes in a square grid with cells the size of the
+// largest note.
+func arrangeGrid(geometries []*model.Geometry) {
+	if len(geometries) == 0 {
+		return
+	}
+	columns := int(math.Ceil(math.Sqrt(float64(len(geometries)))))
+	cellWidth, cellHeight := 0, 0
+	for _, g := range geometries {
+		cellWidth, cellHeight = max(cellWidth, g.Width), max(cellHeight, g.Height)
+	}
+	for i, g := range geometries {
+		g.X = boardMargin + (i%columns)*(cellWidth+boardMargin)
+		g.Y = boardMargin + (i/columns)*(cellHeight+boardMargin)
+	}
+}
+
+// packByColor fills rows from the left, starting a new row for each color
+// and whenever a row would grow wider than packWidth. Notes must be
+// ordered by color.
+func packByColor(notes []*model.Note, geometries []*model.Geometry) {
+	x, y, rowHeight := boardMargin, boardMargin, 0
+	for i, g := range geometries {
+		newColor := i > 0 && notes[i].Color != notes[i-1].Color
+		if i > 0 && (newColor || x+g.Width > boardMargin+packWidth) {
+			x, y, rowHeight = boardMargin, y+rowHeight+boardMargin, 0
+		}
+		g.X, g.Y = x, y
+		x += g.Width + boardMargin
+		rowHeight = max(rowHeight, g.Height)
+	}
+}
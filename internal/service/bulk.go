@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// ErrTransactionsUnsupported is returned by bulk operations when the
+// storage backend cannot change several notes atomically.
+var ErrTransactionsUnsupported = errors.New("note store does not support transactions")
+
+// Transaction runs fn in a repository transaction and commits it if fn
+// returns nil; otherwise nothing fn staged is applied. The search index is
+// rebuilt after a commit since fn may have changed any note, and an event
+// is published for every operation fn staged.
+func (s *NoteService) Transaction(fn func(tx repository.Tx) error) error {
+	txRepo, ok := s.repo.(repository.TxRepository)
+	if !ok {
+		return ErrTransactionsUnsupported
+	}
+	tx, err := txRepo.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	recorder := s.recordTx(tx)
+	if err := fn(recorder); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.resetIndex()
+	recorder.publish()
+	return nil
+}
+
+// RecolorNotes changes the color of every note in ids, all or none.
+func (s *NoteService) RecolorNotes(ids []string, color model.Color) ([]*model.Note, error) {
+	if err := s.checkColor(color, ""); err != nil {
+		return nil, err
+	}
+
+	var previous, updated []*model.Note
+	err := s.Transaction(func(tx repository.Tx) error {
+		for _, id := range ids {
+			note, err := s.repo.GetById(id)
+			if err != nil {
+				return fmt.Errorf("failed to get note %s: %w", id, err)
+			}
+			if note.Color == color {
+				continue
+			}
+			before := *note
+			note.Color = color
+			note.UpdatedAt = time.Now()
+			if err := tx.Update(note); err != nil {
+				return err
+			}
+			previous = append(previous, &before)
+			updated = append(updated, note)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, note := range previous {
+		if err := s.saveRevision(note); err != nil {
+			return updated, fmt.Errorf("notes were recolored but their history was not saved: %w", err)
+		}
+	}
+	return updated, nil
+}
+
+// DeleteNotes moves every note in ids to the trash, all or none, or removes
+// them for good if the storage backend has no trash. It reports whether the
+// notes went to the trash.
+func (s *NoteService) DeleteNotes(ids []string) (bool, error) {
+	err := s.Transaction(func(tx repository.Tx) error {
+		for _, id := range ids {
+			if err := tx.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	_, err = s.trash()
+	return err == nil, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+)
+
+// CreateChecklist saves a new checklist with a title and open items. An
+// empty color means the palette's default.
+func (s *NoteService) CreateChecklist(title string, color model.Color, items []string, tags ...string) (*model.Note, error) {
+	list, err := checklistItems(items)
+	if err != nil {
+		return nil, err
+	}
+	note, err := s.newNote(strings.TrimRight(title, "\n"), color, tags)
+	if err != nil {
+		return nil, err
+	}
+	note.Kind, note.Items = model.KindChecklist, list
+	return s.saveNew(note)
+}
+
+// ConvertToChecklist turns a text note into a checklist. Its content is
+// read as plain-text "- [ ]" syntax: the lines before the first list line
+// become the title and the list lines the items.
+func (s *NoteService) ConvertToChecklist(id string) (*model.Note, error) {
+	return s.editNote(id, func(note *model.Note) error {
+		if note.IsChecklist() {
+			return fmt.Errorf("note %s is already a checklist", id)
+		}
+		text := note.Text()
+		note.Kind = model.KindChecklist
+		note.SetText(text)
+		return nil
+	})
+}
+
+// ConvertToText turns a checklist into a text note holding its title and
+// items in "- [ ]" syntax.
+func (s *NoteService) ConvertToText(id string) (*model.Note, error) {
+	return s.editNote(id, func(note *model.Note) error {
+		if !note.IsChecklist() {
+			return fmt.Errorf("note %s is not a checklist", id)
+		}
+		note.Content, note.Kind, note.Items = note.Text(), model.KindText, nil
+		return nil
+	})
+}
+
+// AddChecklistItem appends an open item to a checklist.
+func (s *NoteService) AddChecklistItem(id, text string) (*model.Note, error) {
+	item, err := model.NormalizeItem(text)
+	if err != nil {
+		return nil, err
+	}
+	return s.editItems(id, func(items []model.ChecklistItem) ([]model.ChecklistItem, error) {
+		return append(items, model.ChecklistItem{Text: item}), nil
+	})
+}
+
+// RemoveChecklistItem removes the item at index, counting from 0.
+func (s *NoteService) RemoveChecklistItem(id string, index int) (*model.Note, error) {
+	return s.editItems(id, func(items []model.ChecklistItem) ([]model.ChecklistItem, error) {
+		if err := checkItemIndex(items, index); err != nil {
+			return nil, err
+		}
+		return slices.Delete(items, index, index+1), nil
+	})
+}
+
+// MoveChecklistItem moves the item at from so that it ends up at index to,
+// shifting the items in between.
+func (s *NoteService) MoveChecklistItem(id string, from, to int) (*model.Note, error) {
+	return s.editItems(id, func(items []model.ChecklistItem) ([]model.ChecklistItem, error) {
+		if err := checkItemIndex(items, from); err != nil {
+			return nil, err
+		}
+		if err := checkItemIndex(items, to); err != nil {
+			return nil, err
+		}
+		item := items[from]
+		items = slices.Delete(items, from, from+1)
+		return slices.Insert(items, to, item), nil
+	})
+}
+
+// ToggleChecklistItem marks the item at index done, or open again if it
+// was done.
+func (s *NoteService) ToggleChecklistItem(id string, index int) (*model.Note, error) {
+	return s.editItems(id, func(items []model.ChecklistItem) ([]model.ChecklistItem, error) {
+		if err := checkItemIndex(items, index); err != nil {
+			return nil, err
+		}
+		items[index].Done = !items[index].Done
+		return items, nil
+	})
+}
+
+// editItems applies change to a copy of a checklist's items and saves the
+// result as an edit of the note.
+func (s *NoteService) editItems(id string, change func(items []model.ChecklistItem) ([]model.ChecklistItem, error)) (*model.Note, error) {
+	return s.editNote(id, func(note *model.Note) error {
+		if !note.IsChecklist() {
+			return fmt.Errorf("note %s is not a checklist", id)
+		}
+		items, err := change(slices.Clone(note.Items))
+		if err != nil {
+			return err
+		}
+		note.Items = items
+		return nil
+	})
+}
+
+// editNote applies change to a note and saves it like an update, keeping
+// the version it replaces in the history.
+func (s *NoteService) editNote(id string, change func(note *model.Note) error) (*model.Note, error) {
+	note, err := s.repo.GetById(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+	previous := note.Clone()
+	if err := change(note); err != nil {
+		return nil, err
+	}
+	if err := validateContent(note); err != nil {
+		return nil, err
+	}
+	return s.saveEdit(previous, note)
+}
+
+func checklistItems(texts []string) ([]model.ChecklistItem, error) {
+	var items []model.ChecklistItem
+	for _, text := range texts {
+		item, err := model.NormalizeItem(text)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, model.ChecklistItem{Text: item})
+	}
+	return items, nil
+}
+
+func checkItemIndex(items []model.ChecklistItem, index int) error {
+	if index < 0 || index >= len(items) {
+		return fmt.Errorf("checklist has no item %d", index+1)
+	}
+	return nil
+}
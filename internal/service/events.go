@@ -0,0 +1,152 @@
+package service
+
+import (
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// Events returns the bus the service publishes every note change to.
+// Changes made to the store by other processes are not published.
+func (s *NoteService) Events() *events.Bus {
+	return s.bus
+}
+
+func (s *NoteService) publish(kind events.Kind, before, after *model.Note) {
+	e := events.Event{Kind: kind, Before: before, After: after}
+	if after != nil {
+		e.NoteID = after.ID
+	} else if before != nil {
+		e.NoteID = before.ID
+	}
+	s.bus.Publish(e)
+}
+
+// trashedNote returns the trashed copy of a note, or nil if it cannot be
+// found.
+func (s *NoteService) trashedNote(trash repository.TrashRepository, id string) *model.Note {
+	trashed, err := trash.ListTrash()
+	if err != nil {
+		return nil
+	}
+	for _, note := range trashed {
+		if note.ID == id {
+			return note
+		}
+	}
+	return nil
+}
+
+// publishPurged publishes a Purged event for each note in before that is no
+// longer in the trash.
+func (s *NoteService) publishPurged(trash repository.TrashRepository, before []*model.Note) {
+	after, err := trash.ListTrash()
+	if err != nil {
+		return
+	}
+	remaining := make(map[string]bool, len(after))
+	for _, note := range after {
+		remaining[note.ID] = true
+	}
+	for _, note := range before {
+		if !remaining[note.ID] {
+			s.publish(events.Purged, note, nil)
+		}
+	}
+}
+
+// recordingTx passes operations through to a transaction and remembers
+// the events to publish once it commits.
+type recordingTx struct {
+	repository.Tx
+	service *NoteService
+	// state is each touched note as the transaction leaves it so far.
+	state   map[string]*model.Note
+	touched map[string]bool
+	pending []pendingEvent
+}
+
+// pendingEvent is an event waiting for its transaction to commit. Source is
+// the caller's note for an update, which the commit gives its new version.
+type pendingEvent struct {
+	event  events.Event
+	source *model.Note
+}
+
+func (s *NoteService) recordTx(tx repository.Tx) *recordingTx {
+	return &recordingTx{
+		Tx:      tx,
+		service: s,
+		state:   make(map[string]*model.Note),
+		touched: make(map[string]bool),
+	}
+}
+
+func (t *recordingTx) current(id string) *model.Note {
+	if t.touched[id] {
+		return t.state[id]
+	}
+	note, err := t.service.repo.GetById(id)
+	if err != nil {
+		return nil
+	}
+	return note
+}
+
+func (t *recordingTx) record(kind events.Kind, id string, before, after, source *model.Note) {
+	e := events.Event{Kind: kind, NoteID: id, Before: before.Clone(), After: after.Clone()}
+	t.pending = append(t.pending, pendingEvent{event: e, source: source})
+	t.state[id] = after.Clone()
+	t.touched[id] = true
+}
+
+func (t *recordingTx) Save(note *model.Note) error {
+	before := t.current(note.ID)
+	if err := t.Tx.Save(note); err != nil {
+		return err
+	}
+	kind := events.Created
+	if before != nil {
+		kind = events.Updated
+	}
+	t.record(kind, note.ID, before, note, nil)
+	return nil
+}
+
+func (t *recordingTx) Update(note *model.Note) error {
+	before := t.current(note.ID)
+	if err := t.Tx.Update(note); err != nil {
+		return err
+	}
+	t.record(events.Updated, note.ID, before, note, note)
+	return nil
+}
+
+func (t *recordingTx) Delete(id string) error {
+	before := t.current(id)
+	if err := t.Tx.Delete(id); err != nil {
+		return err
+	}
+	var after *model.Note
+	if _, err := t.service.trash(); err == nil && before != nil {
+		after = before.Clone()
+		now := time.Now()
+		after.DeletedAt = &now
+	}
+	t.record(events.Deleted, id, before, after, nil)
+	t.state[id] = nil
+	return nil
+}
+
+// publish publishes the recorded events once the transaction has
+// committed, with updated notes at the version the commit stored.
+func (t *recordingTx) publish() {
+	for _, p := range t.pending {
+		if p.source != nil {
+			p.event.After.Version = p.source.Version
+		}
+		t.service.bus.Publish(p.event)
+	}
+}
@@ -2,32 +2,74 @@ package service
 
 import (
 	"fmt"
+	"iter"
+	"sync"
 	"time"
 
+	"github.com/bllexe/sticky-notes/internal/events"
 	"github.com/bllexe/sticky-notes/internal/model"
 	"github.com/bllexe/sticky-notes/internal/repository"
+	"github.com/bllexe/sticky-notes/internal/search"
 	"github.com/google/uuid"
 )
 
 type NoteService struct {
-	repo repository.NoteRepository
+	repo           repository.NoteRepository
+	trashRetention time.Duration
+	bus            *events.Bus
+
+	// index is built from the repository on the first search and kept in
+	// sync by the write methods afterwards.
+	indexMutex sync.Mutex
+	index      *search.Index
+
+	// palette is used for stores that cannot keep one themselves.
+	paletteMutex sync.Mutex
+	palette      *model.Palette
 }
 
 func NewNoteService(repo repository.NoteRepository) *NoteService {
 	return &NoteService{
-		repo: repo,
+		repo:           repo,
+		trashRetention: DefaultTrashRetention,
+		bus:            events.NewBus(events.DefaultRetention),
 	}
 }
 
-func (s *NoteService) CreateNote(content string, color model.Color) (*model.Note, error) {
-	note := &model.Note{
+// CreateNote saves a new note. An empty color means the palette's default.
+func (s *NoteService) CreateNote(content string, color model.Color, tags ...string) (*model.Note, error) {
+	note, err := s.newNote(content, color, tags)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveNew(note)
+}
+
+// newNote prepares a text note for saving.
+func (s *NoteService) newNote(content string, color model.Color, tags []string) (*model.Note, error) {
+	normalized, err := model.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if color == "" {
+		palette, err := s.Palette()
+		if err != nil {
+			return nil, err
+		}
+		color = palette.Default
+	}
+	return &model.Note{
 		ID:        uuid.New().String(),
 		Content:   content,
 		Color:     color,
+		Version:   1,
+		Tags:      normalized,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	}
+	}, nil
+}
 
+func (s *NoteService) saveNew(note *model.Note) (*model.Note, error) {
 	if err := s.validateNote(note); err != nil {
 		return nil, err
 	}
@@ -35,33 +77,95 @@ func (s *NoteService) CreateNote(content string, color model.Color) (*model.Note
 	if err := s.repo.Save(note); err != nil {
 		return nil, fmt.Errorf("failed to save note: %w", err)
 	}
+	s.indexNote(note)
+	s.publish(events.Created, nil, note)
 
 	return note, nil
 }
 
+// UpdateNote changes a note's content and color, starting from the version
+// stored now rather than one the caller read earlier. It still fails with a
+// *repository.ConflictError if the note changes between being read and
+// written. The content of a checklist is its plain text as
+// model.Note.Text returns it, title and items together.
 func (s *NoteService) UpdateNote(id string, content string, color model.Color) (*model.Note, error) {
 	note, err := s.repo.GetById(id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get note: %w", err)
 	}
+	return s.updateNote(note, content, color)
+}
 
-	note.Content = content
-	note.Color = color
-	note.UpdatedAt = time.Now()
+// UpdateNoteAt changes a note's content and color only if the note is
+// still at version, the one the caller read before editing. Otherwise it
+// fails with a *repository.ConflictError holding the current note, so the
+// caller can merge the edit into it, overwrite it or give up.
+func (s *NoteService) UpdateNoteAt(id string, version int64, content string, color model.Color) (*model.Note, error) {
+	note, err := s.repo.GetById(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+	if note.Version != version {
+		return nil, fmt.Errorf("failed to update note: %w", &repository.ConflictError{NoteID: id, Version: version, Current: note})
+	}
+	return s.updateNote(note, content, color)
+}
 
-	if err := s.validateNote(note); err != nil {
+func (s *NoteService) updateNote(note *model.Note, content string, color model.Color) (*model.Note, error) {
+	previous := note.Clone()
+	note.SetText(content)
+	note.Color = color
+	if err := validateContent(note); err != nil {
 		return nil, err
 	}
+	if err := s.checkColor(note.Color, previous.Color); err != nil {
+		return nil, err
+	}
+	return s.saveEdit(previous, note)
+}
 
+// saveEdit stores an edited note, then keeps previous in its history if
+// the text or color changed, so an edit that is not stored leaves no
+// revision behind.
+func (s *NoteService) saveEdit(previous, note *model.Note) (*model.Note, error) {
+	note.UpdatedAt = time.Now()
 	if err := s.repo.Update(note); err != nil {
 		return nil, fmt.Errorf("failed to update note: %w", err)
 	}
+	s.indexNote(note)
+	s.publish(events.Updated, previous, note)
 
+	if previous.Text() != note.Text() || previous.Color != note.Color {
+		if err := s.saveRevision(previous); err != nil {
+			return note, fmt.Errorf("note was updated but its history was not saved: %w", err)
+		}
+	}
 	return note, nil
 }
 
-func (s *NoteService) DeleteNote(id string) error {
-	return s.repo.Delete(id)
+// DeleteNote moves a note to the trash, or removes it for good if the
+// storage backend has no trash. It reports whether the note went to the
+// trash.
+func (s *NoteService) DeleteNote(id string) (bool, error) {
+	note, err := s.repo.GetById(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to get note: %w", err)
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return false, err
+	}
+
+	if _, err := s.trash(); err == nil {
+		trashed := note.Clone()
+		now := time.Now()
+		trashed.DeletedAt = &now
+		s.indexNote(trashed)
+		s.publish(events.Deleted, note, trashed)
+		return true, nil
+	}
+	s.unindexNote(id)
+	s.publish(events.Deleted, note, nil)
+	return false, nil
 }
 
 func (s *NoteService) GetNote(id string) (*model.Note, error) {
@@ -72,19 +176,156 @@ func (s *NoteService) GetAllNotes() ([]*model.Note, error) {
 	return s.repo.GetAll()
 }
 
-func (s *NoteService) SearchNotes(query string) ([]*model.Note, error) {
-	return s.repo.Search(query)
+// AllNotes streams every live note. Unlike GetAllNotes it does not load
+// the whole store at once, and the caller may stop early.
+func (s *NoteService) AllNotes() iter.Seq2[*model.Note, error] {
+	return s.repo.All()
+}
+
+// ScanNotes streams the notes containing query, ignoring case. It reads the
+// store directly rather than the search index, so results are not ranked.
+func (s *NoteService) ScanNotes(query string) iter.Seq2[*model.Note, error] {
+	return s.repo.SearchSeq(query)
+}
+
+// FindNotes returns the page of notes selected by q.
+func (s *NoteService) FindNotes(q repository.Query) (*repository.Page, error) {
+	return s.repo.Find(q)
+}
+
+// StoreWarnings describes stored notes the last listing had to skip
+// because they could not be read.
+func (s *NoteService) StoreWarnings() []string {
+	if reporter, ok := s.repo.(repository.HealthReporter); ok {
+		return reporter.Warnings()
+	}
+	return nil
+}
+
+// SearchNotes returns the notes matching query ranked by relevance. Words
+// match whole terms, "word*" matches a prefix and "quoted text" matches a
+// phrase; every part of the query must match.
+func (s *NoteService) SearchNotes(query string) ([]search.Result, error) {
+	return s.searchNotes(query, false)
+}
+
+// SearchNotesMatching ranks the notes matching q.Text like SearchNotes and
+// keeps those that pass q's other filters, at most q.Limit of them. The
+// results stay in order of relevance; q's sort order and cursor are not
+// used.
+func (s *NoteService) SearchNotesMatching(q repository.Query) ([]search.Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	results, err := s.searchNotes(q.Text, false)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := results[:0]
+	for _, result := range results {
+		if q.MatchFilters(result.Note) {
+			matching = append(matching, result)
+		}
+	}
+	if q.Limit > 0 && len(matching) > q.Limit {
+		matching = matching[:q.Limit]
+	}
+	return matching, nil
+}
+
+func (s *NoteService) searchNotes(query string, includeTrashed bool) ([]search.Result, error) {
+	index, err := s.searchIndex()
+	if err != nil {
+		return nil, err
+	}
+	results, err := index.Search(query)
+	if err != nil || includeTrashed {
+		return results, err
+	}
+
+	live := results[:0]
+	for _, result := range results {
+		if result.Note.DeletedAt == nil {
+			live = append(live, result)
+		}
+	}
+	return live, nil
+}
+
+func (s *NoteService) searchIndex() (*search.Index, error) {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+
+	if s.index != nil {
+		return s.index, nil
+	}
+	// Trashed notes are indexed too so they can be searched on request.
+	notes, err := s.GetAllNotesIncludingTrash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build search index: %w", err)
+	}
+	index := search.NewIndex()
+	for _, note := range notes {
+		index.Add(note)
+	}
+	s.index = index
+	return index, nil
 }
 
+func (s *NoteService) indexNote(note *model.Note) {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+
+	if s.index != nil {
+		s.index.Add(note)
+	}
+}
+
+// resetIndex drops the index so the next search rebuilds it.
+func (s *NoteService) resetIndex() {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+
+	s.index = nil
+}
+
+func (s *NoteService) unindexNote(id string) {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+
+	if s.index != nil {
+		s.index.Remove(id)
+	}
+}
+
+// validateNote checks a new note. Its color has to be in the palette.
 func (s *NoteService) validateNote(note *model.Note) error {
-	if note.Content == "" {
-		return fmt.Errorf("note content cannot be empty")
+	if err := validateContent(note); err != nil {
+		return err
 	}
+	return s.checkColor(note.Color, "")
+}
 
-	switch note.Color {
-	case model.Yellow, model.Blue, model.Green, model.Pink, model.Orange:
-		return nil
+// validateContent requires a note to have content, or for a checklist a
+// title or items, and checklist items to be single lines.
+func validateContent(note *model.Note) error {
+	switch note.Kind {
+	case model.KindText:
+		if len(note.Items) > 0 {
+			return fmt.Errorf("only checklists have items")
+		}
+	case model.KindChecklist:
+		for _, item := range note.Items {
+			if _, err := model.NormalizeItem(item.Text); err != nil {
+				return err
+			}
+		}
 	default:
-		return fmt.Errorf("invalid note color: %s", note.Color)
+		return fmt.Errorf("unknown note kind %q", note.Kind)
+	}
+	if note.Content == "" && len(note.Items) == 0 {
+		return fmt.Errorf("note content cannot be empty")
 	}
+	return nil
 }
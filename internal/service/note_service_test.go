@@ -1,21 +1,31 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/bllexe/sticky-notes/internal/diff"
+	"github.com/bllexe/sticky-notes/internal/events"
 	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
 )
 
 // MockRepository is a mock implementation of repository.NoteRepository
 type MockRepository struct {
-	notes map[string]*model.Note
+	notes     map[string]*model.Note
+	revisions map[string][]*model.Revision
 }
 
 func NewMockRepository() *MockRepository {
 	return &MockRepository{
-		notes: make(map[string]*model.Note),
+		notes:     make(map[string]*model.Note),
+		revisions: make(map[string][]*model.Revision),
 	}
 }
 
@@ -29,6 +39,7 @@ func (r *MockRepository) Update(note *model.Note) error {
 		return fmt.Errorf("note not found")
 	}
 	r.notes[note.ID] = note
+	note.Version++
 	return nil
 }
 
@@ -57,6 +68,103 @@ func (r *MockRepository) Search(query string) ([]*model.Note, error) {
 	return []*model.Note{}, nil // Simplified for testing
 }
 
+func (r *MockRepository) All() iter.Seq2[*model.Note, error] {
+	return func(yield func(*model.Note, error) bool) {
+		for _, note := range r.notes {
+			if !yield(note, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (r *MockRepository) SearchSeq(query string) iter.Seq2[*model.Note, error] {
+	return func(yield func(*model.Note, error) bool) {}
+}
+
+func (r *MockRepository) Find(q repository.Query) (*repository.Page, error) {
+	notes, _ := r.GetAll()
+	return q.Apply(notes)
+}
+
+func (r *MockRepository) SaveRevision(rev *model.Revision) error {
+	rev.Number = len(r.revisions[rev.NoteID]) + 1
+	saved := *rev
+	r.revisions[rev.NoteID] = append(r.revisions[rev.NoteID], &saved)
+	return nil
+}
+
+func (r *MockRepository) GetRevisions(noteID string) ([]*model.Revision, error) {
+	return append([]*model.Revision(nil), r.revisions[noteID]...), nil
+}
+
+// MockTrashRepository is a MockRepository whose Delete moves notes to a trash.
+type MockTrashRepository struct {
+	*MockRepository
+	trash map[string]*model.Note
+}
+
+func NewMockTrashRepository() *MockTrashRepository {
+	return &MockTrashRepository{
+		MockRepository: NewMockRepository(),
+		trash:          make(map[string]*model.Note),
+	}
+}
+
+func (r *MockTrashRepository) Delete(id string) error {
+	note, exists := r.notes[id]
+	if !exists {
+		return fmt.Errorf("note not found")
+	}
+	trashed := *note
+	now := time.Now()
+	trashed.DeletedAt = &now
+	r.trash[id] = &trashed
+	delete(r.notes, id)
+	return nil
+}
+
+func (r *MockTrashRepository) ListTrash() ([]*model.Note, error) {
+	var notes []*model.Note
+	for _, note := range r.trash {
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+func (r *MockTrashRepository) Restore(id string) (*model.Note, error) {
+	note, exists := r.trash[id]
+	if !exists {
+		return nil, fmt.Errorf("note not found")
+	}
+	note.DeletedAt = nil
+	r.notes[id] = note
+	delete(r.trash, id)
+	return note, nil
+}
+
+func (r *MockTrashRepository) Purge(id string) error {
+	delete(r.trash, id)
+	return nil
+}
+
+func (r *MockTrashRepository) PurgeBefore(cutoff time.Time) (int, error) {
+	purged := 0
+	for id, note := range r.trash {
+		if note.DeletedAt.Before(cutoff) {
+			delete(r.trash, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *MockTrashRepository) EmptyTrash() (int, error) {
+	n := len(r.trash)
+	r.trash = make(map[string]*model.Note)
+	return n, nil
+}
+
 func TestCreateNote(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewNoteService(repo)
@@ -204,6 +312,47 @@ func TestUpdateNote(t *testing.T) {
 	}
 }
 
+func TestUpdateNoteAt(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+
+	note, err := service.CreateNote("shared", model.Yellow)
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	if note.Version != 1 {
+		t.Errorf("Version mismatch, got: %d, want: 1", note.Version)
+	}
+
+	// Two editors start from the same version; the second one is stale.
+	first, err := service.UpdateNoteAt(note.ID, note.Version, "first edit", model.Blue)
+	if err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Version mismatch, got: %d, want: 2", first.Version)
+	}
+	_, err = service.UpdateNoteAt(note.ID, note.Version, "second edit", model.Green)
+	var conflict *repository.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Expected a conflict, got: %v", err)
+	}
+	if conflict.Version != 1 || conflict.Current.Version != 2 || conflict.Current.Content != "first edit" {
+		t.Errorf("Unexpected conflict: %+v (current %+v)", conflict, conflict.Current)
+	}
+	if current, _ := service.GetNote(note.ID); current.Content != "first edit" {
+		t.Errorf("Expected the stale edit to be rejected, got: %s", current.Content)
+	}
+
+	// Retrying at the current version, as overwriting does, succeeds.
+	second, err := service.UpdateNoteAt(note.ID, conflict.Current.Version, "second edit", model.Green)
+	if err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	if second.Version != 3 {
+		t.Errorf("Version mismatch, got: %d, want: 3", second.Version)
+	}
+}
+
 func TestDeleteNote(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewNoteService(repo)
@@ -216,10 +365,13 @@ func TestDeleteNote(t *testing.T) {
 	}
 	repo.Save(note)
 
-	err := service.DeleteNote(note.ID)
+	trashed, err := service.DeleteNote(note.ID)
 	if err != nil {
 		t.Errorf("Failed to delete note: %v", err)
 	}
+	if trashed {
+		t.Error("Expected a store without a trash to delete the note permanently")
+	}
 
 	// Verify note is deleted
 	retrieved, _ := repo.GetById(note.ID)
@@ -279,3 +431,824 @@ func TestValidateNote(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchNotes(t *testing.T) {
+	repo := NewMockRepository()
+	repo.Save(&model.Note{ID: "existing", Content: "apple pie", Color: model.Yellow})
+	service := NewNoteService(repo)
+
+	// The index is built from the repository on first use.
+	results, err := service.SearchNotes("apple")
+	if err != nil {
+		t.Fatalf("Failed to search notes: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Search results count mismatch, got: %d, want: 1", len(results))
+	}
+
+	// Writes through the service keep the index in sync.
+	created, err := service.CreateNote("apple apple crumble", model.Green)
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	results, _ = service.SearchNotes("apple")
+	if len(results) != 2 || results[0].Note.ID != created.ID {
+		t.Errorf("Expected created note to rank first, got: %+v", results)
+	}
+
+	if _, err := service.UpdateNote(created.ID, "pear crumble", model.Green); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	results, _ = service.SearchNotes("crum*")
+	if len(results) != 1 || results[0].Note.Content != "pear crumble" {
+		t.Errorf("Expected updated note to be found by prefix, got: %+v", results)
+	}
+
+	if _, err := service.DeleteNote(created.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	results, _ = service.SearchNotes("crumble")
+	if len(results) != 0 {
+		t.Errorf("Expected deleted note to be unindexed, got: %d results", len(results))
+	}
+}
+
+func TestSearchNotesMatching(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewNoteService(repo)
+	for _, color := range []model.Color{model.Yellow, model.Blue, model.Blue} {
+		if _, err := service.CreateNote("apple "+string(color), color); err != nil {
+			t.Fatalf("Failed to create note: %v", err)
+		}
+	}
+
+	results, err := service.SearchNotesMatching(repository.Query{Text: "apple", Colors: []model.Color{model.Blue}})
+	if err != nil {
+		t.Fatalf("Failed to search notes: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Search results count mismatch, got: %d, want: 2", len(results))
+	}
+
+	results, _ = service.SearchNotesMatching(repository.Query{Text: "apple", Limit: 1})
+	if len(results) != 1 {
+		t.Errorf("Expected limit to cap results, got: %d", len(results))
+	}
+
+	page, err := service.FindNotes(repository.Query{Colors: []model.Color{model.Yellow}})
+	if err != nil {
+		t.Fatalf("Failed to find notes: %v", err)
+	}
+	if len(page.Notes) != 1 || page.Notes[0].Color != model.Yellow {
+		t.Errorf("Unexpected notes: %+v", page.Notes)
+	}
+}
+
+func TestSearchByDueDate(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+	note, err := service.CreateNote("pay rent", model.Yellow)
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	// Searching first builds the index, which the due date must then
+	// reach.
+	if results, _ := service.SearchNotes("rent"); len(results) != 1 {
+		t.Fatalf("Expected one result, got: %d", len(results))
+	}
+
+	due := time.Date(2024, 4, 30, 12, 0, 0, 0, time.Local)
+	if _, err := service.SetDueDate(note.ID, &due); err != nil {
+		t.Fatalf("Failed to set due date: %v", err)
+	}
+	q, err := repository.ParseQuery("rent due:2024-04-01..2024-04-30")
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	results, err := service.SearchNotesMatching(q)
+	if err != nil {
+		t.Fatalf("Failed to search notes: %v", err)
+	}
+	if len(results) != 1 || results[0].Note.DueAt == nil {
+		t.Errorf("Expected the note due in April, got: %+v", results)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewNoteService(repo)
+
+	note, err := service.CreateNote("first\nsecond", model.Yellow)
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	if _, err := service.UpdateNote(note.ID, "first\nchanged", model.Blue); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	// An update that changes nothing does not add a revision.
+	if _, err := service.UpdateNote(note.ID, "first\nchanged", model.Blue); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+
+	revisions, err := service.ListRevisions(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to list revisions: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("Revision count mismatch, got: %d, want: 2", len(revisions))
+	}
+	if revisions[0].Content != "first\nsecond" || revisions[1].Content != "first\nchanged" {
+		t.Errorf("Unexpected revisions: %+v, %+v", revisions[0], revisions[1])
+	}
+
+	d, err := service.DiffRevisions(note.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("Failed to diff revisions: %v", err)
+	}
+	if got := diff.Format(d.Lines); got != "  first\n- second\n+ changed\n" {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+	if d.ColorFrom != model.Yellow || d.ColorTo != model.Blue {
+		t.Errorf("Unexpected color change: %s -> %s", d.ColorFrom, d.ColorTo)
+	}
+
+	restored, err := service.RestoreRevision(note.ID, 1)
+	if err != nil {
+		t.Fatalf("Failed to restore revision: %v", err)
+	}
+	if restored.Content != "first\nsecond" || restored.Color != model.Yellow {
+		t.Errorf("Restored note mismatch: %+v", restored)
+	}
+	revisions, _ = service.ListRevisions(note.ID)
+	if len(revisions) != 3 {
+		t.Errorf("Expected restore to add a revision, got: %d", len(revisions))
+	}
+
+	if _, err := service.DiffRevisions(note.ID, 1, 9); err == nil {
+		t.Error("Expected error for unknown revision, got nil")
+	}
+}
+
+// racingRepository changes a note just before the service's first update
+// of it, as another instance editing it at the same time would.
+type racingRepository struct {
+	*repository.MemoryRepository
+	raced bool
+}
+
+func (r *racingRepository) Update(note *model.Note) error {
+	if !r.raced {
+		r.raced = true
+		current, _ := r.MemoryRepository.GetById(note.ID)
+		current.Content = "concurrent edit"
+		if err := r.MemoryRepository.Update(current); err != nil {
+			return err
+		}
+	}
+	return r.MemoryRepository.Update(note)
+}
+
+func TestConflictingEditKeepsNoRevision(t *testing.T) {
+	repo := &racingRepository{MemoryRepository: repository.NewMemoryRepository()}
+	service := NewNoteService(repo)
+
+	note, err := service.CreateNote("original", model.Yellow)
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	_, err = service.UpdateNote(note.ID, "lost edit", model.Blue)
+	var conflict *repository.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Expected a conflict, got: %v", err)
+	}
+	if revisions, _ := repo.GetRevisions(note.ID); len(revisions) != 0 {
+		t.Errorf("Expected no revision for the rejected edit, got: %+v", revisions)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	repo := NewMockTrashRepository()
+	service := NewNoteService(repo)
+
+	note, err := service.CreateNote("grocery list", model.Yellow)
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	if trashed, err := service.DeleteNote(note.ID); err != nil || !trashed {
+		t.Fatalf("Failed to move note to the trash: %v", err)
+	}
+
+	if results, _ := service.SearchNotes("grocery"); len(results) != 0 {
+		t.Errorf("Expected trashed note to be left out of search, got: %d", len(results))
+	}
+	results, err := service.SearchNotesIncludingTrash("grocery")
+	if err != nil || len(results) != 1 {
+		t.Errorf("Expected trashed note when including trash, got: %d (%v)", len(results), err)
+	}
+	if all, _ := service.GetAllNotesIncludingTrash(); len(all) != 1 {
+		t.Errorf("Expected trashed note when including trash, got: %d", len(all))
+	}
+
+	if _, err := service.RestoreNote(note.ID); err != nil {
+		t.Fatalf("Failed to restore note: %v", err)
+	}
+	if results, _ := service.SearchNotes("grocery"); len(results) != 1 {
+		t.Errorf("Expected restored note to be searchable, got: %d", len(results))
+	}
+
+	service.DeleteNote(note.ID)
+	service.SetTrashRetention(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if n, err := service.PurgeExpiredTrash(); err != nil || n != 1 {
+		t.Errorf("Expected expired note to be purged, got: %d (%v)", n, err)
+	}
+
+	// Backends without a trash report it instead of pretending.
+	plain := NewNoteService(NewMockRepository())
+	if _, err := plain.ListTrash(); !errors.Is(err, ErrTrashUnsupported) {
+		t.Errorf("Expected ErrTrashUnsupported, got: %v", err)
+	}
+}
+
+func TestBulkOperations(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+
+	var ids []string
+	for _, content := range []string{"first", "second", "third"} {
+		note, err := service.CreateNote(content, model.Yellow)
+		if err != nil {
+			t.Fatalf("Failed to create note: %v", err)
+		}
+		ids = append(ids, note.ID)
+	}
+
+	if _, err := service.RecolorNotes(append(ids[:1:1], "missing"), model.Blue); err == nil {
+		t.Fatal("Expected recoloring a missing note to fail")
+	}
+	if note, _ := service.GetNote(ids[0]); note.Color != model.Yellow {
+		t.Errorf("Color mismatch after failed recolor, got: %s, want: %s", note.Color, model.Yellow)
+	}
+
+	updated, err := service.RecolorNotes(ids[:2], model.Blue)
+	if err != nil {
+		t.Fatalf("Failed to recolor notes: %v", err)
+	}
+	if len(updated) != 2 {
+		t.Errorf("Recolored notes count mismatch, got: %d, want: 2", len(updated))
+	}
+	if revisions, _ := service.ListRevisions(ids[0]); len(revisions) != 2 {
+		t.Errorf("Expected the old color in the history, got: %d revisions", len(revisions))
+	}
+	if results, _ := service.SearchNotesMatching(repository.Query{Text: "second", Colors: []model.Color{model.Blue}}); len(results) != 1 {
+		t.Errorf("Expected the index to see the new colors, got: %d", len(results))
+	}
+
+	if trashed, err := service.DeleteNotes(ids[1:]); err != nil || !trashed {
+		t.Fatalf("Failed to move notes to the trash: %v", err)
+	}
+	if all, _ := service.GetAllNotes(); len(all) != 1 {
+		t.Errorf("Notes count mismatch after delete, got: %d, want: 1", len(all))
+	}
+	if trashed, _ := service.ListTrash(); len(trashed) != 2 {
+		t.Errorf("Trashed notes count mismatch, got: %d, want: 2", len(trashed))
+	}
+
+	plain := NewNoteService(NewMockRepository())
+	if _, err := plain.DeleteNotes(ids); !errors.Is(err, ErrTransactionsUnsupported) {
+		t.Errorf("Expected ErrTransactionsUnsupported, got: %v", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+
+	if _, err := service.CreateNote("bad", model.Yellow, "two words"); err == nil {
+		t.Error("Expected an invalid tag to be refused")
+	}
+	var ids []string
+	for _, tags := range [][]string{{"Bug", "ui"}, {"bug"}, nil} {
+		note, err := service.CreateNote("note", model.Yellow, tags...)
+		if err != nil {
+			t.Fatalf("Failed to create note: %v", err)
+		}
+		ids = append(ids, note.ID)
+	}
+
+	updated, err := service.TagNotes(ids, "done")
+	if err != nil {
+		t.Fatalf("Failed to tag notes: %v", err)
+	}
+	if len(updated) != 3 || updated[0].Version != 2 {
+		t.Errorf("Unexpected tagged notes: %+v", updated)
+	}
+	if updated, _ := service.UntagNotes(ids[1:], "done", "ui"); len(updated) != 2 {
+		t.Errorf("Untagged notes count mismatch, got: %d, want: 2", len(updated))
+	}
+	if renamed, err := service.RenameTag("bug", "ui"); err != nil || renamed != 2 {
+		t.Errorf("Renamed notes count mismatch, got: %d (%v), want: 2", renamed, err)
+	}
+	if deleted, err := service.DeleteTag("done"); err != nil || deleted != 1 {
+		t.Errorf("Deleted notes count mismatch, got: %d (%v), want: 1", deleted, err)
+	}
+
+	tags, err := service.ListTags()
+	if err != nil {
+		t.Fatalf("Failed to list tags: %v", err)
+	}
+	if len(tags) != 1 || tags[0] != (repository.TagCount{Tag: "ui", Count: 2}) {
+		t.Errorf("Unexpected tags: %+v", tags)
+	}
+	query, _ := repository.ParseQuery("tags:\"ui AND NOT bug\"")
+	if page, _ := service.FindNotes(query); len(page.Notes) != 2 {
+		t.Errorf("Expected two notes tagged ui, got: %d", len(page.Notes))
+	}
+
+	// Stores without transactions can still tag one note at a time.
+	plain := NewNoteService(NewMockRepository())
+	note, _ := plain.CreateNote("note", model.Yellow)
+	if _, err := plain.TagNotes([]string{note.ID}, "solo"); err != nil {
+		t.Fatalf("Failed to tag note: %v", err)
+	}
+	if tags, _ := plain.ListTags(); len(tags) != 1 || tags[0].Tag != "solo" {
+		t.Errorf("Unexpected tags: %+v", tags)
+	}
+	other, _ := plain.CreateNote("other", model.Yellow)
+	if _, err := plain.TagNotes([]string{note.ID, other.ID}, "pair"); !errors.Is(err, ErrTransactionsUnsupported) {
+		t.Errorf("Expected ErrTransactionsUnsupported, got: %v", err)
+	}
+}
+
+func TestPalette(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+
+	if _, err := service.CreateNote("red", "red"); err == nil {
+		t.Error("Expected a color outside the palette to be refused")
+	}
+	if _, err := service.SetPaletteColor(model.PaletteColor{Name: "red", Hex: "#e53935", Meaning: "blocker"}); err != nil {
+		t.Fatalf("Failed to add color: %v", err)
+	}
+	blocker, err := service.CreateNote("blocker", "red")
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	if _, err := service.SetDefaultColor(model.Blue); err != nil {
+		t.Fatalf("Failed to set the default color: %v", err)
+	}
+	if note, _ := service.CreateNote("plain", ""); note == nil || note.Color != model.Blue {
+		t.Errorf("Expected the default color, got: %+v", note)
+	}
+
+	if _, err := service.RemovePaletteColor(model.Blue, ""); err == nil {
+		t.Error("Expected removing the default color to fail")
+	}
+	_, err = service.RemovePaletteColor("red", "")
+	var inUse *ColorInUseError
+	if !errors.As(err, &inUse) || inUse.Notes != 1 {
+		t.Fatalf("Expected a color in use error, got: %v", err)
+	}
+	if _, err := service.RemovePaletteColor("red", "red"); err == nil {
+		t.Error("Expected remapping to the removed color to fail")
+	}
+	remapped, err := service.RemovePaletteColor("red", model.Pink)
+	if err != nil || remapped != 1 {
+		t.Fatalf("Remapped count mismatch, got: %d (%v), want: 1", remapped, err)
+	}
+	if note, _ := service.GetNote(blocker.ID); note.Color != model.Pink {
+		t.Errorf("Color mismatch, got: %s, want: %s", note.Color, model.Pink)
+	}
+	if palette, _ := service.Palette(); palette.Has("red") || palette.Default != model.Blue {
+		t.Errorf("Unexpected palette: %+v", palette)
+	}
+
+	// Notes keep a color that left the palette, but cannot be given one.
+	service.SetPaletteColor(model.PaletteColor{Name: "teal", Hex: "#008080"})
+	teal, _ := service.CreateNote("teal", "teal")
+	service.RemovePaletteColor("teal", model.Green)
+	if note, _ := service.GetNote(teal.ID); note.Color != model.Green {
+		t.Fatalf("Color mismatch, got: %s, want: %s", note.Color, model.Green)
+	}
+	legacy, _ := service.CreateNote("legacy", model.Yellow)
+	stored, _ := service.GetNote(legacy.ID)
+	stored.Color = "teal"
+	service.repo.Update(stored)
+	if _, err := service.UpdateNote(legacy.ID, "legacy, edited", "teal"); err != nil {
+		t.Errorf("Expected a note to keep its color, got: %v", err)
+	}
+	if _, err := service.UpdateNote(blocker.ID, "blocker", "teal"); err == nil {
+		t.Error("Expected a removed color to be refused")
+	}
+
+	// Stores without a palette of their own keep it in the service.
+	plain := NewNoteService(NewMockRepository())
+	if _, err := plain.SetPaletteColor(model.PaletteColor{Name: "red", Hex: "#f00"}); err != nil {
+		t.Fatalf("Failed to add color: %v", err)
+	}
+	if _, err := plain.CreateNote("red", "red"); err != nil {
+		t.Errorf("Failed to create note: %v", err)
+	}
+}
+
+func TestBoard(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+
+	var notes []*model.Note
+	var ids []string
+	for _, color := range []model.Color{model.Blue, model.Yellow, model.Blue, model.Pink} {
+		note, err := service.CreateNote("note", color)
+		if err != nil {
+			t.Fatalf("Failed to create note: %v", err)
+		}
+		notes = append(notes, note)
+		ids = append(ids, note.ID)
+	}
+
+	moved, err := service.MoveNote(ids[0], 100, 50)
+	if err != nil {
+		t.Fatalf("Failed to move note: %v", err)
+	}
+	if want := (model.Geometry{Board: model.DefaultBoard, X: 100, Y: 50, Width: model.DefaultNoteWidth, Height: model.DefaultNoteHeight}); *moved.Geometry != want {
+		t.Errorf("Geometry mismatch, got: %+v, want: %+v", moved.Geometry, want)
+	}
+	if !moved.UpdatedAt.Equal(notes[0].UpdatedAt) || moved.Version != 2 {
+		t.Errorf("Expected a move to keep the update time and bump the version, got: %+v", moved)
+	}
+	if _, err := service.ResizeNote(ids[0], 10, 300); err == nil {
+		t.Error("Expected a size below the minimum to be refused")
+	}
+	if _, err := service.ResizeNote(ids[1], 300, 300); err != nil {
+		t.Fatalf("Failed to resize note: %v", err)
+	}
+	if _, err := service.MoveNote(ids[2], 5000, 5000); err != nil {
+		t.Fatalf("Failed to move note: %v", err)
+	}
+
+	overlaps, err := service.Overlaps("")
+	if err != nil {
+		t.Fatalf("Failed to find overlaps: %v", err)
+	}
+	if len(overlaps) != 1 || overlaps[0].Area != (model.Rect{X: 100, Y: 50, Width: 200, Height: 200}) {
+		t.Fatalf("Unexpected overlaps: %+v", overlaps)
+	}
+	front, err := service.BringToFront(overlaps[0].Below.ID)
+	if err != nil {
+		t.Fatalf("Failed to bring note to front: %v", err)
+	}
+	if overlaps, _ := service.Overlaps(model.DefaultBoard); len(overlaps) != 1 || overlaps[0].Above.ID != front.ID {
+		t.Errorf("Expected %s on top, got: %+v", front.ID, overlaps)
+	}
+
+	if _, err := service.MoveNoteToBoard(ids[3], "Work"); err != nil {
+		t.Fatalf("Failed to move note to board: %v", err)
+	}
+	boards, err := service.Boards()
+	if err != nil {
+		t.Fatalf("Failed to list boards: %v", err)
+	}
+	if len(boards) != 2 || boards[0] != (BoardSummary{Name: "main", Notes: 3}) || boards[1] != (BoardSummary{Name: "work", Notes: 1}) {
+		t.Errorf("Unexpected boards: %+v", boards)
+	}
+	if page, _ := service.FindNotes(repository.Query{Board: "work"}); len(page.Notes) != 1 || page.Notes[0].ID != ids[3] {
+		t.Errorf("Expected only the moved note on the work board, got: %+v", page.Notes)
+	}
+
+	tests := []struct {
+		how  Arrangement
+		want []model.Rect
+	}{
+		{how: ArrangeGrid, want: []model.Rect{
+			{X: 20, Y: 20, Width: 200, Height: 200},
+			{X: 340, Y: 20, Width: 300, Height: 300},
+			{X: 20, Y: 340, Width: 200, Height: 200},
+		}},
+		{how: ArrangeCascade, want: []model.Rect{
+			{X: 20, Y: 20, Width: 200, Height: 200},
+			{X: 50, Y: 50, Width: 300, Height: 300},
+			{X: 80, Y: 80, Width: 200, Height: 200},
+		}},
+		{how: ArrangeByColor, want: []model.Rect{
+			{X: 20, Y: 340, Width: 200, Height: 200},
+			{X: 20, Y: 20, Width: 300, Height: 300},
+			{X: 240, Y: 340, Width: 200, Height: 200},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.how), func(t *testing.T) {
+			if _, err := service.ArrangeBoard(model.DefaultBoard, tt.how); err != nil {
+				t.Fatalf("Failed to arrange board: %v", err)
+			}
+			for i, want := range tt.want {
+				note, _ := service.GetNote(ids[i])
+				if got := note.Geometry.Rect(); got != want {
+					t.Errorf("Note %d mismatch, got: %+v, want: %+v", i, got, want)
+				}
+			}
+			if overlaps, _ := service.Overlaps(model.DefaultBoard); tt.how != ArrangeCascade && len(overlaps) != 0 {
+				t.Errorf("Expected no overlaps, got: %+v", overlaps)
+			}
+		})
+	}
+	if _, err := service.ArrangeBoard("", "spiral"); err == nil {
+		t.Error("Expected an unknown arrangement to be refused")
+	}
+}
+
+func TestChecklists(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+
+	if _, err := service.CreateChecklist("", "", nil); err == nil {
+		t.Error("Expected an empty checklist to be refused")
+	}
+	if _, err := service.CreateChecklist("Bad", "", []string{"two\nlines"}); err == nil {
+		t.Error("Expected a multi-line item to be refused")
+	}
+	list, err := service.CreateChecklist("Groceries", "", []string{" milk ", "eggs", "bread"})
+	if err != nil {
+		t.Fatalf("Failed to create checklist: %v", err)
+	}
+	id := list.ID
+
+	steps := []struct {
+		name string
+		edit func() (*model.Note, error)
+		want string
+	}{
+		{name: "toggle", edit: func() (*model.Note, error) { return service.ToggleChecklistItem(id, 1) }, want: "Groceries\n- [ ] milk\n- [x] eggs\n- [ ] bread"},
+		{name: "add", edit: func() (*model.Note, error) { return service.AddChecklistItem(id, "butter") }, want: "Groceries\n- [ ] milk\n- [x] eggs\n- [ ] bread\n- [ ] butter"},
+		{name: "move down", edit: func() (*model.Note, error) { return service.MoveChecklistItem(id, 0, 2) }, want: "Groceries\n- [x] eggs\n- [ ] bread\n- [ ] milk\n- [ ] butter"},
+		{name: "move up", edit: func() (*model.Note, error) { return service.MoveChecklistItem(id, 3, 0) }, want: "Groceries\n- [ ] butter\n- [x] eggs\n- [ ] bread\n- [ ] milk"},
+		{name: "remove", edit: func() (*model.Note, error) { return service.RemoveChecklistItem(id, 2) }, want: "Groceries\n- [ ] butter\n- [x] eggs\n- [ ] milk"},
+		{name: "edit as text", edit: func() (*model.Note, error) {
+			return service.UpdateNote(id, "Groceries\n- [x] butter\n- [x] eggs\n- [x] milk", model.Yellow)
+		}, want: "Groceries\n- [x] butter\n- [x] eggs\n- [x] milk"},
+	}
+	for _, step := range steps {
+		note, err := step.edit()
+		if err != nil {
+			t.Fatalf("Failed to %s: %v", step.name, err)
+		}
+		if got := note.Text(); got != step.want {
+			t.Errorf("Checklist mismatch after %s, got: %q, want: %q", step.name, got, step.want)
+		}
+	}
+	if _, err := service.ToggleChecklistItem(id, 3); err == nil {
+		t.Error("Expected an item out of range to be refused")
+	}
+
+	note, _ := service.GetNote(id)
+	if done, total := note.Progress(); done != 3 || total != 3 {
+		t.Errorf("Progress mismatch, got: %d/%d, want: 3/3", done, total)
+	}
+	if revisions, _ := service.ListRevisions(id); len(revisions) != len(steps)+1 {
+		t.Errorf("Revision count mismatch, got: %d, want: %d", len(revisions), len(steps)+1)
+	}
+	if results, _ := service.SearchNotes("butter"); len(results) != 1 {
+		t.Errorf("Expected items to be searchable, got: %d results", len(results))
+	}
+
+	todo, _ := service.CreateNote("Weekend\n- [x] mow\n- wash car", model.Blue)
+	if _, err := service.AddChecklistItem(todo.ID, "x"); err == nil {
+		t.Error("Expected adding an item to a text note to fail")
+	}
+	converted, err := service.ConvertToChecklist(todo.ID)
+	if err != nil {
+		t.Fatalf("Failed to convert note: %v", err)
+	}
+	if converted.Content != "Weekend" || len(converted.Items) != 2 || !converted.Items[0].Done {
+		t.Errorf("Unexpected checklist: %+v", converted)
+	}
+	page, err := service.FindNotes(repository.Query{Items: repository.ItemsOpen})
+	if err != nil || len(page.Notes) != 1 || page.Notes[0].ID != todo.ID {
+		t.Errorf("Expected only the converted checklist to have open items, got: %+v (%v)", page, err)
+	}
+
+	text, err := service.ConvertToText(id)
+	if err != nil {
+		t.Fatalf("Failed to convert note: %v", err)
+	}
+	if text.IsChecklist() || text.Items != nil || text.Content != steps[len(steps)-1].want {
+		t.Errorf("Unexpected text note: %+v", text)
+	}
+}
+
+func TestReminders(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+
+	first, _ := service.CreateNote("Call the bank", model.Yellow)
+	second, _ := service.CreateNote("Send report", model.Blue)
+	now := time.Now()
+	later, sooner := now.Add(2*time.Hour), now.Add(-time.Minute)
+
+	scheduled, err := service.SetReminder(first.ID, &later)
+	if err != nil {
+		t.Fatalf("Failed to set reminder: %v", err)
+	}
+	if !scheduled.UpdatedAt.Equal(first.UpdatedAt) || scheduled.Version != 2 {
+		t.Errorf("Expected a reminder to keep the update time and bump the version, got: %+v", scheduled)
+	}
+	if _, err := service.SetReminder(second.ID, &sooner); err != nil {
+		t.Fatalf("Failed to set reminder: %v", err)
+	}
+	if _, err := service.SetDueDate(second.ID, &later); err != nil {
+		t.Fatalf("Failed to set due date: %v", err)
+	}
+
+	pending, err := service.PendingReminders()
+	if err != nil {
+		t.Fatalf("Failed to list reminders: %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != second.ID || pending[1].ID != first.ID {
+		t.Fatalf("Expected the sooner reminder first, got: %+v", pending)
+	}
+
+	if _, err := service.MarkReminded(first, now); err == nil {
+		t.Error("Expected claiming a reminder from an old version to fail")
+	}
+	fired, err := service.MarkReminded(pending[0], now)
+	if err != nil {
+		t.Fatalf("Failed to mark reminder: %v", err)
+	}
+	if fired.RemindedAt == nil || fired.ReminderPending() {
+		t.Errorf("Expected the reminder to have fired, got: %+v", fired)
+	}
+	if _, err := service.MarkReminded(pending[0], now); err == nil {
+		t.Error("Expected a reminder to be claimed only once")
+	}
+	if pending, _ := service.PendingReminders(); len(pending) != 1 || pending[0].ID != first.ID {
+		t.Errorf("Expected only the later reminder pending, got: %+v", pending)
+	}
+
+	snoozed, err := service.SnoozeReminder(second.ID, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to snooze reminder: %v", err)
+	}
+	if !snoozed.ReminderPending() || snoozed.RemindAt.Before(now.Add(10*time.Minute)) {
+		t.Errorf("Expected the reminder pending again in 10 minutes, got: %v", snoozed.RemindAt)
+	}
+	if _, err := service.SnoozeReminder(second.ID, 0); err == nil {
+		t.Error("Expected a zero snooze to be refused")
+	}
+
+	dismissed, err := service.DismissReminder(second.ID)
+	if err != nil {
+		t.Fatalf("Failed to dismiss reminder: %v", err)
+	}
+	if dismissed.RemindAt != nil || dismissed.DueAt == nil {
+		t.Errorf("Expected the reminder removed and the due date kept, got: %+v", dismissed)
+	}
+	if _, err := service.SnoozeReminder(second.ID, time.Minute); err == nil {
+		t.Error("Expected snoozing a note without a reminder to fail")
+	}
+	if due, _ := service.DueNotes(); len(due) != 1 || due[0].ID != second.ID {
+		t.Errorf("Expected one due note, got: %+v", due)
+	}
+	if revisions, _ := service.ListRevisions(second.ID); len(revisions) != 1 {
+		t.Errorf("Expected scheduling to keep no history, got: %d revisions", len(revisions))
+	}
+}
+
+func TestEvents(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+	sub, err := service.Events().Subscribe(events.SubscribeOptions{Buffer: 32})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	note, _ := service.CreateNote("first", model.Yellow)
+	service.UpdateNote(note.ID, "second", model.Blue)
+	service.DeleteNote(note.ID)
+	service.RestoreNote(note.ID)
+	other, _ := service.CreateNote("other", model.Pink)
+	service.DeleteNotes([]string{note.ID, other.ID})
+	service.EmptyTrash()
+
+	tests := []struct {
+		kind   events.Kind
+		before string
+		after  string
+	}{
+		{kind: events.Created, after: "first"},
+		{kind: events.Updated, before: "first", after: "second"},
+		{kind: events.Deleted, before: "second", after: "second"},
+		{kind: events.Restored, before: "second", after: "second"},
+		{kind: events.Created, after: "other"},
+		{kind: events.Deleted, before: "second", after: "second"},
+		{kind: events.Deleted, before: "other", after: "other"},
+		{kind: events.Purged, before: "second"},
+		{kind: events.Purged, before: "other"},
+	}
+	for i, tt := range tests {
+		var e events.Event
+		select {
+		case e = <-sub.Events():
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d", i)
+		}
+		if e.Kind != tt.kind {
+			t.Errorf("Event %d kind mismatch, got: %s, want: %s", i, e.Kind, tt.kind)
+		}
+		if got := contentOf(e.Before); got != tt.before {
+			t.Errorf("Event %d before mismatch, got: %q, want: %q", i, got, tt.before)
+		}
+		if got := contentOf(e.After); got != tt.after {
+			t.Errorf("Event %d after mismatch, got: %q, want: %q", i, got, tt.after)
+		}
+		if e.Kind == events.Deleted && e.After.DeletedAt == nil {
+			t.Errorf("Event %d: expected the trashed note to have a deletion time", i)
+		}
+	}
+}
+
+func contentOf(note *model.Note) string {
+	if note == nil {
+		return ""
+	}
+	return note.Content
+}
+
+func TestTransactionEventVersions(t *testing.T) {
+	service := NewNoteService(repository.NewMemoryRepository())
+	note, _ := service.CreateNote("note", model.Yellow)
+	sub, err := service.Events().Subscribe(events.SubscribeOptions{Kinds: []events.Kind{events.Updated}})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	if _, err := service.RecolorNotes([]string{note.ID}, model.Blue); err != nil {
+		t.Fatalf("Failed to recolor notes: %v", err)
+	}
+	var e events.Event
+	select {
+	case e = <-sub.Events():
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the update event")
+	}
+	stored, _ := service.GetNote(note.ID)
+	if e.After.Version != stored.Version {
+		t.Fatalf("Event version mismatch, got: %d, want: %d", e.After.Version, stored.Version)
+	}
+	if _, err := service.UpdateNoteAt(note.ID, e.After.Version, "edited", model.Blue); err != nil {
+		t.Errorf("Expected an update at the event's version to succeed: %v", err)
+	}
+}
+
+func TestWatchStore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sticky-notes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	repo, err := repository.NewFileRepository(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	service := NewNoteService(repo)
+	note, _ := service.CreateNote("shopping list", model.Yellow)
+	if results, _ := service.SearchNotes("shopping"); len(results) != 1 {
+		t.Fatalf("Expected the note to be indexed, got: %d", len(results))
+	}
+
+	sub, _ := service.Events().Subscribe(events.SubscribeOptions{})
+	defer sub.Close()
+	watcher, err := service.WatchStore(repository.WatchOptions{Poll: true, Interval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to watch store: %v", err)
+	}
+	defer watcher.Close()
+
+	path := filepath.Join(tempDir, note.ID+".json")
+	data, _ := os.ReadFile(path)
+	edited := strings.Replace(string(data), "shopping list", "packing list", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatalf("Failed to edit note file: %v", err)
+	}
+
+	select {
+	case e := <-sub.Events():
+		if e.Kind != events.Updated || e.Before.Content != "shopping list" || e.After.Content != "packing list" {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the external edit")
+	}
+	if results, _ := service.SearchNotes("packing"); len(results) != 1 {
+		t.Errorf("Expected the edit to be indexed, got: %d", len(results))
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0644)
+	select {
+	case e := <-sub.Events():
+		if e.Kind != events.Invalid || e.Err == nil {
+			t.Errorf("Expected an invalid edit to be reported, got: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the invalid edit")
+	}
+
+	plain := NewNoteService(repository.NewMemoryRepository())
+	if _, err := plain.WatchStore(repository.WatchOptions{}); !errors.Is(err, ErrWatchUnsupported) {
+		t.Errorf("Expected ErrWatchUnsupported, got: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// ColorInUseError is returned when removing a palette color that live
+// notes still have and no color to remap them to was given.
+type ColorInUseError struct {
+	Color model.Color
+	// Notes is how many live notes have the color.
+	Notes int
+}
+
+func (e *ColorInUseError) Error() string {
+	return fmt.Sprintf("color %s is used by %d notes; choose a color to give them instead", e.Color, e.Notes)
+}
+
+// Palette returns the store's palette, or the default palette if the store
+// has none or cannot keep one.
+func (s *NoteService) Palette() (*model.Palette, error) {
+	if paletteRepo, ok := s.repo.(repository.PaletteRepository); ok {
+		palette, err := paletteRepo.Palette()
+		if err != nil {
+			return nil, err
+		}
+		if palette != nil {
+			return palette, nil
+		}
+		return model.DefaultPalette(), nil
+	}
+
+	s.paletteMutex.Lock()
+	defer s.paletteMutex.Unlock()
+	if s.palette == nil {
+		return model.DefaultPalette(), nil
+	}
+	return s.palette.Clone(), nil
+}
+
+// SetPaletteColor adds a color to the palette or changes the hex value and
+// meaning of one already in it.
+func (s *NoteService) SetPaletteColor(color model.PaletteColor) (*model.Palette, error) {
+	palette, err := s.Palette()
+	if err != nil {
+		return nil, err
+	}
+	if err := palette.Set(color); err != nil {
+		return nil, err
+	}
+	return palette, s.savePalette(palette)
+}
+
+// SetDefaultColor makes a palette color the one new notes get unless
+// another is chosen.
+func (s *NoteService) SetDefaultColor(color model.Color) (*model.Palette, error) {
+	palette, err := s.Palette()
+	if err != nil {
+		return nil, err
+	}
+	if !palette.Has(color) {
+		return nil, fmt.Errorf("color %s is not in the palette", color)
+	}
+	palette.Default = color
+	return palette, s.savePalette(palette)
+}
+
+// RemovePaletteColor takes a color out of the palette. Live notes with the
+// color are first recolored to remapTo, all or none, and their count is
+// returned; if there are any and remapTo is empty, nothing changes and a
+// *ColorInUseError says how many there are. Trashed notes keep the color.
+func (s *NoteService) RemovePaletteColor(color, remapTo model.Color) (int, error) {
+	palette, err := s.Palette()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case !palette.Has(color):
+		return 0, fmt.Errorf("color %s is not in the palette", color)
+	case len(palette.Colors) == 1:
+		return 0, fmt.Errorf("cannot remove the last color of the palette")
+	case palette.Default == color:
+		return 0, fmt.Errorf("color %s is the default; choose another default first", color)
+	}
+
+	page, err := s.repo.Find(repository.Query{Colors: []model.Color{color}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find notes with color %s: %w", color, err)
+	}
+	if len(page.Notes) > 0 {
+		if remapTo == "" {
+			return 0, &ColorInUseError{Color: color, Notes: len(page.Notes)}
+		}
+		if remapTo == color || !palette.Has(remapTo) {
+			return 0, fmt.Errorf("cannot remap notes to %s: it is not a remaining palette color", remapTo)
+		}
+		ids := make([]string, len(page.Notes))
+		for i, note := range page.Notes {
+			ids[i] = note.ID
+		}
+		if _, err := s.RecolorNotes(ids, remapTo); err != nil {
+			return 0, err
+		}
+	}
+
+	palette.Remove(color)
+	return len(page.Notes), s.savePalette(palette)
+}
+
+// ColorUsage counts the live notes of each color, including colors that
+// are no longer in the palette.
+func (s *NoteService) ColorUsage() (map[model.Color]int, error) {
+	usage := make(map[model.Color]int)
+	for note, err := range s.repo.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to count colors: %w", err)
+		}
+		usage[note.Color]++
+	}
+	return usage, nil
+}
+
+func (s *NoteService) savePalette(palette *model.Palette) error {
+	if err := palette.Validate(); err != nil {
+		return err
+	}
+	if paletteRepo, ok := s.repo.(repository.PaletteRepository); ok {
+		if err := paletteRepo.SavePalette(palette); err != nil {
+			return fmt.Errorf("failed to save palette: %w", err)
+		}
+		return nil
+	}
+
+	s.paletteMutex.Lock()
+	defer s.paletteMutex.Unlock()
+	s.palette = palette.Clone()
+	return nil
+}
+
+// checkColor reports an error unless color may be given to a note: it must
+// be in the palette, except that a note may keep the color it has.
+func (s *NoteService) checkColor(color, current model.Color) error {
+	if color == current && color.Valid() {
+		return nil
+	}
+	palette, err := s.Palette()
+	if err != nil {
+		return err
+	}
+	if !palette.Has(color) {
+		return fmt.Errorf("invalid note color: %s", color)
+	}
+	return nil
+}
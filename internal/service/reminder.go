@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// SetDueDate sets when a note is due, or clears its due date if due is nil.
+func (s *NoteService) SetDueDate(id string, due *time.Time) (*model.Note, error) {
+	return s.schedule(id, func(note *model.Note) error {
+		note.DueAt = due
+		return nil
+	})
+}
+
+// SetReminder sets when to be reminded of a note, or removes its reminder
+// if at is nil. A reminder that already fired is armed again.
+func (s *NoteService) SetReminder(id string, at *time.Time) (*model.Note, error) {
+	return s.schedule(id, func(note *model.Note) error {
+		note.RemindAt, note.RemindedAt = at, nil
+		return nil
+	})
+}
+
+// SnoozeReminder moves a note's reminder to d from now, whether or not it
+// has fired yet.
+func (s *NoteService) SnoozeReminder(id string, d time.Duration) (*model.Note, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("invalid snooze duration %s", d)
+	}
+	return s.schedule(id, func(note *model.Note) error {
+		if note.RemindAt == nil {
+			return fmt.Errorf("note %s has no reminder", id)
+		}
+		at := time.Now().Add(d)
+		note.RemindAt, note.RemindedAt = &at, nil
+		return nil
+	})
+}
+
+// DismissReminder removes a note's reminder, fired or not. The due date is
+// kept.
+func (s *NoteService) DismissReminder(id string) (*model.Note, error) {
+	return s.SetReminder(id, nil)
+}
+
+// Reminders returns the live notes with a reminder, fired or not, soonest
+// first.
+func (s *NoteService) Reminders() ([]*model.Note, error) {
+	return s.notesBy(func(note *model.Note) *time.Time { return note.RemindAt })
+}
+
+// PendingReminders returns the live notes whose reminder has not fired
+// yet, soonest first.
+func (s *NoteService) PendingReminders() ([]*model.Note, error) {
+	notes, err := s.Reminders()
+	if err != nil {
+		return nil, err
+	}
+	pending := notes[:0]
+	for _, note := range notes {
+		if note.ReminderPending() {
+			pending = append(pending, note)
+		}
+	}
+	return pending, nil
+}
+
+// DueNotes returns the live notes with a due date, soonest first.
+func (s *NoteService) DueNotes() ([]*model.Note, error) {
+	return s.notesBy(func(note *model.Note) *time.Time { return note.DueAt })
+}
+
+// MarkReminded records that a pending reminder fired at at. It only
+// succeeds if the note is still at the version it was read at, so when
+// several instances share a store exactly one of them fires each reminder;
+// the others get a *repository.ConflictError.
+func (s *NoteService) MarkReminded(note *model.Note, at time.Time) (*model.Note, error) {
+	current, err := s.repo.GetById(note.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+	if current.Version != note.Version {
+		return nil, fmt.Errorf("failed to mark reminder: %w", &repository.ConflictError{NoteID: note.ID, Version: note.Version, Current: current})
+	}
+	if !current.ReminderPending() {
+		return nil, fmt.Errorf("note %s has no pending reminder", note.ID)
+	}
+	previous := current.Clone()
+	current.RemindedAt = &at
+	return s.saveSchedule(previous, current)
+}
+
+// schedule applies change to a note's due date or reminder and saves the
+// note if anything changed. Like placing a note, this is not an edit: its
+// update time and history are left alone.
+func (s *NoteService) schedule(id string, change func(note *model.Note) error) (*model.Note, error) {
+	note, err := s.repo.GetById(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+	previous := note.Clone()
+	if err := change(note); err != nil {
+		return nil, err
+	}
+	if sameTime(previous.DueAt, note.DueAt) && sameTime(previous.RemindAt, note.RemindAt) &&
+		sameTime(previous.RemindedAt, note.RemindedAt) {
+		return note, nil
+	}
+	return s.saveSchedule(previous, note)
+}
+
+func (s *NoteService) saveSchedule(previous, note *model.Note) (*model.Note, error) {
+	if err := s.repo.Update(note); err != nil {
+		return nil, fmt.Errorf("failed to update note: %w", err)
+	}
+	s.indexNote(note)
+	s.publish(events.Updated, previous, note)
+	return note, nil
+}
+
+// notesBy returns the live notes for which at is set, ordered by it.
+func (s *NoteService) notesBy(at func(note *model.Note) *time.Time) ([]*model.Note, error) {
+	var notes []*model.Note
+	for note, err := range s.repo.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to list notes: %w", err)
+		}
+		if at(note) != nil {
+			notes = append(notes, note)
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		a, b := *at(notes[i]), *at(notes[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return notes[i].ID < notes[j].ID
+	})
+	return notes, nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bllexe/sticky-notes/internal/diff"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// ErrRevisionsUnsupported is returned when the storage backend does not keep
+// note history.
+var ErrRevisionsUnsupported = errors.New("storage backend does not support revision history")
+
+// RevisionDiff is the difference between two revisions of a note.
+type RevisionDiff struct {
+	From      *model.Revision
+	To        *model.Revision
+	Lines     []diff.Line
+	ColorFrom model.Color
+	ColorTo   model.Color
+}
+
+// ListRevisions returns every version of a note, oldest first. The last
+// entry is the note's current state.
+func (s *NoteService) ListRevisions(id string) ([]*model.Revision, error) {
+	revRepo, ok := s.repo.(repository.RevisionRepository)
+	if !ok {
+		return nil, ErrRevisionsUnsupported
+	}
+
+	note, err := s.repo.GetById(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+	revisions, err := revRepo.GetRevisions(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+
+	current := revisionOf(note)
+	current.Number = len(revisions) + 1
+	return append(revisions, current), nil
+}
+
+// DiffRevisions returns a line diff between two revisions of a note as
+// numbered by ListRevisions.
+func (s *NoteService) DiffRevisions(id string, from, to int) (*RevisionDiff, error) {
+	revisions, err := s.ListRevisions(id)
+	if err != nil {
+		return nil, err
+	}
+	a, err := findRevision(revisions, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := findRevision(revisions, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevisionDiff{
+		From:      a,
+		To:        b,
+		Lines:     diff.Lines(a.Content, b.Content),
+		ColorFrom: a.Color,
+		ColorTo:   b.Color,
+	}, nil
+}
+
+// RestoreRevision makes an old revision the note's current content. The
+// restore is an ordinary update, so the version it replaces is kept too.
+func (s *NoteService) RestoreRevision(id string, number int) (*model.Note, error) {
+	revisions, err := s.ListRevisions(id)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := findRevision(revisions, number)
+	if err != nil {
+		return nil, err
+	}
+	return s.UpdateNote(id, rev.Content, rev.Color)
+}
+
+// saveRevision records the note's state before an update, if the backend
+// keeps history.
+func (s *NoteService) saveRevision(note *model.Note) error {
+	revRepo, ok := s.repo.(repository.RevisionRepository)
+	if !ok {
+		return nil
+	}
+	if err := revRepo.SaveRevision(revisionOf(note)); err != nil {
+		return fmt.Errorf("failed to save revision: %w", err)
+	}
+	return nil
+}
+
+func revisionOf(note *model.Note) *model.Revision {
+	return &model.Revision{
+		NoteID:    note.ID,
+		Content:   note.Text(),
+		Color:     note.Color,
+		CreatedAt: note.UpdatedAt,
+	}
+}
+
+func findRevision(revisions []*model.Revision, number int) (*model.Revision, error) {
+	for _, rev := range revisions {
+		if rev.Number == number {
+			return rev, nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d not found", number)
+}
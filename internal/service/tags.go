@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// ListTags returns every tag on a live note with the number of notes
+// carrying it, ordered by tag.
+func (s *NoteService) ListTags() ([]repository.TagCount, error) {
+	if tagRepo, ok := s.repo.(repository.TagRepository); ok {
+		tags, err := tagRepo.Tags()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		return tags, nil
+	}
+
+	counts := make(map[string]int)
+	for note, err := range s.repo.All() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		for _, tag := range note.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]repository.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, repository.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags, nil
+}
+
+// TagNotes adds tags to every note in ids, all or none, and returns the
+// notes that changed.
+func (s *NoteService) TagNotes(ids []string, tags ...string) ([]*model.Note, error) {
+	add, err := model.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	return s.retag(ids, func(current []string) []string {
+		return append(current, add...)
+	})
+}
+
+// UntagNotes removes tags from every note in ids, all or none, and returns
+// the notes that changed.
+func (s *NoteService) UntagNotes(ids []string, tags ...string) ([]*model.Note, error) {
+	remove, err := model.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	return s.retag(ids, func(current []string) []string {
+		return slices.DeleteFunc(current, func(tag string) bool {
+			return slices.Contains(remove, tag)
+		})
+	})
+}
+
+// RenameTag replaces tag from with to on every note carrying it, all or
+// none, and returns how many notes changed. Renaming onto a tag that is
+// already in use merges the two.
+func (s *NoteService) RenameTag(from, to string) (int, error) {
+	ids, err := s.notesTagged(from)
+	if err != nil {
+		return 0, err
+	}
+	oldTag, _ := model.NormalizeTag(from)
+	newTag, err := model.NormalizeTag(to)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := s.retag(ids, func(current []string) []string {
+		current = slices.DeleteFunc(current, func(tag string) bool { return tag == oldTag })
+		return append(current, newTag)
+	})
+	return len(updated), err
+}
+
+// DeleteTag removes tag from every note carrying it, all or none, and
+// returns how many notes changed.
+func (s *NoteService) DeleteTag(tag string) (int, error) {
+	ids, err := s.notesTagged(tag)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := s.UntagNotes(ids, tag)
+	return len(updated), err
+}
+
+// notesTagged returns the IDs of the live notes carrying tag.
+func (s *NoteService) notesTagged(tag string) ([]string, error) {
+	expr, err := repository.HasTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.repo.Find(repository.Query{Tags: expr})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tagged notes: %w", err)
+	}
+	ids := make([]string, len(page.Notes))
+	for i, note := range page.Notes {
+		ids[i] = note.ID
+	}
+	return ids, nil
+}
+
+// retag applies change to the tags of every note in ids in one
+// transaction. Notes whose tags stay the same are left alone. A single
+// note is updated directly, so tagging one note also works on stores
+// without transactions.
+func (s *NoteService) retag(ids []string, change func(current []string) []string) ([]*model.Note, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	tagged := func(note *model.Note) (bool, error) {
+		tags, err := model.NormalizeTags(change(slices.Clone(note.Tags)))
+		if err != nil {
+			return false, err
+		}
+		if slices.Equal(tags, note.Tags) {
+			return false, nil
+		}
+		note.Tags = tags
+		note.UpdatedAt = time.Now()
+		return true, nil
+	}
+
+	if _, ok := s.repo.(repository.TxRepository); !ok && len(ids) == 1 {
+		note, err := s.repo.GetById(ids[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get note %s: %w", ids[0], err)
+		}
+		previous := note.Clone()
+		changed, err := tagged(note)
+		if err != nil || !changed {
+			return nil, err
+		}
+		if err := s.repo.Update(note); err != nil {
+			return nil, fmt.Errorf("failed to update note: %w", err)
+		}
+		s.indexNote(note)
+		s.publish(events.Updated, previous, note)
+		return []*model.Note{note}, nil
+	}
+
+	var updated []*model.Note
+	err := s.Transaction(func(tx repository.Tx) error {
+		for _, id := range ids {
+			note, err := s.repo.GetById(id)
+			if err != nil {
+				return fmt.Errorf("failed to get note %s: %w", id, err)
+			}
+			changed, err := tagged(note)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			if err := tx.Update(note); err != nil {
+				return err
+			}
+			updated = append(updated, note)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+	"github.com/bllexe/sticky-notes/internal/search"
+)
+
+// DefaultTrashRetention is how long trashed notes are kept before
+// PurgeExpiredTrash removes them.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// ErrTrashUnsupported is returned when the storage backend deletes notes
+// permanently.
+var ErrTrashUnsupported = errors.New("storage backend does not support a trash bin")
+
+// SetTrashRetention changes how long trashed notes are kept. Zero or less
+// keeps them until the trash is emptied by hand.
+func (s *NoteService) SetTrashRetention(retention time.Duration) {
+	s.trashRetention = retention
+}
+
+func (s *NoteService) ListTrash() ([]*model.Note, error) {
+	trash, err := s.trash()
+	if err != nil {
+		return nil, err
+	}
+	return trash.ListTrash()
+}
+
+// RestoreNote moves a note out of the trash.
+func (s *NoteService) RestoreNote(id string) (*model.Note, error) {
+	trash, err := s.trash()
+	if err != nil {
+		return nil, err
+	}
+	before := s.trashedNote(trash, id)
+	note, err := trash.Restore(id)
+	if err != nil {
+		return nil, err
+	}
+	s.indexNote(note)
+	s.publish(events.Restored, before, note)
+	return note, nil
+}
+
+// PurgeNote permanently deletes a note that is in the trash.
+func (s *NoteService) PurgeNote(id string) error {
+	trash, err := s.trash()
+	if err != nil {
+		return err
+	}
+	before := s.trashedNote(trash, id)
+	if err := trash.Purge(id); err != nil {
+		return err
+	}
+	s.unindexNote(id)
+	if before != nil {
+		s.publish(events.Purged, before, nil)
+	}
+	return nil
+}
+
+// EmptyTrash permanently deletes every trashed note.
+func (s *NoteService) EmptyTrash() (int, error) {
+	trash, err := s.trash()
+	if err != nil {
+		return 0, err
+	}
+	before, _ := trash.ListTrash()
+	n, err := trash.EmptyTrash()
+	s.resetIndex()
+	s.publishPurged(trash, before)
+	return n, err
+}
+
+// PurgeExpiredTrash permanently deletes notes that have been in the trash
+// longer than the retention period.
+func (s *NoteService) PurgeExpiredTrash() (int, error) {
+	if s.trashRetention <= 0 {
+		return 0, nil
+	}
+	trash, err := s.trash()
+	if errors.Is(err, ErrTrashUnsupported) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	before, _ := trash.ListTrash()
+	n, err := trash.PurgeBefore(time.Now().Add(-s.trashRetention))
+	if n > 0 {
+		s.resetIndex()
+		s.publishPurged(trash, before)
+	}
+	return n, err
+}
+
+// GetAllNotesIncludingTrash returns live and trashed notes.
+func (s *NoteService) GetAllNotesIncludingTrash() ([]*model.Note, error) {
+	notes, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := s.ListTrash()
+	if errors.Is(err, ErrTrashUnsupported) {
+		return notes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	return append(notes, trashed...), nil
+}
+
+// SearchNotesIncludingTrash is SearchNotes over live and trashed notes.
+func (s *NoteService) SearchNotesIncludingTrash(query string) ([]search.Result, error) {
+	return s.searchNotes(query, true)
+}
+
+func (s *NoteService) trash() (repository.TrashRepository, error) {
+	trash, ok := s.repo.(repository.TrashRepository)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	return trash, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bllexe/sticky-notes/internal/events"
+	"github.com/bllexe/sticky-notes/internal/model"
+	"github.com/bllexe/sticky-notes/internal/repository"
+)
+
+// ErrWatchUnsupported is returned by WatchStore when the storage backend
+// cannot be changed by other programs.
+var ErrWatchUnsupported = errors.New("note store cannot be watched for external changes")
+
+// WatchStore applies changes other programs make to the note store: the
+// search index is updated and each change is published on the event bus
+// as if it had been made through the service. Edits that leave a note
+// unreadable or invalid are published as events.Invalid. The returned
+// watcher must be closed to stop watching.
+func (s *NoteService) WatchStore(opts repository.WatchOptions) (*repository.Watcher, error) {
+	watchRepo, ok := s.repo.(repository.WatchRepository)
+	if !ok {
+		return nil, ErrWatchUnsupported
+	}
+	watcher, err := watchRepo.Watch(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch note store: %w", err)
+	}
+	go func() {
+		for change := range watcher.Changes() {
+			s.applyExternalChange(change)
+		}
+	}()
+	return watcher, nil
+}
+
+func (s *NoteService) applyExternalChange(change repository.ExternalChange) {
+	switch change.Kind {
+	case repository.ChangeCreated:
+		s.indexNote(change.After)
+		s.publish(events.Created, nil, change.After)
+	case repository.ChangeModified:
+		s.indexNote(change.After)
+		s.publish(events.Updated, change.Before, change.After)
+	case repository.ChangeRemoved:
+		// Another instance deleting the note moves it to the trash.
+		trashed := s.trashedExternally(change.NoteID)
+		if trashed != nil {
+			s.indexNote(trashed)
+		} else {
+			s.unindexNote(change.NoteID)
+		}
+		s.publish(events.Deleted, change.Before, trashed)
+	case repository.ChangeInvalid:
+		s.bus.Publish(events.Event{
+			Kind:   events.Invalid,
+			NoteID: change.NoteID,
+			Before: change.Before,
+			Err:    change.Err,
+		})
+	}
+}
+
+func (s *NoteService) trashedExternally(id string) *model.Note {
+	trash, err := s.trash()
+	if err != nil {
+		return nil
+	}
+	return s.trashedNote(trash, id)
+}